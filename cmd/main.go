@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
+	"url_shortening/infra/cache"
+	"url_shortening/infra/clicks"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
 	"url_shortening/infra/db/redis"
+	"url_shortening/infra/lockout"
+	"url_shortening/infra/mailer"
+	"url_shortening/infra/oauth"
+	"url_shortening/infra/sessions"
 	"url_shortening/internal/delivery/httpserver"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/internal/useCase/urlShortening"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
@@ -24,9 +35,30 @@ func main() {
 		panic(fmt.Errorf("error new config: %w", err))
 	}
 
-	db, err := postgres.NewPostgres(config)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(config, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "unlock" {
+		if err := runUnlock(config, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		if err := runRole(config, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	store, err := store.NewStore(config)
 	if err != nil {
-		panic(fmt.Errorf("error new postgres: %w", err))
+		panic(fmt.Errorf("error new store: %w", err))
 	}
 
 	redis, err := redis.NewRedis(config)
@@ -34,9 +66,74 @@ func main() {
 		panic(fmt.Errorf("error new redis: %w", err))
 	}
 
-	app := fiber.New()
+	// Redis is optional at runtime: redirects fall back to the in-process
+	// cache and the database while it is unreachable.
+	if err := redis.Ping(context.Background()); err != nil {
+		log.Printf("redis unreachable, using in-memory cache until it recovers: %v", err)
+	}
+
+	localCache := cache.NewLRU(config.CACHE.LocalSize, config.CACHE.LocalTTL)
+
+	slugFilter := cache.NewSlugFilter(config.CACHE.SlugFilterCapacity, func(since time.Time, add func(slug string)) error {
+		return store.Urls.ForEachSlug(context.Background(), since, add)
+	})
+	go rebuildSlugFilter(slugFilter, config.CACHE.SlugFilterRebuildInterval)
+	go syncSlugFilter(slugFilter, config.CACHE.SlugFilterSyncInterval)
+
+	// Edits, deletes and new slugs are broadcast so every instance updates its
+	// local cache and slug filter, and reads what was just written from the
+	// primary.
+	invalidator := cache.NewRedisInvalidator(redis, localCache, slugFilter)
+	invalidator.OnInvalidate(store.Written)
+	store.OnWritten(func(keys ...string) {
+		if err := invalidator.PublishWritten(context.Background(), keys...); err != nil {
+			log.Printf("replica read-after-write broadcast %v: %v", keys, err)
+		}
+	})
+	go invalidator.Listen(context.Background())
 
-	server, err := httpserver.NewServer(app, db, redis, config)
+	slugs := cache.NewSlugs(slugFilter, invalidator)
+
+	cache := cache.NewInvalidating(
+		cache.NewLayered(localCache, cache.NewRedisCache(redis, config.CACHE.RedisCooldown)),
+		invalidator,
+		// Longer than any url lookup, which is bounded by both timeouts.
+		config.DB.Timeout+config.REDIS.Timeout,
+	)
+
+	// Redirects are counted in Redis and moved to Postgres in batches.
+	clickCounter := clicks.NewCounter(redis, store.Urls.AddClicks, config.CLICKS.FlushTimeout, config.CLICKS.QueueSize)
+	go clickCounter.Run(context.Background())
+	go flushClicks(clickCounter, config.CLICKS.FlushInterval, config.CLICKS.FlushTimeout)
+
+	// Click partitions are created ahead and expired ones dropped or archived.
+	go maintainClicks(store.Urls, config.CLICKS.RetentionInterval)
+
+	app := fiber.New(fiber.Config{
+		BodyLimit:    config.HTTP.BodyLimit,
+		ErrorHandler: httpserver.ErrorHandler,
+	})
+
+	// Login sessions and their refresh tokens live in Redis.
+	sessionManager := sessions.NewManager(redis, config.AUTH.RefreshTokenTTL)
+
+	// Accounts waiting for the transfer of their links are deleted once it
+	// expires.
+	go expireDeletionTransfers(store, cache, slugs, sessionManager, config.AUTH.DeletionTransferTTL)
+
+	// Failed sign-ins are counted in Redis, per account and per IP.
+	loginGuard := lockout.NewGuard(redis, config)
+
+	// Sign-in with Google, GitHub or any OIDC provider configured.
+	oauthManager := oauth.NewManager(redis, config)
+
+	// Verification emails go through SMTP, stdout or an outbox directory.
+	mailer, err := mailer.NewMailer(config)
+	if err != nil {
+		panic(fmt.Errorf("error new mailer: %w", err))
+	}
+
+	server, err := httpserver.NewServer(app, store, redis, cache, slugs, clickCounter, sessionManager, loginGuard, oauthManager, mailer, config)
 	if err != nil {
 		panic(fmt.Errorf("error new server: %w", err))
 	}
@@ -45,3 +142,63 @@ func main() {
 
 	log.Fatal(app.Listen(fmt.Sprintf("%s:%d", config.HTTP.Url, config.HTTP.Port)))
 }
+
+// rebuildSlugFilter builds the slug filter at startup and then periodically,
+// which also repairs changes missed while the invalidation channel was down.
+func rebuildSlugFilter(filter *cache.SlugFilter, interval time.Duration) {
+	for {
+		if err := filter.Rebuild(); err != nil {
+			log.Printf("slug filter rebuild: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// syncSlugFilter adds the slugs changed in the last two intervals every
+// interval, so a new slug whose broadcast was lost answers 404 for one
+// interval at most. The overlap covers a sync that ran late.
+func syncSlugFilter(filter *cache.SlugFilter, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		if err := filter.Sync(time.Now().Add(-2 * interval)); err != nil {
+			log.Printf("slug filter sync: %v", err)
+		}
+	}
+}
+
+// flushClicks moves the click counts from Redis to Postgres every interval.
+// Counts that fail to flush stay in Redis and are retried on the next run.
+func flushClicks(counter *clicks.Counter, interval time.Duration, timeout time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := counter.Flush(ctx); err != nil {
+			log.Printf("click flush: %v", err)
+		}
+		cancel()
+	}
+}
+
+// maintainClicks runs the click partition and retention job at startup and
+// then every interval.
+func maintainClicks(urls urlShortening_repo.Repository, interval time.Duration) {
+	for {
+		if err := urls.MaintainClicks(context.Background()); err != nil {
+			log.Printf("click maintenance: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// expireDeletionTransfers ends the expired transfers of accounts being
+// deleted, and deletes the accounts, at startup and then every hour.
+func expireDeletionTransfers(store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, sessionManager *sessions.Manager, ttl time.Duration) {
+	for {
+		if err := urlShortening.ExpireDeletionTransfers(context.Background(), store, urlCache, slugs, sessionManager, ttl); err != nil {
+			log.Printf("deletion transfer expiry: %v", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
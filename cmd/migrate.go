@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"url_shortening/infra/config/environment"
+	"url_shortening/internal/domain/repository/store"
+)
+
+const migrateUsage = "usage: main migrate up|down [steps]|status|to <version> [--dry-run]"
+
+// runMigrate implements the migrate subcommand. With --dry-run, up, down and
+// to print the SQL they would run instead of running it.
+func runMigrate(config *environment.Config, args []string) error {
+	dryRun := slices.Contains(args, "--dry-run") || slices.Contains(args, "-dry-run")
+	args = slices.DeleteFunc(args, func(arg string) bool {
+		return arg == "--dry-run" || arg == "-dry-run"
+	})
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := store.NewMigrator(config)
+	if err != nil {
+		return err
+	}
+	migrator.DryRun = dryRun
+	migrator.Output = os.Stdout
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return migrator.Down(ctx, steps)
+
+	case "to":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return migrator.To(ctx, version)
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, status.State, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
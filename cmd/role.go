@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/redis"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+)
+
+const roleUsage = "usage: main role <email> user|admin"
+
+// runRole implements the role subcommand, which appoints the first admins;
+// later ones can be appointed through /admin. The user's sessions are signed
+// out so their next access token carries the new role.
+func runRole(config *environment.Config, args []string) error {
+	if len(args) != 2 || args[0] == "" || (args[1] != user_repo.RoleUser && args[1] != user_repo.RoleAdmin) {
+		return errors.New(roleUsage)
+	}
+	email, role := args[0], args[1]
+
+	if config.DB.Driver == environment.DBDriverMemory {
+		return errors.New("role needs a database, DB_DRIVER is memory")
+	}
+
+	store, err := store.NewStore(config)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	user, err := store.Users.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", email, err)
+	}
+
+	if user.Role == role {
+		fmt.Printf("%s is already %s\n", email, role)
+		return nil
+	}
+
+	if err := store.Users.SetRole(ctx, user.ID, role); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s (was %s)\n", email, role, user.Role)
+
+	// Admin requests check the role in the database too, so a failure here
+	// only delays the change until the user signs in again.
+	redis, err := redis.NewRedis(config)
+	if err == nil {
+		err = sessions.NewManager(redis, config.AUTH.RefreshTokenTTL).RevokeAll(ctx, user.ID, "")
+	}
+	if err != nil {
+		fmt.Printf("sessions of %s not signed out: %v\n", email, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/redis"
+	"url_shortening/infra/lockout"
+)
+
+const unlockUsage = "usage: main unlock <email> | main unlock --ip <address>"
+
+// runUnlock implements the unlock subcommand, which lifts a sign-in lock on
+// an account or IP and forgets its failed attempts.
+func runUnlock(config *environment.Config, args []string) error {
+	kind := lockout.KindAccount
+	if len(args) == 2 && (args[0] == "--ip" || args[0] == "-ip") {
+		kind, args = lockout.KindIP, args[1:]
+	}
+	if len(args) != 1 || args[0] == "" {
+		return errors.New(unlockUsage)
+	}
+
+	redis, err := redis.NewRedis(config)
+	if err != nil {
+		return err
+	}
+
+	guard := lockout.NewGuard(redis, config)
+	ctx := context.Background()
+
+	status, err := guard.Status(ctx, kind, args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := guard.Unlock(ctx, kind, args[0]); err != nil {
+		return err
+	}
+
+	switch {
+	case time.Now().Before(status.LockedUntil):
+		fmt.Printf("%s %s unlocked (was locked until %s)\n", kind, args[0], status.LockedUntil.Format("2006-01-02 15:04:05"))
+	case status.Failures > 0:
+		fmt.Printf("%s %s was not locked, %d failed attempts forgotten\n", kind, args[0], status.Failures)
+	default:
+		fmt.Printf("%s %s has no failed attempts\n", kind, args[0])
+	}
+
+	return nil
+}
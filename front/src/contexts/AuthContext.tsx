@@ -48,8 +48,14 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
       setIsLoading(true);
       const response = await authService.login({ email, password });
 
+      // Com 2FA o cookie de sessão só vem depois do código
+      if (response.two_factor_required) {
+        return true;
+      }
+
       // O token agora é armazenado automaticamente via cookie
       setUser(response.user);
+      return false;
     } catch (error) {
       console.error("Login failed:", error);
       throw error;
@@ -58,6 +64,21 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     }
   };
 
+  const loginTwoFactor = async (code: string, recovery: boolean) => {
+    try {
+      setIsLoading(true);
+      const response = await authService.loginTwoFactor(
+        recovery ? { recovery_code: code } : { code }
+      );
+      setUser(response.user);
+    } catch (error) {
+      console.error("Two-factor login failed:", error);
+      throw error;
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   const register = async (name: string, email: string, password: string) => {
     try {
       setIsLoading(true);
@@ -86,8 +107,10 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   const value: AuthContextType = {
     user,
     login,
+    loginTwoFactor,
     register,
     logout,
+    refreshUser: checkAuthStatus,
     isLoading,
   };
 
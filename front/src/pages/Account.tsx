@@ -0,0 +1,224 @@
+import React, { useState } from "react";
+import { Link } from "react-router-dom";
+import { useAuth } from "../contexts/AuthContext";
+import { authService } from "../services/api";
+
+const inputClass =
+  "appearance-none rounded-md block w-full px-3 py-2 border border-gray-600 placeholder-gray-400 text-gray-100 bg-gray-800 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm";
+
+export const Account: React.FC = () => {
+  const { user, logout, refreshUser } = useAuth();
+
+  const [name, setName] = useState(user?.name || "");
+  const [email, setEmail] = useState(user?.email || "");
+  const [password, setPassword] = useState("");
+  const [message, setMessage] = useState("");
+
+  const [deletePassword, setDeletePassword] = useState("");
+  const [links, setLinks] = useState<"delete" | "transfer">("delete");
+  const [transferTo, setTransferTo] = useState("");
+
+  const [error, setError] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  const emailChanged = email !== user?.email;
+
+  const handleProfile = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+    setMessage("");
+    setIsLoading(true);
+
+    try {
+      const response = await authService.updateProfile(
+        emailChanged ? { name, email, password } : { name }
+      );
+      await refreshUser();
+      setPassword("");
+      setEmail(response.user.email);
+      setMessage(
+        response.pending_email
+          ? `Enviamos um link de confirmação para ${response.pending_email}. O email só muda depois da confirmação.`
+          : "Perfil atualizado."
+      );
+    } catch (err: any) {
+      setError(err.response?.data?.error || "Erro ao atualizar o perfil");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleDelete = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!window.confirm("Excluir a conta é definitivo. Deseja continuar?")) {
+      return;
+    }
+
+    setError("");
+    setMessage("");
+    setIsLoading(true);
+
+    try {
+      const response = await authService.deleteAccount(
+        links === "transfer"
+          ? { password: deletePassword, links, transfer_to: transferTo }
+          : { password: deletePassword, links }
+      );
+      if (response.expires_at) {
+        setDeletePassword("");
+        setMessage(
+          `Suas URLs foram oferecidas a ${transferTo}. A conta é excluída quando a transferência for aceita ou recusada, ou em ${new Date(
+            response.expires_at
+          ).toLocaleString()}.`
+        );
+        setIsLoading(false);
+        return;
+      }
+      await logout();
+    } catch (err: any) {
+      setError(err.response?.data?.error || "Erro ao excluir a conta");
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-gray-900">
+      {/* Header */}
+      <div className="bg-gray-800 shadow">
+        <div className="max-w-7xl mx-auto px-4 sm:px-6 lg:px-8">
+          <div className="flex justify-between items-center py-6">
+            <div>
+              <h1 className="text-3xl font-bold text-gray-100">Conta</h1>
+              <p className="text-gray-300">Perfil e exclusão da conta</p>
+            </div>
+            <div className="flex items-center space-x-4">
+              <Link
+                to="/dashboard"
+                className="bg-blue-600 text-white px-4 py-2 rounded-md hover:bg-blue-700 transition-colors"
+              >
+                Nova URL
+              </Link>
+              <button
+                onClick={logout}
+                className="bg-red-600 text-white px-4 py-2 rounded-md hover:bg-red-700 transition-colors"
+              >
+                Sair
+              </button>
+            </div>
+          </div>
+        </div>
+      </div>
+
+      <div className="max-w-2xl mx-auto py-8 px-4 sm:px-6 lg:px-8 space-y-6">
+        {error && (
+          <div className="p-4 bg-red-900 border border-red-700 rounded-md">
+            <p className="text-red-200 text-sm">{error}</p>
+          </div>
+        )}
+
+        {message && (
+          <div className="p-4 bg-green-900 border border-green-700 rounded-md">
+            <p className="text-green-200 text-sm">{message}</p>
+          </div>
+        )}
+
+        <form
+          onSubmit={handleProfile}
+          className="bg-gray-800 rounded-lg p-6 space-y-4"
+        >
+          <h2 className="text-lg font-medium text-gray-100">Perfil</h2>
+          <input
+            type="text"
+            required
+            className={inputClass}
+            placeholder="Nome"
+            value={name}
+            onChange={(e) => setName(e.target.value)}
+          />
+          <input
+            type="email"
+            required
+            className={inputClass}
+            placeholder="Email"
+            value={email}
+            onChange={(e) => setEmail(e.target.value)}
+          />
+          {emailChanged && (
+            <input
+              type="password"
+              required
+              className={inputClass}
+              placeholder="Senha atual, para trocar o email"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+            />
+          )}
+          <button
+            type="submit"
+            disabled={isLoading}
+            className="bg-blue-600 text-white px-4 py-2 rounded-md hover:bg-blue-700 disabled:opacity-50"
+          >
+            Salvar
+          </button>
+        </form>
+
+        <form
+          onSubmit={handleDelete}
+          className="bg-gray-800 rounded-lg p-6 space-y-4"
+        >
+          <h2 className="text-lg font-medium text-gray-100">Excluir conta</h2>
+          <p className="text-sm text-gray-400">
+            Seus dados são apagados de forma definitiva. Escolha o que fazer
+            com suas URLs encurtadas.
+          </p>
+          <div className="space-y-2 text-gray-300">
+            <label className="flex items-center space-x-2">
+              <input
+                type="radio"
+                checked={links === "delete"}
+                onChange={() => setLinks("delete")}
+              />
+              <span>Excluir minhas URLs, que deixam de funcionar</span>
+            </label>
+            <label className="flex items-center space-x-2">
+              <input
+                type="radio"
+                checked={links === "transfer"}
+                onChange={() => setLinks("transfer")}
+              />
+              <span>
+                Oferecer minhas URLs a outro usuário; a conta é excluída depois
+                da resposta
+              </span>
+            </label>
+          </div>
+          {links === "transfer" && (
+            <input
+              type="email"
+              required
+              className={inputClass}
+              placeholder="Email de quem recebe as URLs"
+              value={transferTo}
+              onChange={(e) => setTransferTo(e.target.value)}
+            />
+          )}
+          <input
+            type="password"
+            required
+            className={inputClass}
+            placeholder="Senha atual"
+            value={deletePassword}
+            onChange={(e) => setDeletePassword(e.target.value)}
+          />
+          <button
+            type="submit"
+            disabled={isLoading}
+            className="bg-red-600 text-white px-4 py-2 rounded-md hover:bg-red-700 disabled:opacity-50"
+          >
+            Excluir conta
+          </button>
+        </form>
+      </div>
+    </div>
+  );
+};
@@ -0,0 +1,437 @@
+import React, { useCallback, useEffect, useState } from "react";
+import { Link } from "react-router-dom";
+import { useAuth } from "../contexts/AuthContext";
+import { adminService } from "../services/api";
+import { AdminStats, AdminUrl, AdminUrlStatus, AdminUser } from "../types";
+
+const PAGE_SIZE = 50;
+
+const inputClass =
+  "appearance-none rounded-md block w-full px-3 py-2 border border-gray-600 placeholder-gray-400 text-gray-100 bg-gray-800 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm";
+
+const buttonClass =
+  "px-3 py-1 rounded-md text-sm text-white disabled:opacity-50 transition-colors";
+
+const statusLabels: Record<AdminUrlStatus, string> = {
+  live: "Ativa",
+  deleted: "Excluída",
+  expired: "Expirada",
+  taken_down: "Removida",
+};
+
+const urlStatus = (url: AdminUrl): AdminUrlStatus => {
+  if (url.deleted_at) return "deleted";
+  if (url.taken_down_at) return "taken_down";
+  if (url.expires_at && new Date(url.expires_at) <= new Date()) return "expired";
+  return "live";
+};
+
+const formatDate = (date: string) =>
+  new Date(date).toLocaleString("pt-BR", {
+    day: "2-digit",
+    month: "2-digit",
+    year: "numeric",
+    hour: "2-digit",
+    minute: "2-digit",
+  });
+
+export const Admin: React.FC = () => {
+  const { user, logout } = useAuth();
+
+  const [stats, setStats] = useState<AdminStats | null>(null);
+
+  const [userQuery, setUserQuery] = useState("");
+  const [users, setUsers] = useState<AdminUser[]>([]);
+  const [usersTotal, setUsersTotal] = useState(0);
+  const [usersOffset, setUsersOffset] = useState(0);
+
+  const [urlQuery, setUrlQuery] = useState("");
+  const [urlStatusFilter, setUrlStatusFilter] = useState<AdminUrlStatus | "">(
+    ""
+  );
+  const [urls, setUrls] = useState<AdminUrl[]>([]);
+  const [urlsTotal, setUrlsTotal] = useState(0);
+  const [urlsOffset, setUrlsOffset] = useState(0);
+
+  const [error, setError] = useState("");
+  const [success, setSuccess] = useState("");
+  const [isBusy, setIsBusy] = useState(false);
+
+  const loadStats = useCallback(async () => {
+    setStats(await adminService.stats());
+  }, []);
+
+  const loadUsers = useCallback(async (q: string, offset: number) => {
+    const response = await adminService.users(q, offset);
+    setUsers(response.users);
+    setUsersTotal(response.total);
+    setUsersOffset(offset);
+  }, []);
+
+  const loadUrls = useCallback(
+    async (q: string, status: AdminUrlStatus | "", offset: number) => {
+      const response = await adminService.urls(q, status, offset);
+      setUrls(response.urls);
+      setUrlsTotal(response.total);
+      setUrlsOffset(offset);
+    },
+    []
+  );
+
+  useEffect(() => {
+    Promise.all([loadStats(), loadUsers("", 0), loadUrls("", "", 0)]).catch(
+      (err: any) => {
+        setError(
+          err.response?.data?.error || "Erro ao carregar o painel de admin"
+        );
+      }
+    );
+  }, [loadStats, loadUsers, loadUrls]);
+
+  // run performs an admin action, then reloads what it may have changed.
+  const run = async (action: () => Promise<void>, message: string) => {
+    setError("");
+    setSuccess("");
+    setIsBusy(true);
+
+    try {
+      await action();
+      await Promise.all([
+        loadStats(),
+        loadUsers(userQuery, usersOffset),
+        loadUrls(urlQuery, urlStatusFilter, urlsOffset),
+      ]);
+      setSuccess(message);
+    } catch (err: any) {
+      setError(err.response?.data?.error || "Erro ao executar a ação");
+    } finally {
+      setIsBusy(false);
+    }
+  };
+
+  const handleTakeDown = (url: AdminUrl) => {
+    const reason = window.prompt(
+      "Motivo da remoção, exibido a quem acessar a URL:",
+      url.takedown_reason || ""
+    );
+    if (!reason) {
+      return;
+    }
+    run(() => adminService.takeDownUrl(url.id, reason), "URL removida.");
+  };
+
+  const handleExpire = (url: AdminUrl) => {
+    if (!window.confirm(`Expirar ${url.url_shortened} agora?`)) {
+      return;
+    }
+    run(() => adminService.expireUrl(url.id), "URL expirada.");
+  };
+
+  const searchUsers = (e: React.FormEvent) => {
+    e.preventDefault();
+    run(() => loadUsers(userQuery, 0), "");
+  };
+
+  const searchUrls = (e: React.FormEvent) => {
+    e.preventDefault();
+    run(() => loadUrls(urlQuery, urlStatusFilter, 0), "");
+  };
+
+  const pager = (
+    total: number,
+    offset: number,
+    load: (offset: number) => Promise<void>
+  ) =>
+    total > PAGE_SIZE && (
+      <div className="flex items-center justify-between px-6 py-3 text-sm text-gray-400">
+        <span>
+          {offset + 1}–{Math.min(offset + PAGE_SIZE, total)} de {total}
+        </span>
+        <div className="space-x-2">
+          <button
+            disabled={isBusy || offset === 0}
+            onClick={() => run(() => load(offset - PAGE_SIZE), "")}
+            className={`${buttonClass} bg-gray-700 hover:bg-gray-600`}
+          >
+            Anterior
+          </button>
+          <button
+            disabled={isBusy || offset + PAGE_SIZE >= total}
+            onClick={() => run(() => load(offset + PAGE_SIZE), "")}
+            className={`${buttonClass} bg-gray-700 hover:bg-gray-600`}
+          >
+            Próxima
+          </button>
+        </div>
+      </div>
+    );
+
+  return (
+    <div className="min-h-screen bg-gray-900">
+      {/* Header */}
+      <div className="bg-gray-800 shadow">
+        <div className="max-w-7xl mx-auto px-4 sm:px-6 lg:px-8">
+          <div className="flex justify-between items-center py-6">
+            <div>
+              <h1 className="text-3xl font-bold text-gray-100">Admin</h1>
+              <p className="text-gray-300">Usuários, URLs e estatísticas</p>
+            </div>
+            <div className="flex items-center space-x-4">
+              <Link
+                to="/dashboard"
+                className="bg-blue-600 text-white px-4 py-2 rounded-md hover:bg-blue-700 transition-colors"
+              >
+                Nova URL
+              </Link>
+              <button
+                onClick={logout}
+                className="bg-red-600 text-white px-4 py-2 rounded-md hover:bg-red-700 transition-colors"
+              >
+                Sair
+              </button>
+            </div>
+          </div>
+        </div>
+      </div>
+
+      <div className="max-w-7xl mx-auto py-8 px-4 sm:px-6 lg:px-8 space-y-6">
+        {error && (
+          <div className="p-4 bg-red-900 border border-red-700 rounded-md">
+            <p className="text-red-200 text-sm">{error}</p>
+          </div>
+        )}
+
+        {success && (
+          <div className="p-4 bg-green-900 border border-green-700 rounded-md">
+            <p className="text-green-200 text-sm">{success}</p>
+          </div>
+        )}
+
+        {stats && (
+          <div className="grid grid-cols-2 md:grid-cols-5 gap-4">
+            {[
+              ["Usuários", stats.users.total],
+              ["Desativados", stats.users.disabled],
+              ["URLs ativas", stats.links.live],
+              ["URLs removidas", stats.links.taken_down],
+              ["Cliques", stats.links.clicks],
+            ].map(([label, value]) => (
+              <div key={label} className="bg-gray-800 rounded-lg p-4">
+                <p className="text-sm text-gray-400">{label}</p>
+                <p className="text-2xl font-bold text-gray-100">{value}</p>
+              </div>
+            ))}
+          </div>
+        )}
+
+        {/* Usuários */}
+        <div className="bg-gray-800 rounded-lg shadow-md overflow-hidden">
+          <div className="px-6 py-4 border-b border-gray-700 space-y-3">
+            <h2 className="text-xl font-semibold text-gray-100">
+              Usuários ({usersTotal})
+            </h2>
+            <form onSubmit={searchUsers} className="flex space-x-2">
+              <input
+                type="text"
+                className={inputClass}
+                placeholder="Buscar por nome ou email"
+                value={userQuery}
+                onChange={(e) => setUserQuery(e.target.value)}
+              />
+              <button
+                type="submit"
+                disabled={isBusy}
+                className={`${buttonClass} bg-blue-600 hover:bg-blue-700`}
+              >
+                Buscar
+              </button>
+            </form>
+          </div>
+
+          <div className="divide-y divide-gray-700">
+            {users.map((item) => (
+              <div
+                key={item.id}
+                className="px-6 py-4 flex flex-col md:flex-row md:items-center md:justify-between space-y-2 md:space-y-0"
+              >
+                <div className="min-w-0">
+                  <p className="text-gray-100">
+                    {item.name}{" "}
+                    <span className="text-gray-400">&lt;{item.email}&gt;</span>
+                  </p>
+                  <p className="text-xs text-gray-500">
+                    {item.role === "admin" ? "Admin" : "Usuário"} · criado em{" "}
+                    {formatDate(item.created_at)}
+                    {!item.email_verified && " · email não verificado"}
+                    {item.disabled_at &&
+                      ` · desativado em ${formatDate(item.disabled_at)}`}
+                  </p>
+                </div>
+                {item.id !== user?.id && (
+                  <div className="flex space-x-2">
+                    <button
+                      disabled={isBusy}
+                      onClick={() =>
+                        run(
+                          () =>
+                            adminService.setRole(
+                              item.id,
+                              item.role === "admin" ? "user" : "admin"
+                            ),
+                          "Papel alterado."
+                        )
+                      }
+                      className={`${buttonClass} bg-gray-700 hover:bg-gray-600`}
+                    >
+                      {item.role === "admin" ? "Remover admin" : "Tornar admin"}
+                    </button>
+                    {item.disabled_at ? (
+                      <button
+                        disabled={isBusy}
+                        onClick={() =>
+                          run(
+                            () => adminService.enableUser(item.id),
+                            "Usuário reativado."
+                          )
+                        }
+                        className={`${buttonClass} bg-green-600 hover:bg-green-700`}
+                      >
+                        Reativar
+                      </button>
+                    ) : (
+                      <button
+                        disabled={isBusy}
+                        onClick={() =>
+                          window.confirm(`Desativar ${item.email}?`) &&
+                          run(
+                            () => adminService.disableUser(item.id),
+                            "Usuário desativado."
+                          )
+                        }
+                        className={`${buttonClass} bg-red-600 hover:bg-red-700`}
+                      >
+                        Desativar
+                      </button>
+                    )}
+                  </div>
+                )}
+              </div>
+            ))}
+          </div>
+          {pager(usersTotal, usersOffset, (offset) =>
+            loadUsers(userQuery, offset)
+          )}
+        </div>
+
+        {/* URLs */}
+        <div className="bg-gray-800 rounded-lg shadow-md overflow-hidden">
+          <div className="px-6 py-4 border-b border-gray-700 space-y-3">
+            <h2 className="text-xl font-semibold text-gray-100">
+              URLs ({urlsTotal})
+            </h2>
+            <form onSubmit={searchUrls} className="flex space-x-2">
+              <input
+                type="text"
+                className={inputClass}
+                placeholder="Buscar por destino ou código"
+                value={urlQuery}
+                onChange={(e) => setUrlQuery(e.target.value)}
+              />
+              <select
+                className="rounded-md px-3 py-2 border border-gray-600 text-gray-100 bg-gray-800 sm:text-sm"
+                value={urlStatusFilter}
+                onChange={(e) =>
+                  setUrlStatusFilter(e.target.value as AdminUrlStatus | "")
+                }
+              >
+                <option value="">Todas</option>
+                {Object.entries(statusLabels).map(([value, label]) => (
+                  <option key={value} value={value}>
+                    {label}
+                  </option>
+                ))}
+              </select>
+              <button
+                type="submit"
+                disabled={isBusy}
+                className={`${buttonClass} bg-blue-600 hover:bg-blue-700`}
+              >
+                Buscar
+              </button>
+            </form>
+          </div>
+
+          <div className="divide-y divide-gray-700">
+            {urls.map((url) => {
+              const status = urlStatus(url);
+              return (
+                <div
+                  key={url.id}
+                  className="px-6 py-4 flex flex-col md:flex-row md:items-center md:justify-between space-y-2 md:space-y-0"
+                >
+                  <div className="min-w-0 flex-1 md:mr-4">
+                    <p className="text-sm text-blue-400 break-all">
+                      {url.url_shortened}
+                    </p>
+                    <p className="text-sm text-gray-400 break-all">
+                      {url.url_original}
+                    </p>
+                    <p className="text-xs text-gray-500">
+                      {statusLabels[status]} · {url.owner_email || url.id_user}{" "}
+                      · {url.clicks} cliques · criada em{" "}
+                      {formatDate(url.created_at)}
+                      {status === "taken_down" &&
+                        url.takedown_reason &&
+                        ` · motivo: ${url.takedown_reason}`}
+                      {status === "live" &&
+                        url.expires_at &&
+                        ` · expira em ${formatDate(url.expires_at)}`}
+                    </p>
+                  </div>
+                  {status !== "deleted" && (
+                    <div className="flex space-x-2">
+                      {status === "live" ? (
+                        <>
+                          <button
+                            disabled={isBusy}
+                            onClick={() => handleExpire(url)}
+                            className={`${buttonClass} bg-gray-700 hover:bg-gray-600`}
+                          >
+                            Expirar
+                          </button>
+                          <button
+                            disabled={isBusy}
+                            onClick={() => handleTakeDown(url)}
+                            className={`${buttonClass} bg-red-600 hover:bg-red-700`}
+                          >
+                            Remover
+                          </button>
+                        </>
+                      ) : (
+                        <button
+                          disabled={isBusy}
+                          onClick={() =>
+                            run(
+                              () => adminService.reinstateUrl(url.id),
+                              "URL reativada."
+                            )
+                          }
+                          className={`${buttonClass} bg-green-600 hover:bg-green-700`}
+                        >
+                          Reativar
+                        </button>
+                      )}
+                    </div>
+                  )}
+                </div>
+              );
+            })}
+          </div>
+          {pager(urlsTotal, urlsOffset, (offset) =>
+            loadUrls(urlQuery, urlStatusFilter, offset)
+          )}
+        </div>
+      </div>
+    </div>
+  );
+};
@@ -60,6 +60,26 @@ export const Dashboard: React.FC = () => {
               >
                 Minhas URLs
               </Link>
+              <Link
+                to="/security"
+                className="bg-gray-700 text-gray-200 px-4 py-2 rounded-md hover:bg-gray-600 transition-colors"
+              >
+                Segurança
+              </Link>
+              <Link
+                to="/account"
+                className="bg-gray-700 text-gray-200 px-4 py-2 rounded-md hover:bg-gray-600 transition-colors"
+              >
+                Conta
+              </Link>
+              {user?.role === "admin" && (
+                <Link
+                  to="/admin"
+                  className="bg-gray-700 text-gray-200 px-4 py-2 rounded-md hover:bg-gray-600 transition-colors"
+                >
+                  Admin
+                </Link>
+              )}
               <button
                 onClick={logout}
                 className="bg-red-600 text-white px-4 py-2 rounded-md hover:bg-red-700 transition-colors"
@@ -0,0 +1,74 @@
+import React, { useState } from "react";
+import { Link } from "react-router-dom";
+import { authService } from "../services/api";
+
+export const ForgotPassword: React.FC = () => {
+  const [email, setEmail] = useState("");
+  const [message, setMessage] = useState("");
+  const [error, setError] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+    setMessage("");
+    setIsLoading(true);
+
+    try {
+      await authService.forgotPassword(email);
+      setMessage(
+        "Se existir uma conta com este email, enviamos um link para redefinir a senha."
+      );
+    } catch (err) {
+      setError("Erro ao solicitar redefinição. Tente novamente.");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-900 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-8">
+        <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-100">
+          Esqueceu sua senha?
+        </h2>
+
+        <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+          <input
+            type="email"
+            required
+            className="appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-600 placeholder-gray-400 text-gray-100 bg-gray-800 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+            placeholder="Email"
+            value={email}
+            onChange={(e) => setEmail(e.target.value)}
+          />
+
+          {message && (
+            <div className="rounded-md bg-green-900 p-4 text-sm text-green-200">
+              {message}
+            </div>
+          )}
+          {error && (
+            <div className="rounded-md bg-red-900 p-4 text-sm text-red-200">
+              {error}
+            </div>
+          )}
+
+          <button
+            type="submit"
+            disabled={isLoading}
+            className="w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 disabled:opacity-50 disabled:cursor-not-allowed"
+          >
+            {isLoading ? "Enviando..." : "Enviar link"}
+          </button>
+        </form>
+
+        <p className="text-center text-sm">
+          <Link to="/login" className="font-medium text-blue-600 hover:text-blue-500">
+            Voltar para o login
+          </Link>
+        </p>
+      </div>
+    </div>
+  );
+};
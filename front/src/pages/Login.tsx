@@ -1,31 +1,151 @@
-import React, { useState } from "react";
-import { Link, useNavigate } from "react-router-dom";
+import React, { useEffect, useState } from "react";
+import { Link, useNavigate, useSearchParams } from "react-router-dom";
 import { useAuth } from "../contexts/AuthContext";
+import { API_BASE_URL, authService } from "../services/api";
+
+// Após várias falhas o servidor responde 429 com Retry-After em segundos
+const loginError = (err: any, fallback: string) => {
+  if (err.response?.status === 429) {
+    const seconds = Number(err.response.headers["retry-after"]);
+    return seconds
+      ? `Muitas tentativas. Tente novamente em ${seconds} segundos.`
+      : "Muitas tentativas. Tente novamente mais tarde.";
+  }
+  return fallback;
+};
 
 export const Login: React.FC = () => {
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
   const [error, setError] = useState("");
   const [isLoading, setIsLoading] = useState(false);
+  const [providers, setProviders] = useState<string[]>([]);
+  const [searchParams] = useSearchParams();
+  // Depois da senha (ou do provedor externo), quando a conta usa 2FA
+  const [twoFactor, setTwoFactor] = useState(
+    searchParams.get("two_factor") === "1"
+  );
+  const [code, setCode] = useState("");
+  const [useRecoveryCode, setUseRecoveryCode] = useState(false);
 
-  const { login } = useAuth();
+  const { login, loginTwoFactor } = useAuth();
   const navigate = useNavigate();
 
+  useEffect(() => {
+    // Erro devolvido pelo login com provedor externo
+    setError(searchParams.get("error") || "");
+    authService
+      .oauthProviders()
+      .then(setProviders)
+      .catch(() => setProviders([]));
+  }, [searchParams]);
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setError("");
     setIsLoading(true);
 
     try {
-      await login(email, password);
+      if (await login(email, password)) {
+        setTwoFactor(true);
+        return;
+      }
       navigate("/dashboard");
-    } catch (err) {
-      setError("Email ou senha incorretos");
+    } catch (err: any) {
+      setError(loginError(err, "Email ou senha incorretos"));
     } finally {
       setIsLoading(false);
     }
   };
 
+  const handleTwoFactor = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+    setIsLoading(true);
+
+    try {
+      await loginTwoFactor(code, useRecoveryCode);
+      navigate("/dashboard");
+    } catch (err: any) {
+      setError(loginError(err, "Código inválido"));
+      setCode("");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  if (twoFactor) {
+    return (
+      <div className="min-h-screen flex items-center justify-center bg-gray-900 py-12 px-4 sm:px-6 lg:px-8">
+        <div className="max-w-md w-full space-y-8">
+          <div>
+            <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-100">
+              Verificação em duas etapas
+            </h2>
+            <p className="mt-2 text-center text-sm text-gray-400">
+              {useRecoveryCode
+                ? "Digite um dos seus códigos de recuperação"
+                : "Digite o código do seu aplicativo autenticador"}
+            </p>
+          </div>
+
+          <form className="mt-8 space-y-6" onSubmit={handleTwoFactor}>
+            <input
+              type="text"
+              required
+              autoFocus
+              autoComplete="one-time-code"
+              inputMode={useRecoveryCode ? "text" : "numeric"}
+              className="appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-600 placeholder-gray-400 text-gray-100 bg-gray-800 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+              placeholder={useRecoveryCode ? "xxxxx-xxxxx" : "123456"}
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+            />
+
+            {error && (
+              <div className="rounded-md bg-red-900 p-4">
+                <div className="text-sm text-red-200">{error}</div>
+              </div>
+            )}
+
+            <button
+              type="submit"
+              disabled={isLoading}
+              className="w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 disabled:opacity-50 disabled:cursor-not-allowed"
+            >
+              {isLoading ? "Verificando..." : "Verificar"}
+            </button>
+          </form>
+
+          <div className="flex justify-between text-sm">
+            <button
+              type="button"
+              onClick={() => {
+                setUseRecoveryCode(!useRecoveryCode);
+                setCode("");
+              }}
+              className="font-medium text-blue-600 hover:text-blue-500"
+            >
+              {useRecoveryCode
+                ? "Usar o aplicativo autenticador"
+                : "Usar um código de recuperação"}
+            </button>
+            <button
+              type="button"
+              onClick={() => {
+                setTwoFactor(false);
+                setError("");
+              }}
+              className="font-medium text-gray-400 hover:text-gray-300"
+            >
+              Voltar
+            </button>
+          </div>
+        </div>
+      </div>
+    );
+  }
+
   return (
     <div className="min-h-screen flex items-center justify-center bg-gray-900 py-12 px-4 sm:px-6 lg:px-8">
       <div className="max-w-md w-full space-y-8">
@@ -80,6 +200,15 @@ export const Login: React.FC = () => {
             </div>
           </div>
 
+          <div className="text-sm text-right">
+            <Link
+              to="/forgot-password"
+              className="font-medium text-blue-600 hover:text-blue-500"
+            >
+              Esqueceu sua senha?
+            </Link>
+          </div>
+
           {error && (
             <div className="rounded-md bg-red-900 p-4">
               <div className="text-sm text-red-200">{error}</div>
@@ -96,6 +225,20 @@ export const Login: React.FC = () => {
             </button>
           </div>
         </form>
+
+        {providers.length > 0 && (
+          <div className="space-y-2">
+            {providers.map((provider) => (
+              <a
+                key={provider}
+                href={`${API_BASE_URL}/auth/oauth/${provider}`}
+                className="w-full flex justify-center py-2 px-4 border border-gray-600 text-sm font-medium rounded-md text-gray-100 bg-gray-800 hover:bg-gray-700"
+              >
+                Entrar com {provider.charAt(0).toUpperCase() + provider.slice(1)}
+              </a>
+            ))}
+          </div>
+        )}
       </div>
     </div>
   );
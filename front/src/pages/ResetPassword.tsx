@@ -0,0 +1,95 @@
+import React, { useState } from "react";
+import { Link, useSearchParams } from "react-router-dom";
+import { authService } from "../services/api";
+
+export const ResetPassword: React.FC = () => {
+  const [searchParams] = useSearchParams();
+  const [password, setPassword] = useState("");
+  const [confirmPassword, setConfirmPassword] = useState("");
+  const [error, setError] = useState("");
+  const [done, setDone] = useState(false);
+  const [isLoading, setIsLoading] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+
+    if (password !== confirmPassword) {
+      setError("As senhas não coincidem");
+      return;
+    }
+
+    if (password.length < 8) {
+      setError("A senha deve ter pelo menos 8 caracteres");
+      return;
+    }
+
+    setIsLoading(true);
+
+    try {
+      await authService.resetPassword(searchParams.get("token") || "", password);
+      setDone(true);
+    } catch (err) {
+      setError("Link de redefinição inválido ou expirado.");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-900 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-8">
+        <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-100">
+          Redefinir senha
+        </h2>
+
+        {done ? (
+          <div className="rounded-md bg-green-900 p-4 text-sm text-green-200">
+            Senha redefinida. Faça login com a nova senha.
+          </div>
+        ) : (
+          <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+            <input
+              type="password"
+              required
+              autoComplete="new-password"
+              className="appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-600 placeholder-gray-400 text-gray-100 bg-gray-800 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+              placeholder="Nova senha"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+            />
+            <input
+              type="password"
+              required
+              autoComplete="new-password"
+              className="appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-600 placeholder-gray-400 text-gray-100 bg-gray-800 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+              placeholder="Confirme a nova senha"
+              value={confirmPassword}
+              onChange={(e) => setConfirmPassword(e.target.value)}
+            />
+
+            {error && (
+              <div className="rounded-md bg-red-900 p-4 text-sm text-red-200">
+                {error}
+              </div>
+            )}
+
+            <button
+              type="submit"
+              disabled={isLoading}
+              className="w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 disabled:opacity-50 disabled:cursor-not-allowed"
+            >
+              {isLoading ? "Salvando..." : "Redefinir senha"}
+            </button>
+          </form>
+        )}
+
+        <p className="text-center text-sm">
+          <Link to="/login" className="font-medium text-blue-600 hover:text-blue-500">
+            Ir para o login
+          </Link>
+        </p>
+      </div>
+    </div>
+  );
+};
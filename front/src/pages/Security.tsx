@@ -0,0 +1,223 @@
+import React, { useEffect, useState } from "react";
+import { Link } from "react-router-dom";
+import { useAuth } from "../contexts/AuthContext";
+import { authService } from "../services/api";
+import { TwoFactorEnrollment, TwoFactorStatus } from "../types";
+
+const inputClass =
+  "appearance-none rounded-md block w-full px-3 py-2 border border-gray-600 placeholder-gray-400 text-gray-100 bg-gray-800 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm";
+
+// Códigos com 6 dígitos vêm do aplicativo, os demais são de recuperação
+const codeRequest = (code: string) =>
+  /^\d{6}$/.test(code.replace(/\s/g, ""))
+    ? { code: code.replace(/\s/g, "") }
+    : { recovery_code: code };
+
+export const Security: React.FC = () => {
+  const [status, setStatus] = useState<TwoFactorStatus | null>(null);
+  const [enrollment, setEnrollment] = useState<TwoFactorEnrollment | null>(
+    null
+  );
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [code, setCode] = useState("");
+  const [error, setError] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  const { logout } = useAuth();
+
+  useEffect(() => {
+    loadStatus();
+  }, []);
+
+  const loadStatus = async () => {
+    try {
+      setStatus(await authService.twoFactorStatus());
+    } catch (err) {
+      setError("Erro ao carregar a verificação em duas etapas");
+    }
+  };
+
+  // Executa uma ação com o código digitado e recarrega o estado
+  const run = async (action: () => Promise<void>) => {
+    setError("");
+    setIsLoading(true);
+
+    try {
+      await action();
+      setCode("");
+      await loadStatus();
+    } catch (err: any) {
+      setError(err.response?.data?.error || "Código inválido");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleEnroll = () =>
+    run(async () => {
+      setRecoveryCodes([]);
+      setEnrollment(await authService.enrollTwoFactor());
+    });
+
+  const handleConfirm = (e: React.FormEvent) => {
+    e.preventDefault();
+    run(async () => {
+      setRecoveryCodes(await authService.confirmTwoFactor(code));
+      setEnrollment(null);
+    });
+  };
+
+  const handleRegenerate = () =>
+    run(async () => {
+      setRecoveryCodes(
+        await authService.regenerateRecoveryCodes(codeRequest(code))
+      );
+    });
+
+  const handleDisable = () =>
+    run(async () => {
+      await authService.disableTwoFactor(codeRequest(code));
+      setRecoveryCodes([]);
+    });
+
+  return (
+    <div className="min-h-screen bg-gray-900">
+      {/* Header */}
+      <div className="bg-gray-800 shadow">
+        <div className="max-w-7xl mx-auto px-4 sm:px-6 lg:px-8">
+          <div className="flex justify-between items-center py-6">
+            <div>
+              <h1 className="text-3xl font-bold text-gray-100">Segurança</h1>
+              <p className="text-gray-300">Verificação em duas etapas</p>
+            </div>
+            <div className="flex items-center space-x-4">
+              <Link
+                to="/dashboard"
+                className="bg-blue-600 text-white px-4 py-2 rounded-md hover:bg-blue-700 transition-colors"
+              >
+                Nova URL
+              </Link>
+              <button
+                onClick={logout}
+                className="bg-red-600 text-white px-4 py-2 rounded-md hover:bg-red-700 transition-colors"
+              >
+                Sair
+              </button>
+            </div>
+          </div>
+        </div>
+      </div>
+
+      <div className="max-w-2xl mx-auto py-8 px-4 sm:px-6 lg:px-8 space-y-6">
+        {error && (
+          <div className="p-4 bg-red-900 border border-red-700 rounded-md">
+            <p className="text-red-200 text-sm">{error}</p>
+          </div>
+        )}
+
+        {recoveryCodes.length > 0 && (
+          <div className="bg-gray-800 rounded-lg p-6">
+            <h2 className="text-lg font-medium text-gray-100">
+              Códigos de recuperação
+            </h2>
+            <p className="mt-1 text-sm text-gray-400">
+              Guarde estes códigos em um lugar seguro. Cada um funciona uma vez
+              caso você perca o aplicativo, e eles não serão mostrados de novo.
+            </p>
+            <div className="mt-4 grid grid-cols-2 gap-2 font-mono text-gray-100">
+              {recoveryCodes.map((recoveryCode) => (
+                <span key={recoveryCode}>{recoveryCode}</span>
+              ))}
+            </div>
+          </div>
+        )}
+
+        {status && !status.enabled && !enrollment && (
+          <div className="bg-gray-800 rounded-lg p-6">
+            <p className="text-gray-300">
+              A verificação em duas etapas está desativada. Ative-a para pedir
+              um código do seu aplicativo autenticador a cada login.
+            </p>
+            <button
+              onClick={handleEnroll}
+              disabled={isLoading}
+              className="mt-4 bg-blue-600 text-white px-4 py-2 rounded-md hover:bg-blue-700 disabled:opacity-50"
+            >
+              Ativar
+            </button>
+          </div>
+        )}
+
+        {enrollment && (
+          <form
+            onSubmit={handleConfirm}
+            className="bg-gray-800 rounded-lg p-6 space-y-4"
+          >
+            <p className="text-gray-300">
+              Adicione a conta ao seu aplicativo autenticador abrindo{" "}
+              <a
+                href={enrollment.otpauth_uri}
+                className="text-blue-500 hover:text-blue-400"
+              >
+                este link
+              </a>{" "}
+              no celular ou digitando a chave:
+            </p>
+            <p className="font-mono text-gray-100 break-all">
+              {enrollment.secret}
+            </p>
+            <input
+              type="text"
+              required
+              inputMode="numeric"
+              autoComplete="one-time-code"
+              className={inputClass}
+              placeholder="Código de 6 dígitos"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+            />
+            <button
+              type="submit"
+              disabled={isLoading}
+              className="bg-blue-600 text-white px-4 py-2 rounded-md hover:bg-blue-700 disabled:opacity-50"
+            >
+              Confirmar
+            </button>
+          </form>
+        )}
+
+        {status?.enabled && (
+          <div className="bg-gray-800 rounded-lg p-6 space-y-4">
+            <p className="text-gray-300">
+              A verificação em duas etapas está ativada. Restam{" "}
+              {status.recovery_codes_left} códigos de recuperação.
+            </p>
+            <input
+              type="text"
+              className={inputClass}
+              placeholder="Código do aplicativo ou de recuperação"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+            />
+            <div className="flex space-x-4">
+              <button
+                onClick={handleRegenerate}
+                disabled={isLoading || !code}
+                className="bg-gray-700 text-gray-200 px-4 py-2 rounded-md hover:bg-gray-600 disabled:opacity-50"
+              >
+                Gerar novos códigos
+              </button>
+              <button
+                onClick={handleDisable}
+                disabled={isLoading || !code}
+                className="bg-red-600 text-white px-4 py-2 rounded-md hover:bg-red-700 disabled:opacity-50"
+              >
+                Desativar
+              </button>
+            </div>
+          </div>
+        )}
+      </div>
+    </div>
+  );
+};
@@ -0,0 +1,56 @@
+import React, { useEffect, useState } from "react";
+import { Link, useSearchParams } from "react-router-dom";
+import { authService } from "../services/api";
+
+export const VerifyEmail: React.FC = () => {
+  const [searchParams] = useSearchParams();
+  const [status, setStatus] = useState<"loading" | "success" | "error">(
+    "loading"
+  );
+
+  useEffect(() => {
+    const token = searchParams.get("token");
+    if (!token) {
+      setStatus("error");
+      return;
+    }
+
+    // Links com change=1 confirmam a troca para um novo email
+    const confirm = searchParams.get("change")
+      ? authService.confirmEmailChange
+      : authService.verifyEmail;
+
+    confirm(token)
+      .then(() => setStatus("success"))
+      .catch(() => setStatus("error"));
+  }, [searchParams]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-900 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-6 text-center">
+        <h2 className="text-3xl font-extrabold text-gray-100">
+          Confirmação de email
+        </h2>
+        {status === "loading" && (
+          <p className="text-gray-400">Confirmando seu email...</p>
+        )}
+        {status === "success" && (
+          <div className="rounded-md bg-green-900 p-4 text-sm text-green-200">
+            Email confirmado com sucesso!
+          </div>
+        )}
+        {status === "error" && (
+          <div className="rounded-md bg-red-900 p-4 text-sm text-red-200">
+            Link de confirmação inválido ou expirado.
+          </div>
+        )}
+        <Link
+          to="/dashboard"
+          className="font-medium text-blue-600 hover:text-blue-500"
+        >
+          Ir para o painel
+        </Link>
+      </div>
+    </div>
+  );
+};
@@ -1,15 +1,27 @@
 import axios from "axios";
 import {
+  AdminStats,
+  AdminUrl,
+  AdminUrlStatus,
+  AdminUser,
   AuthResponse,
   LoginRequest,
   RegisterRequest,
   URLShortenRequest,
   URLShortenResponse,
   URLListItem,
+  Session,
+  ApiKey,
+  CreateApiKeyRequest,
+  DeleteAccountRequest,
+  TwoFactorCode,
+  TwoFactorEnrollment,
+  TwoFactorStatus,
+  UpdateProfileRequest,
   User,
 } from "../types";
 
-const API_BASE_URL = "http://localhost:8181";
+export const API_BASE_URL = "http://localhost:8181";
 
 const api = axios.create({
   baseURL: API_BASE_URL,
@@ -19,12 +31,55 @@ const api = axios.create({
   withCredentials: true, // Incluir cookies nas requisições
 });
 
+// Access tokens are short-lived: on a 401 the session is refreshed once with
+// the refresh token cookie and the request retried. Concurrent failures share
+// one refresh, since each refresh token can only be used once.
+let refreshing: Promise<void> | null = null;
+
+api.interceptors.response.use(undefined, async (error) => {
+  const request = error.config;
+  const url: string = request?.url || "";
+
+  if (
+    error.response?.status !== 401 ||
+    request._retried ||
+    url.startsWith("/auth/refresh") ||
+    url.startsWith("/auth/login") ||
+    url.startsWith("/auth/register")
+  ) {
+    return Promise.reject(error);
+  }
+
+  request._retried = true;
+  refreshing =
+    refreshing ||
+    api
+      .post("/auth/refresh")
+      .then(() => undefined)
+      .finally(() => {
+        refreshing = null;
+      });
+
+  try {
+    await refreshing;
+  } catch {
+    return Promise.reject(error);
+  }
+
+  return api(request);
+});
+
 export const authService = {
   login: async (data: LoginRequest): Promise<AuthResponse> => {
     const response = await api.post("/auth/login", data);
     return response.data;
   },
 
+  loginTwoFactor: async (data: TwoFactorCode): Promise<AuthResponse> => {
+    const response = await api.post("/auth/login/2fa", data);
+    return response.data;
+  },
+
   register: async (data: RegisterRequest): Promise<AuthResponse> => {
     const response = await api.post("/auth/register", data);
     return response.data;
@@ -38,6 +93,103 @@ export const authService = {
     const response = await api.get("/auth/me");
     return response.data;
   },
+
+  verifyEmail: async (token: string): Promise<void> => {
+    await api.post("/auth/verify-email", { token });
+  },
+
+  confirmEmailChange: async (token: string): Promise<void> => {
+    await api.post("/auth/email/confirm", { token });
+  },
+
+  updateProfile: async (
+    data: UpdateProfileRequest
+  ): Promise<{ user: User; pending_email: string }> => {
+    const response = await api.put("/auth/me", data);
+    return response.data;
+  },
+
+  // Resolves with expires_at when the account waits for a transfer of its
+  // links, and without once it is deleted.
+  deleteAccount: async (
+    data: DeleteAccountRequest
+  ): Promise<{ message: string; expires_at?: string }> => {
+    const response = await api.delete("/auth/me", { data });
+    return response.data;
+  },
+
+  resendVerification: async (): Promise<void> => {
+    await api.post("/auth/verify-email/resend");
+  },
+
+  forgotPassword: async (email: string): Promise<void> => {
+    await api.post("/auth/password/forgot", { email });
+  },
+
+  resetPassword: async (token: string, password: string): Promise<void> => {
+    await api.post("/auth/password/reset", { token, password });
+  },
+
+  changePassword: async (
+    current_password: string,
+    new_password: string
+  ): Promise<void> => {
+    await api.post("/auth/password/change", { current_password, new_password });
+  },
+
+  twoFactorStatus: async (): Promise<TwoFactorStatus> => {
+    const response = await api.get("/auth/2fa");
+    return response.data;
+  },
+
+  enrollTwoFactor: async (): Promise<TwoFactorEnrollment> => {
+    const response = await api.post("/auth/2fa/enroll");
+    return response.data;
+  },
+
+  confirmTwoFactor: async (code: string): Promise<string[]> => {
+    const response = await api.post("/auth/2fa/confirm", { code });
+    return response.data.recovery_codes;
+  },
+
+  regenerateRecoveryCodes: async (data: TwoFactorCode): Promise<string[]> => {
+    const response = await api.post("/auth/2fa/recovery-codes", data);
+    return response.data.recovery_codes;
+  },
+
+  disableTwoFactor: async (data: TwoFactorCode): Promise<void> => {
+    await api.post("/auth/2fa/disable", data);
+  },
+
+  oauthProviders: async (): Promise<string[]> => {
+    const response = await api.get("/auth/oauth");
+    return response.data.providers || [];
+  },
+
+  sessions: async (): Promise<Session[]> => {
+    const response = await api.get("/auth/sessions");
+    return response.data.sessions || [];
+  },
+
+  revokeSession: async (id: string): Promise<void> => {
+    await api.delete(`/auth/sessions/${id}`);
+  },
+
+  apiKeys: async (): Promise<ApiKey[]> => {
+    const response = await api.get("/auth/keys");
+    return response.data.api_keys || [];
+  },
+
+  createApiKey: async (
+    data: CreateApiKeyRequest
+  ): Promise<{ key: string; api_key: ApiKey }> => {
+    const response = await api.post("/auth/keys", data);
+    return response.data;
+  },
+
+  revokeApiKey: async (id: string): Promise<void> => {
+    await api.delete(`/auth/keys/${id}`);
+  },
 };
 
 export const urlService = {
@@ -57,4 +209,54 @@ export const urlService = {
   },
 };
 
+export const adminService = {
+  stats: async (): Promise<AdminStats> => {
+    const response = await api.get("/admin/stats");
+    return response.data;
+  },
+
+  users: async (
+    q: string,
+    offset: number
+  ): Promise<{ users: AdminUser[]; total: number }> => {
+    const response = await api.get("/admin/users", { params: { q, offset } });
+    return response.data;
+  },
+
+  setRole: async (id: string, role: AdminUser["role"]): Promise<void> => {
+    await api.put(`/admin/users/${id}/role`, { role });
+  },
+
+  disableUser: async (id: string): Promise<void> => {
+    await api.post(`/admin/users/${id}/disable`);
+  },
+
+  enableUser: async (id: string): Promise<void> => {
+    await api.post(`/admin/users/${id}/enable`);
+  },
+
+  urls: async (
+    q: string,
+    status: AdminUrlStatus | "",
+    offset: number
+  ): Promise<{ urls: AdminUrl[]; total: number }> => {
+    const response = await api.get("/admin/urls", {
+      params: { q, status, offset },
+    });
+    return response.data;
+  },
+
+  expireUrl: async (id: string): Promise<void> => {
+    await api.post(`/admin/urls/${id}/expire`);
+  },
+
+  takeDownUrl: async (id: string, reason: string): Promise<void> => {
+    await api.post(`/admin/urls/${id}/takedown`, { reason });
+  },
+
+  reinstateUrl: async (id: string): Promise<void> => {
+    await api.post(`/admin/urls/${id}/reinstate`);
+  },
+};
+
 export default api;
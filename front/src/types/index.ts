@@ -2,13 +2,20 @@ export interface User {
   id: string;
   email: string;
   name: string;
+  email_verified?: boolean;
+  two_factor_enabled?: boolean;
+  role?: "user" | "admin";
 }
 
 export interface AuthContextType {
   user: User | null;
-  login: (email: string, password: string) => Promise<void>;
+  // login resolves to true when a two-factor code is still required.
+  login: (email: string, password: string) => Promise<boolean>;
+  loginTwoFactor: (code: string, recovery: boolean) => Promise<void>;
   register: (name: string, email: string, password: string) => Promise<void>;
   logout: () => Promise<void>;
+  // refreshUser reloads the user after a profile change.
+  refreshUser: () => Promise<void>;
   isLoading: boolean;
 }
 
@@ -26,6 +33,23 @@ export interface RegisterRequest {
 export interface AuthResponse {
   token: string;
   user: User;
+  two_factor_required?: boolean;
+}
+
+export interface TwoFactorStatus {
+  enabled: boolean;
+  recovery_codes_left: number;
+}
+
+export interface TwoFactorEnrollment {
+  secret: string;
+  otpauth_uri: string;
+}
+
+// Either a code from the authenticator app or a recovery code.
+export interface TwoFactorCode {
+  code?: string;
+  recovery_code?: string;
 }
 
 export interface URLShortenRequest {
@@ -54,3 +78,85 @@ export interface URLListItem {
   Slug: string;
   CreatedAt: string;
 }
+
+export interface Session {
+  id: string;
+  user_agent: string;
+  ip: string;
+  created_at: string;
+  last_seen: string;
+  current: boolean;
+}
+
+export interface ApiKey {
+  id: string;
+  name: string;
+  prefix: string;
+  scopes: string[];
+  expires_at: string | null;
+  last_used_at: string | null;
+  created_at: string;
+}
+
+export interface CreateApiKeyRequest {
+  name: string;
+  scopes: string[];
+  expires_at?: string;
+}
+
+export interface UpdateProfileRequest {
+  name?: string;
+  email?: string;
+  // Só é necessária para trocar o email
+  password?: string;
+}
+
+export interface DeleteAccountRequest {
+  password: string;
+  links: "delete" | "transfer";
+  transfer_to?: string;
+}
+
+export interface AdminUser {
+  id: string;
+  name: string;
+  email: string;
+  role: "user" | "admin";
+  email_verified: boolean;
+  disabled_at: string | null;
+  created_at: string;
+}
+
+export type AdminUrlStatus = "live" | "deleted" | "expired" | "taken_down";
+
+export interface AdminUrl {
+  id: string;
+  id_user: string;
+  owner_email: string;
+  url_original: string;
+  url_shortened: string;
+  slug: string;
+  clicks: number;
+  created_at: string;
+  deleted_at: string | null;
+  expires_at: string | null;
+  taken_down_at: string | null;
+  takedown_reason: string | null;
+}
+
+export interface AdminStats {
+  users: {
+    total: number;
+    admins: number;
+    disabled: number;
+    unverified: number;
+  };
+  links: {
+    total: number;
+    live: number;
+    deleted: number;
+    expired: number;
+    taken_down: number;
+    clicks: number;
+  };
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Get when the key is not cached.
+var ErrMiss = errors.New("cache: miss")
+
+// ErrUnavailable is returned when the backing store cannot be reached.
+var ErrUnavailable = errors.New("cache: unavailable")
+
+// ErrTombstone is returned by Fill when the key holds a Tombstone.
+var ErrTombstone = errors.New("cache: tombstone")
+
+// NotFound is cached under keys known not to exist, so repeated lookups of an
+// unknown key do not reach the database.
+const NotFound = "\x00not_found"
+
+// Tombstone is written over deleted keys for a while. Get treats it as a miss,
+// and Fill does not overwrite it, so a value read from the database before the
+// delete is not written back after it.
+const Tombstone = "\x00tombstone"
+
+// Cache is the key/value cache used by the use cases. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, expiration time.Duration) error
+	// Fill is Set for values read from the source of truth: it fails with
+	// ErrTombstone instead of overwriting a Tombstone.
+	Fill(ctx context.Context, key string, value string, expiration time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Invalidator tells the other instances that keys changed so they can evict
+// them from their in-process caches.
+type Invalidator interface {
+	Publish(ctx context.Context, keys ...string) error
+}
+
+// Invalidating is a Cache whose deletes are broadcast through an Invalidator,
+// so an edit made on one instance is not served stale from the local cache of
+// another. Deleted keys are left a Tombstone for tombstoneTTL, which must
+// outlast any database read that started before the delete.
+type Invalidating struct {
+	Cache
+	invalidator  Invalidator
+	tombstoneTTL time.Duration
+}
+
+func NewInvalidating(cache Cache, invalidator Invalidator, tombstoneTTL time.Duration) *Invalidating {
+	return &Invalidating{Cache: cache, invalidator: invalidator, tombstoneTTL: tombstoneTTL}
+}
+
+func (i *Invalidating) Del(ctx context.Context, keys ...string) error {
+	err := i.Cache.Del(ctx, keys...)
+
+	for _, key := range keys {
+		if terr := i.Cache.Set(ctx, key, Tombstone, i.tombstoneTTL); terr != nil {
+			log.Printf("cache tombstone %q: %v", key, terr)
+		}
+	}
+
+	if perr := i.invalidator.Publish(ctx, keys...); perr != nil {
+		log.Printf("cache invalidation broadcast %v: %v", keys, perr)
+	}
+
+	return err
+}
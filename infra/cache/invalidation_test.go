@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type nopInvalidator struct{}
+
+func (nopInvalidator) Publish(context.Context, ...string) error { return nil }
+
+func TestDelLeavesTombstoneThatFillKeeps(t *testing.T) {
+	ctx := context.Background()
+	remote, _ := newTestRedisCache(t)
+
+	// Two instances sharing Redis, each with its own local cache.
+	editor := NewInvalidating(NewLayered(NewLRU(10, time.Minute), remote), nopInvalidator{}, time.Minute)
+	otherLocal := NewLRU(10, time.Minute)
+	other := NewInvalidating(NewLayered(otherLocal, remote), nopInvalidator{}, time.Minute)
+
+	if err := editor.Set(ctx, "slug", "https://old.example.com", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := editor.Del(ctx, "slug"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := editor.Get(ctx, "slug"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get after Del = %v; want ErrMiss", err)
+	}
+
+	// A lookup that read the old destination before the edit finishes late.
+	for name, instance := range map[string]Cache{"editor": editor, "other": other} {
+		if err := instance.Fill(ctx, "slug", "https://old.example.com", time.Minute); !errors.Is(err, ErrTombstone) {
+			t.Fatalf("%s Fill = %v; want ErrTombstone", name, err)
+		}
+	}
+
+	if _, err := otherLocal.Get(ctx, "slug"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("other local Get = %v; want the stale value kept out", err)
+	}
+}
+
+func TestFillAfterTombstoneExpires(t *testing.T) {
+	ctx := context.Background()
+	remote, server := newTestRedisCache(t)
+	local := NewLRU(10, time.Minute)
+	cache := NewInvalidating(NewLayered(local, remote), nopInvalidator{}, time.Second)
+
+	if err := cache.Del(ctx, "slug"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.FastForward(2 * time.Second)
+	local.Purge()
+
+	if err := cache.Fill(ctx, "slug", "https://new.example.com", time.Minute); err != nil {
+		t.Fatalf("Fill = %v; want the tombstone expired", err)
+	}
+
+	if value, err := cache.Get(ctx, "slug"); err != nil || value != "https://new.example.com" {
+		t.Fatalf("Get = %q, %v; want the filled value", value, err)
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Layered combines caches from fastest to slowest. Reads go through the layers
+// in order and backfill the faster ones on a hit. Sets go to every layer and
+// only fail when no layer accepted them, so a broken layer degrades the cache
+// instead of failing requests. Deletes fail when any layer failed, since that
+// layer would keep serving the old value.
+type Layered struct {
+	layers []Cache
+}
+
+func NewLayered(layers ...Cache) *Layered {
+	return &Layered{layers: layers}
+}
+
+func (l *Layered) Get(ctx context.Context, key string) (string, error) {
+	for i, layer := range l.layers {
+		value, err := layer.Get(ctx, key)
+		if err == nil && value == Tombstone {
+			return "", ErrMiss
+		} else if err == nil {
+			for _, faster := range l.layers[:i] {
+				_ = faster.Set(ctx, key, value, 0)
+			}
+			return value, nil
+		}
+
+		if !errors.Is(err, ErrMiss) && !errors.Is(err, ErrUnavailable) {
+			log.Printf("cache layer %d get %q: %v", i, key, err)
+		}
+	}
+
+	return "", ErrMiss
+}
+
+func (l *Layered) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return l.each(func(layer Cache) error {
+		return layer.Set(ctx, key, value, expiration)
+	})
+}
+
+// Fill fills the layers from slowest to fastest and stops at the first one
+// holding a Tombstone: the instance that deleted the key only tombstoned its
+// own faster layers, so those of other instances must follow the slower ones.
+func (l *Layered) Fill(ctx context.Context, key string, value string, expiration time.Duration) error {
+	var errs []error
+	for i := len(l.layers) - 1; i >= 0; i-- {
+		err := l.layers[i].Fill(ctx, key, value, expiration)
+		if errors.Is(err, ErrTombstone) {
+			return err
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return l.joinWriteErrors(errs)
+}
+
+func (l *Layered) Del(ctx context.Context, keys ...string) error {
+	var errs []error
+	for _, layer := range l.layers {
+		if err := layer.Del(ctx, keys...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *Layered) each(fn func(layer Cache) error) error {
+	var errs []error
+	for _, layer := range l.layers {
+		if err := fn(layer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return l.joinWriteErrors(errs)
+}
+
+// joinWriteErrors returns the errors of a write to every layer if all of them
+// failed, and logs them otherwise.
+func (l *Layered) joinWriteErrors(errs []error) error {
+	if len(errs) == len(l.layers) {
+		return errors.Join(errs...)
+	}
+
+	for _, err := range errs {
+		if !errors.Is(err, ErrUnavailable) {
+			log.Printf("cache layer write: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"url_shortening/infra/db/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newTestRedisCache(t *testing.T) (*RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisCache(&redis.Redis{Client: client, Timeout: time.Second}, time.Minute), server
+}
+
+func TestLayeredBackfillsFasterLayers(t *testing.T) {
+	ctx := context.Background()
+	remote, server := newTestRedisCache(t)
+	local := NewLRU(10, time.Minute)
+	layered := NewLayered(local, remote)
+
+	server.Set("slug", "https://example.com")
+
+	value, err := layered.Get(ctx, "slug")
+	if err != nil || value != "https://example.com" {
+		t.Fatalf("Get = %q, %v; want the Redis value", value, err)
+	}
+
+	server.Del("slug")
+
+	if value, err := local.Get(ctx, "slug"); err != nil || value != "https://example.com" {
+		t.Fatalf("local Get = %q, %v; want the backfilled value", value, err)
+	}
+}
+
+func TestLayeredWorksWithoutRedis(t *testing.T) {
+	ctx := context.Background()
+	remote, server := newTestRedisCache(t)
+	layered := NewLayered(NewLRU(10, time.Minute), remote)
+
+	server.Close()
+
+	if err := layered.Set(ctx, "slug", "https://example.com", time.Minute); err != nil {
+		t.Fatalf("Set = %v; want the local layer to accept it", err)
+	}
+
+	value, err := layered.Get(ctx, "slug")
+	if err != nil || value != "https://example.com" {
+		t.Fatalf("Get = %q, %v; want the local value", value, err)
+	}
+
+	if _, err := layered.Get(ctx, "other"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get of a missing key = %v; want ErrMiss", err)
+	}
+}
+
+func TestLayeredDelFailsWhenAnyLayerFails(t *testing.T) {
+	ctx := context.Background()
+	remote, server := newTestRedisCache(t)
+	local := NewLRU(10, time.Minute)
+	layered := NewLayered(local, remote)
+
+	if err := layered.Set(ctx, "slug", "https://example.com", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+
+	if err := layered.Del(ctx, "slug"); err == nil {
+		t.Fatal("Del = nil; want the Redis error, since Redis still holds the value")
+	}
+
+	if _, err := local.Get(ctx, "slug"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("local Get = %v; want the key deleted from the layers that work", err)
+	}
+}
+
+func TestRedisCacheCooldown(t *testing.T) {
+	ctx := context.Background()
+	remote, server := newTestRedisCache(t)
+
+	server.Close()
+
+	if _, err := remote.Get(ctx, "slug"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Get = %v; want ErrUnavailable", err)
+	}
+
+	// Redis is back, but the cooldown keeps requests off it.
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	server.Set("slug", "https://example.com")
+
+	if _, err := remote.Get(ctx, "slug"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Get during the cooldown = %v; want ErrUnavailable", err)
+	}
+}
+
+func TestRedisCacheErrorRepliesDoNotStartCooldown(t *testing.T) {
+	ctx := context.Background()
+	remote, server := newTestRedisCache(t)
+
+	if _, err := server.Lpush("list", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := remote.Get(ctx, "list"); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Get of a list = %v; want the WRONGTYPE reply", err)
+	}
+
+	server.Set("slug", "https://example.com")
+
+	if value, err := remote.Get(ctx, "slug"); err != nil || value != "https://example.com" {
+		t.Fatalf("Get = %q, %v; want Redis to still be used", value, err)
+	}
+}
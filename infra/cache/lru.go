@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process cache holding at most capacity entries. Entries never
+// live longer than maxTTL, whatever expiration the caller asks for, which
+// bounds how stale a value can be when another instance changes it.
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	maxTTL   time.Duration
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+func NewLRU(capacity int, maxTTL time.Duration) *LRU {
+	return &LRU{
+		capacity: capacity,
+		maxTTL:   maxTTL,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (l *LRU) Get(_ context.Context, key string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.items[key]
+	if !ok {
+		return "", ErrMiss
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		l.remove(element)
+		return "", ErrMiss
+	}
+
+	l.order.MoveToFront(element)
+	return entry.value, nil
+}
+
+func (l *LRU) Set(_ context.Context, key string, value string, expiration time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.set(key, value, expiration)
+	return nil
+}
+
+func (l *LRU) Fill(_ context.Context, key string, value string, expiration time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if element, ok := l.items[key]; ok {
+		entry := element.Value.(*lruEntry)
+		if entry.value == Tombstone && time.Now().Before(entry.expiresAt) {
+			return ErrTombstone
+		}
+	}
+
+	l.set(key, value, expiration)
+	return nil
+}
+
+// set stores value under key; l.mu must be held.
+func (l *LRU) set(key string, value string, expiration time.Duration) {
+	if expiration <= 0 || expiration > l.maxTTL {
+		expiration = l.maxTTL
+	}
+
+	expiresAt := time.Now().Add(expiration)
+
+	if element, ok := l.items[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		l.order.MoveToFront(element)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for l.order.Len() > l.capacity {
+		l.remove(l.order.Back())
+	}
+}
+
+func (l *LRU) Del(_ context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := l.items[key]; ok {
+			l.remove(element)
+		}
+	}
+
+	return nil
+}
+
+func (l *LRU) remove(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.items, element.Value.(*lruEntry).key)
+}
+
+// Purge drops every entry.
+func (l *LRU) Purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = make(map[string]*list.Element, l.capacity)
+	l.order.Init()
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+	"url_shortening/infra/db/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// RedisCache adapts redis.Redis to Cache. After a connection error it reports
+// ErrUnavailable for cooldown without touching the network, so requests are
+// not slowed down by dial timeouts while Redis is down.
+type RedisCache struct {
+	redis     *redis.Redis
+	cooldown  time.Duration
+	downUntil atomic.Int64
+}
+
+func NewRedisCache(redis *redis.Redis, cooldown time.Duration) *RedisCache {
+	return &RedisCache{redis: redis, cooldown: cooldown}
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	if r.isDown() {
+		return "", ErrUnavailable
+	}
+
+	value, err := r.redis.Get(ctx, key)
+	if errors.Is(err, goredis.Nil) {
+		return "", ErrMiss
+	} else if err != nil {
+		return "", r.markDown(ctx, err)
+	}
+
+	return value, nil
+}
+
+func (r *RedisCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	if r.isDown() {
+		return ErrUnavailable
+	}
+
+	if err := r.redis.Set(ctx, key, value, expiration); err != nil {
+		return r.markDown(ctx, err)
+	}
+
+	return nil
+}
+
+// fillScript sets KEYS[1] to ARGV[1], expiring after ARGV[3] milliseconds
+// if positive, unless it holds the tombstone ARGV[2]. Checking and setting in
+// one script keeps a delete from landing in between.
+var fillScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[2] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+func (r *RedisCache) Fill(ctx context.Context, key string, value string, expiration time.Duration) error {
+	if r.isDown() {
+		return ErrUnavailable
+	}
+
+	redisCtx, cancel := r.redis.WithTimeout(ctx)
+	defer cancel()
+
+	filled, err := fillScript.Run(redisCtx, r.redis.Client, []string{key}, value, Tombstone, expiration.Milliseconds()).Int()
+	if err != nil {
+		return r.markDown(ctx, err)
+	} else if filled == 0 {
+		return ErrTombstone
+	}
+
+	return nil
+}
+
+func (r *RedisCache) Del(ctx context.Context, keys ...string) error {
+	if r.isDown() {
+		return ErrUnavailable
+	}
+
+	if err := r.redis.Del(ctx, keys...); err != nil {
+		return r.markDown(ctx, err)
+	}
+
+	return nil
+}
+
+func (r *RedisCache) isDown() bool {
+	return time.Now().UnixNano() < r.downUntil.Load()
+}
+
+// markDown starts the cooldown after Redis could not be reached in time.
+// Errors caused by the caller's context, such as a cancelled request, and
+// errors answered by Redis itself, such as WRONGTYPE, do not count.
+func (r *RedisCache) markDown(ctx context.Context, err error) error {
+	if ctx.Err() != nil || !connectionError(err) {
+		return err
+	}
+
+	if !r.isDown() {
+		log.Printf("redis cache unavailable for %s: %v", r.cooldown, err)
+	}
+	r.downUntil.Store(time.Now().Add(r.cooldown).UnixNano())
+	return errors.Join(ErrUnavailable, err)
+}
+
+// connectionError reports whether err means Redis was unreachable or did not
+// answer within the timeout, as opposed to an error reply.
+func connectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, goredis.ErrPoolTimeout) ||
+		errors.Is(err, goredis.ErrClosed)
+}
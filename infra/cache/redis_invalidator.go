@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+	"url_shortening/infra/db/redis"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const invalidationChannel = "url_shortening:cache:invalidate"
+
+type invalidationMessage struct {
+	Origin  string   `json:"origin"`
+	Keys    []string `json:"keys,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	// Written are keys changed in the database that are not cached, like
+	// the user:<id> keys of link lists. They only keep reads off replicas.
+	Written []string `json:"written,omitempty"`
+}
+
+// RedisInvalidator broadcasts invalidations and slug changes over Redis
+// pub/sub and applies the ones received from other instances to the local
+// cache and slug filter.
+type RedisInvalidator struct {
+	redis  *redis.Redis
+	local  *LRU
+	slugs  *SlugFilter
+	origin string
+
+	onInvalidate func(keys ...string)
+}
+
+func NewRedisInvalidator(redis *redis.Redis, local *LRU, slugs *SlugFilter) *RedisInvalidator {
+	return &RedisInvalidator{redis: redis, local: local, slugs: slugs, origin: uuid.NewString()}
+}
+
+// OnInvalidate registers fn to be called with the keys invalidated, added or
+// written by other instances, e.g. to keep reads of them off lagging read replicas.
+// It must be called before Listen.
+func (r *RedisInvalidator) OnInvalidate(fn func(keys ...string)) {
+	r.onInvalidate = fn
+}
+
+func (r *RedisInvalidator) Publish(ctx context.Context, keys ...string) error {
+	return r.publish(ctx, invalidationMessage{Keys: keys})
+}
+
+func (r *RedisInvalidator) PublishSlugs(ctx context.Context, added []string, removed []string) error {
+	return r.publish(ctx, invalidationMessage{Added: added, Removed: removed})
+}
+
+// PublishWritten tells the other instances that keys changed in the database,
+// so their reads of them stay on the primary until the replicas catch up.
+func (r *RedisInvalidator) PublishWritten(ctx context.Context, keys ...string) error {
+	return r.publish(ctx, invalidationMessage{Written: keys})
+}
+
+func (r *RedisInvalidator) publish(ctx context.Context, message invalidationMessage) error {
+	message.Origin = r.origin
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := r.redis.WithTimeout(ctx)
+	defer cancel()
+
+	return r.redis.Client.Publish(ctx, invalidationChannel, payload).Err()
+}
+
+// Listen applies invalidations until ctx is done. Messages published while the
+// subscription was down are lost, so the whole local cache is purged and the
+// slug filter rebuilt every time the subscription is re-established.
+func (r *RedisInvalidator) Listen(ctx context.Context) {
+	pubsub := r.redis.Client.Subscribe(ctx, invalidationChannel)
+	defer pubsub.Close()
+
+	subscribed := false
+
+	for {
+		received, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// go-redis reconnects and re-subscribes on the next Receive.
+			time.Sleep(time.Second)
+			continue
+		}
+
+		switch msg := received.(type) {
+		case *goredis.Subscription:
+			if subscribed {
+				log.Printf("cache invalidation resubscribed, purging local cache")
+				r.local.Purge()
+				go func() {
+					if err := r.slugs.Rebuild(); err != nil {
+						log.Printf("slug filter rebuild: %v", err)
+					}
+				}()
+			}
+			subscribed = true
+		case *goredis.Message:
+			var message invalidationMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
+				log.Printf("cache invalidation: invalid message: %v", err)
+				continue
+			}
+
+			if message.Origin != r.origin {
+				r.local.Del(ctx, message.Keys...)
+				r.slugs.Add(message.Added...)
+				r.slugs.Remove(message.Removed...)
+
+				if r.onInvalidate != nil {
+					keys := make([]string, 0, len(message.Keys)+len(message.Added)+len(message.Written))
+					keys = append(keys, message.Keys...)
+					keys = append(keys, message.Added...)
+					r.onInvalidate(append(keys, message.Written...)...)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+	"url_shortening/infra/db/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func TestRedisInvalidatorBroadcastsWrittenKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, server := newTestRedisCache(t)
+	newInvalidator := func() *RedisInvalidator {
+		client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+
+		slugs := NewSlugFilter(10, func(since time.Time, add func(slug string)) error { return nil })
+		return NewRedisInvalidator(&redis.Redis{Client: client, Timeout: time.Second}, NewLRU(10, time.Minute), slugs)
+	}
+
+	writer := newInvalidator()
+	reader := newInvalidator()
+
+	received := make(chan []string, 10)
+	reader.OnInvalidate(func(keys ...string) { received <- keys })
+	go reader.Listen(ctx)
+
+	// Messages published before the reader subscribed are lost, so publish
+	// until one arrives.
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := writer.PublishWritten(ctx, "user:1"); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case keys := <-received:
+			if !slices.Equal(keys, []string{"user:1"}) {
+				t.Fatalf("OnInvalidate got %v; want the written key", keys)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("written key never reached the other instance")
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+	"url_shortening/pkg/bloomPkg"
+)
+
+const slugFilterFalsePositiveRate = 0.01
+
+// SlugLoader calls add for every slug that currently exists, or, when since
+// is not zero, at least for those created or restored since.
+type SlugLoader func(since time.Time, add func(slug string)) error
+
+// SlugFilter is an in-memory Bloom filter of existing slugs. Until the first
+// build completes every slug may exist, so nothing is rejected by mistake.
+type SlugFilter struct {
+	mu         sync.RWMutex
+	filter     *bloomPkg.CountingFilter
+	capacity   int
+	load       SlugLoader
+	rebuilding bool
+	pending    []slugChange
+}
+
+type slugChange struct {
+	slug  string
+	added bool
+}
+
+func NewSlugFilter(capacity int, load SlugLoader) *SlugFilter {
+	return &SlugFilter{capacity: capacity, load: load}
+}
+
+// MayExist reports whether slug may exist. False means it does not, or that
+// it was created on another instance moments ago and its broadcast was lost,
+// until the next Sync.
+func (f *SlugFilter) MayExist(slug string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.filter == nil || f.filter.Test(slug)
+}
+
+func (f *SlugFilter) Add(slugs ...string) {
+	f.apply(slugs, true)
+}
+
+func (f *SlugFilter) Remove(slugs ...string) {
+	f.apply(slugs, false)
+}
+
+func (f *SlugFilter) apply(slugs []string, added bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, slug := range slugs {
+		if f.rebuilding {
+			f.pending = append(f.pending, slugChange{slug: slug, added: added})
+		}
+
+		if f.filter == nil {
+			continue
+		} else if added {
+			f.filter.Add(slug)
+		} else {
+			f.filter.Remove(slug)
+		}
+	}
+}
+
+// Rebuild loads every slug into a new filter and swaps it in. Changes made
+// while loading are replayed on the new filter so none is lost.
+func (f *SlugFilter) Rebuild() error {
+	f.mu.Lock()
+	if f.rebuilding {
+		f.mu.Unlock()
+		return nil
+	}
+	f.rebuilding = true
+	f.pending = nil
+	f.mu.Unlock()
+
+	var slugs []string
+	err := f.load(time.Time{}, func(slug string) {
+		slugs = append(slugs, slug)
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rebuilding = false
+	if err != nil {
+		f.pending = nil
+		return err
+	}
+
+	filter := bloomPkg.NewCounting(max(f.capacity, 2*len(slugs)), slugFilterFalsePositiveRate)
+	for _, slug := range slugs {
+		filter.Add(slug)
+	}
+
+	for _, change := range f.pending {
+		if change.added {
+			filter.Add(change.slug)
+		} else {
+			filter.Remove(change.slug)
+		}
+	}
+	f.pending = nil
+
+	f.filter = filter
+	log.Printf("slug filter rebuilt with %d slugs", len(slugs))
+
+	return nil
+}
+
+// Sync adds the slugs created or restored since that the filter has not
+// seen, in case their broadcast was lost. Slugs it already has are not added
+// again, so a later Remove still takes them out. It does nothing before the
+// first build or during a rebuild, which loads every slug anyway.
+func (f *SlugFilter) Sync(since time.Time) error {
+	f.mu.RLock()
+	ready := f.filter != nil && !f.rebuilding
+	f.mu.RUnlock()
+	if !ready {
+		return nil
+	}
+
+	var slugs []string
+	err := f.load(since, func(slug string) {
+		slugs = append(slugs, slug)
+	})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.rebuilding {
+		return nil
+	}
+
+	missed := 0
+	for _, slug := range slugs {
+		if !f.filter.Test(slug) {
+			f.filter.Add(slug)
+			missed++
+		}
+	}
+	if missed > 0 {
+		log.Printf("slug filter sync added %d slugs missed by broadcasts", missed)
+	}
+
+	return nil
+}
+
+// SlugBroadcaster tells the other instances about created and deleted slugs.
+type SlugBroadcaster interface {
+	PublishSlugs(ctx context.Context, added []string, removed []string) error
+}
+
+// Slugs keeps the SlugFilter of every instance up to date.
+type Slugs struct {
+	*SlugFilter
+	broadcaster SlugBroadcaster
+}
+
+func NewSlugs(filter *SlugFilter, broadcaster SlugBroadcaster) *Slugs {
+	return &Slugs{SlugFilter: filter, broadcaster: broadcaster}
+}
+
+func (s *Slugs) Created(ctx context.Context, slugs ...string) {
+	s.Add(slugs...)
+	if err := s.broadcaster.PublishSlugs(ctx, slugs, nil); err != nil {
+		log.Printf("slug filter broadcast %v: %v", slugs, err)
+	}
+}
+
+func (s *Slugs) Deleted(ctx context.Context, slugs ...string) {
+	s.Remove(slugs...)
+	if err := s.broadcaster.PublishSlugs(ctx, nil, slugs); err != nil {
+		log.Printf("slug filter broadcast %v: %v", slugs, err)
+	}
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlugFilterBeforeFirstBuild(t *testing.T) {
+	filter := NewSlugFilter(10, func(since time.Time, add func(slug string)) error { return nil })
+
+	if !filter.MayExist("slug") {
+		t.Fatal("MayExist = false before the first build; want every slug let through")
+	}
+}
+
+func TestSlugFilterRebuild(t *testing.T) {
+	slugs := []string{"a", "b"}
+	var filter *SlugFilter
+	filter = NewSlugFilter(10, func(since time.Time, add func(slug string)) error {
+		for _, slug := range slugs {
+			add(slug)
+		}
+		// Changes made while loading are replayed on the new filter.
+		filter.Add("during")
+		filter.Remove("b")
+		return nil
+	})
+
+	if err := filter.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+
+	for slug, want := range map[string]bool{"a": true, "b": false, "during": true, "unknown": false} {
+		if got := filter.MayExist(slug); got != want {
+			t.Fatalf("MayExist(%q) = %v; want %v", slug, got, want)
+		}
+	}
+
+	filter.Add("new")
+	filter.Remove("a")
+	if !filter.MayExist("new") || filter.MayExist("a") {
+		t.Fatal("Add and Remove after the build were not applied")
+	}
+}
+
+func TestSlugFilterSyncAddsMissedSlugs(t *testing.T) {
+	var stored []string
+	var sinces []time.Time
+	filter := NewSlugFilter(10, func(since time.Time, add func(slug string)) error {
+		sinces = append(sinces, since)
+		for _, slug := range stored {
+			add(slug)
+		}
+		return nil
+	})
+
+	stored = []string{"old"}
+	if err := filter.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+
+	// "missed" was created on another instance and its broadcast was lost.
+	stored = []string{"old", "missed"}
+	if filter.MayExist("missed") {
+		t.Fatal("MayExist(missed) = true before the sync")
+	}
+
+	since := time.Now().Add(-time.Minute)
+	if err := filter.Sync(since); err != nil {
+		t.Fatal(err)
+	}
+	if !sinces[len(sinces)-1].Equal(since) {
+		t.Fatalf("Sync loaded since %v; want %v", sinces[len(sinces)-1], since)
+	}
+	if !filter.MayExist("missed") {
+		t.Fatal("MayExist(missed) = false after the sync")
+	}
+
+	// Slugs the filter had were not added twice, so one delete removes them.
+	filter.Remove("old")
+	if filter.MayExist("old") {
+		t.Fatal("MayExist(old) = true after its delete; the sync added it again")
+	}
+}
@@ -0,0 +1,253 @@
+package clicks
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"strconv"
+	"time"
+	"url_shortening/infra/db/redis"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Every key shares the {clicks} hash tag so the scripts below only ever touch
+// a single slot, which keeps them valid on Redis Cluster.
+const (
+	totalPrefix = "{clicks}:total:"
+	dayPrefix   = "{clicks}:day:"
+	daysKey     = "{clicks}:days"
+	batchPrefix = "{clicks}:batch:"
+	batchesKey  = "{clicks}:batches"
+	lockKey     = "{clicks}:flush:lock"
+	dayLayout   = "2006-01-02"
+)
+
+// claimScript moves every per-day bucket into a new batch in one step, so
+// clicks recorded while a flush runs land in fresh buckets.
+var claimScript = goredis.NewScript(`
+local days = redis.call('SMEMBERS', KEYS[1])
+if #days == 0 then
+  return 0
+end
+local batch = '{clicks}:batch:' .. ARGV[1]
+for _, day in ipairs(days) do
+  local bucket = '{clicks}:day:' .. day
+  if redis.call('EXISTS', bucket) == 1 then
+    redis.call('RENAME', bucket, batch .. ':' .. day)
+    redis.call('SADD', batch, day)
+  end
+end
+redis.call('DEL', KEYS[1])
+redis.call('SADD', KEYS[2], ARGV[1])
+return 1
+`)
+
+// cleanupScript drops a batch once it is in Postgres and removes its clicks
+// from the pending totals. Running it twice is harmless.
+var cleanupScript = goredis.NewScript(`
+local batch = '{clicks}:batch:' .. ARGV[1]
+for _, day in ipairs(redis.call('SMEMBERS', batch)) do
+  local bucket = batch .. ':' .. day
+  local counts = redis.call('HGETALL', bucket)
+  for i = 1, #counts, 2 do
+    local total = '{clicks}:total:' .. counts[i]
+    if redis.call('DECRBY', total, counts[i + 1]) <= 0 then
+      redis.call('DEL', total)
+    end
+  end
+  redis.call('DEL', bucket)
+end
+redis.call('DEL', batch)
+redis.call('SREM', KEYS[1], ARGV[1])
+return 1
+`)
+
+var unlockScript = goredis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Writer adds the clicks of a batch, keyed by day and slug, to the database.
+// It must apply each batch at most once: a batch is retried with the same id
+// when an instance stops between writing it and cleaning it up.
+type Writer func(ctx context.Context, batch string, clicks map[string]map[string]int64) error
+
+// maxRecordBatch is the most queued clicks recorded in one round trip.
+const maxRecordBatch = 500
+
+var droppedClicks = expvar.NewInt("clicks_dropped")
+
+// Counter counts redirects in Redis and periodically moves the counts to the
+// database. Until a click is flushed it is only visible through Pending.
+type Counter struct {
+	redis   *redis.Redis
+	write   Writer
+	lockTTL time.Duration
+	queue   chan string
+}
+
+// NewCounter returns a Counter queueing up to queueSize clicks for Run.
+func NewCounter(redis *redis.Redis, write Writer, lockTTL time.Duration, queueSize int) *Counter {
+	return &Counter{redis: redis, write: write, lockTTL: lockTTL, queue: make(chan string, queueSize)}
+}
+
+// Add queues a redirect to slug for Run to record, without blocking. While
+// Redis is slow or down the queue fills up, and further clicks are dropped
+// and counted in clicks_dropped rather than piling up.
+func (c *Counter) Add(slug string) {
+	select {
+	case c.queue <- slug:
+	default:
+		droppedClicks.Add(1)
+	}
+}
+
+// Run records the queued clicks until ctx is done, all those waiting in one
+// round trip.
+func (c *Counter) Run(ctx context.Context) {
+	batch := make([]string, 0, maxRecordBatch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case slug := <-c.queue:
+			batch = append(batch[:0], slug)
+		}
+
+	drain:
+		for len(batch) < maxRecordBatch {
+			select {
+			case slug := <-c.queue:
+				batch = append(batch, slug)
+			default:
+				break drain
+			}
+		}
+
+		if err := c.Record(ctx, batch...); err != nil {
+			log.Printf("failed to record %d clicks: %v", len(batch), err)
+		}
+	}
+}
+
+// Record counts one redirect to each of slugs.
+func (c *Counter) Record(ctx context.Context, slugs ...string) error {
+	ctx, cancel := c.redis.WithTimeout(ctx)
+	defer cancel()
+
+	day := time.Now().UTC().Format(dayLayout)
+	_, err := c.redis.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, slug := range slugs {
+			pipe.Incr(ctx, totalPrefix+slug)
+			pipe.HIncrBy(ctx, dayPrefix+day, slug, 1)
+		}
+		pipe.SAdd(ctx, daysKey, day)
+		return nil
+	})
+	return err
+}
+
+// Pending returns the clicks of each slug that are not in the database yet.
+func (c *Counter) Pending(ctx context.Context, slugs []string) (map[string]int64, error) {
+	pending := make(map[string]int64, len(slugs))
+	if len(slugs) == 0 {
+		return pending, nil
+	}
+
+	ctx, cancel := c.redis.WithTimeout(ctx)
+	defer cancel()
+
+	keys := make([]string, len(slugs))
+	for i, slug := range slugs {
+		keys[i] = totalPrefix + slug
+	}
+
+	values, err := c.redis.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return pending, err
+	}
+
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+				pending[slugs[i]] = n
+			}
+		}
+	}
+
+	return pending, nil
+}
+
+// Flush writes every pending click to the database. Only one instance flushes
+// at a time; batches left behind by an instance that stopped mid-flush are
+// finished first.
+func (c *Counter) Flush(ctx context.Context) error {
+	token := uuid.NewString()
+	locked, err := c.redis.Client.SetNX(ctx, lockKey, token, c.lockTTL).Result()
+	if err != nil || !locked {
+		return err
+	}
+	defer func() {
+		if err := unlockScript.Run(context.WithoutCancel(ctx), c.redis.Client, []string{lockKey}, token).Err(); err != nil {
+			log.Printf("click flush unlock: %v", err)
+		}
+	}()
+
+	batches, err := c.redis.Client.SMembers(ctx, batchesKey).Result()
+	if err != nil {
+		return err
+	}
+
+	batch := uuid.NewString()
+	claimed, err := claimScript.Run(ctx, c.redis.Client, []string{daysKey, batchesKey}, batch).Int()
+	if err != nil {
+		return err
+	} else if claimed == 1 {
+		batches = append(batches, batch)
+	}
+
+	for _, batch := range batches {
+		if err := c.flushBatch(ctx, batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Counter) flushBatch(ctx context.Context, batch string) error {
+	days, err := c.redis.Client.SMembers(ctx, batchPrefix+batch).Result()
+	if err != nil {
+		return err
+	}
+
+	clicks := make(map[string]map[string]int64, len(days))
+	for _, day := range days {
+		counts, err := c.redis.Client.HGetAll(ctx, batchPrefix+batch+":"+day).Result()
+		if err != nil {
+			return err
+		}
+
+		clicks[day] = make(map[string]int64, len(counts))
+		for slug, count := range counts {
+			n, err := strconv.ParseInt(count, 10, 64)
+			if err != nil {
+				return err
+			}
+			clicks[day][slug] = n
+		}
+	}
+
+	if len(clicks) > 0 {
+		if err := c.write(ctx, batch, clicks); err != nil {
+			return err
+		}
+	}
+
+	return cleanupScript.Run(ctx, c.redis.Client, []string{batchesKey}, batch).Err()
+}
@@ -0,0 +1,166 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/redis"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/internal/domain/repository/user_repo"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// newTestStore opens a SQLite store with one user owning one link.
+func newTestStore(t *testing.T) (*store.Store, string, urlShortening_repo.UrlOriginal) {
+	t.Helper()
+
+	config := &environment.Config{}
+	config.URL_SHORTENED_PREFIX = "http://short.test"
+	config.DB.Driver = environment.DBDriverSQLite
+	config.DB.DataSource = filepath.Join(t.TempDir(), "test.db")
+	config.DB.AutoMigrate = true
+	config.DB.Timeout = 5 * time.Second
+
+	s, err := store.NewStore(config)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	ctx := context.Background()
+	idUser, _, err := s.Users.RegisterUser(ctx, &user_repo.User{Name: "Ada", Email: "ada@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	url := "https://example.com/a"
+	registered, err := s.Urls.RegisterUrl(ctx, &url, url, urlShortening_repo.Actor{IdUser: idUser})
+	if err != nil {
+		t.Fatalf("RegisterUrl: %v", err)
+	}
+
+	return s, idUser, registered
+}
+
+func newTestRedis(t *testing.T) (*redis.Redis, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	return &redis.Redis{Client: client, Timeout: time.Second}, server
+}
+
+// wantClicks checks the flushed total and daily clicks of the link.
+func wantClicks(t *testing.T, s *store.Store, idUser string, registered urlShortening_repo.UrlOriginal, want int64) {
+	t.Helper()
+
+	ctx := context.Background()
+	urls, err := s.Urls.GetUserUrls(ctx, idUser, false)
+	if err != nil || len(urls) != 1 || urls[0].Clicks != want {
+		t.Fatalf("GetUserUrls = %+v, %v; want %d clicks", urls, err, want)
+	}
+
+	daily, err := s.Urls.GetUrlClicks(ctx, registered.ID, idUser)
+	if err != nil || len(daily) != 1 || daily[0].Clicks != want {
+		t.Fatalf("GetUrlClicks = %+v, %v; want %d clicks today", daily, err, want)
+	}
+}
+
+func TestFlushRetriedBatchCountsOnce(t *testing.T) {
+	ctx := context.Background()
+	s, idUser, registered := newTestStore(t)
+	r, _ := newTestRedis(t)
+
+	// The first write lands in the database but the flush stops before the
+	// batch is cleaned up, as when an instance is killed mid-flush.
+	var batches []string
+	write := func(ctx context.Context, batch string, clicks map[string]map[string]int64) error {
+		batches = append(batches, batch)
+		if err := s.Urls.AddClicks(ctx, batch, clicks); err != nil {
+			return err
+		}
+		if len(batches) == 1 {
+			return errors.New("stopped before the cleanup")
+		}
+		return nil
+	}
+	c := NewCounter(r, write, time.Minute, 10)
+
+	for range 3 {
+		if err := c.Record(ctx, registered.Slug); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := c.Flush(ctx); err == nil {
+		t.Fatal("Flush = nil; want the write error")
+	}
+	wantClicks(t, s, idUser, registered, 3)
+
+	// Still pending in Redis, so it is shown once the retry cleans it up.
+	pending, err := c.Pending(ctx, []string{registered.Slug})
+	if err != nil || pending[registered.Slug] != 3 {
+		t.Fatalf("Pending = %v, %v; want 3 until the batch is cleaned up", pending, err)
+	}
+
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(batches) != 2 || batches[0] != batches[1] {
+		t.Fatalf("written batches = %v; want the same batch retried", batches)
+	}
+	wantClicks(t, s, idUser, registered, 3)
+
+	pending, err = c.Pending(ctx, []string{registered.Slug})
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("Pending = %v, %v; want nothing after the flush", pending, err)
+	}
+
+	// Later clicks go in a new batch and are counted.
+	if err := c.Record(ctx, registered.Slug); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	wantClicks(t, s, idUser, registered, 4)
+}
+
+func TestFlushSkipsWhileLocked(t *testing.T) {
+	ctx := context.Background()
+	s, idUser, registered := newTestStore(t)
+	r, server := newTestRedis(t)
+
+	c := NewCounter(r, s.Urls.AddClicks, time.Minute, 10)
+	if err := c.Record(ctx, registered.Slug); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	// Another instance is flushing.
+	server.Set(lockKey, "other")
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if days, err := server.SMembers(daysKey); err != nil || len(days) != 1 {
+		t.Fatalf("days = %v, %v; want the clicks left unclaimed", days, err)
+	}
+
+	// The lock of the other instance is not released by this one.
+	if value, err := server.Get(lockKey); err != nil || value != "other" {
+		t.Fatalf("lock = %q, %v; want it kept", value, err)
+	}
+
+	server.Del(lockKey)
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	wantClicks(t, s, idUser, registered, 1)
+	if server.Exists(lockKey) {
+		t.Fatal("lock left behind after the flush")
+	}
+}
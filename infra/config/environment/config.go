@@ -1,24 +1,140 @@
 package environment
 
 import (
+	"strconv"
+	"strings"
+	"time"
 	"url_shortening/pkg/env"
 	"url_shortening/pkg/projectError"
 )
 
+const (
+	DBDriverPostgres = "postgres"
+	DBDriverSQLite   = "sqlite"
+	DBDriverMemory   = "memory"
+)
+
+const (
+	MailDriverSMTP = "smtp"
+	MailDriverLog  = "log"
+	MailDriverFile = "file"
+)
+
+const (
+	OAuthKindOIDC   = "oidc"
+	OAuthKindGitHub = "github"
+)
+
+// OAuthProvider is an external identity provider users can sign in with.
+// Issuer is only used by OIDC providers, which are discovered from it.
+type OAuthProvider struct {
+	Name         string
+	Kind         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
 type Config struct {
 	HTTP struct {
-		Url  string
-		Port int
+		Url       string
+		Port      int
+		BodyLimit int
 	}
 	DB struct {
-		DataSource string
+		Driver               string
+		DataSource           string
+		Timeout              time.Duration
+		AutoMigrate          bool
+		ReplicaDataSources   []string
+		ReplicaCheckInterval time.Duration
+		ReplicaMaxLag        time.Duration
 	}
 	URL_SHORTENED_PREFIX string
 	REDIS                struct {
-		Address string
+		Address               string
+		Timeout               time.Duration
+		Mode                  string
+		Addresses             []string
+		MasterName            string
+		Username              string
+		Password              string
+		SentinelPassword      string
+		DB                    int
+		TLS                   bool
+		TLSCAFile             string
+		TLSInsecureSkipVerify bool
+		PoolSize              int
+		MinIdleConns          int
+		PoolTimeout           time.Duration
+		MaxRetries            int
+		DialTimeout           time.Duration
+		ReadTimeout           time.Duration
+		WriteTimeout          time.Duration
 	}
-	JWT_SECRET   string
-	FRONTEND_URL string
+	CACHE struct {
+		TTL                       time.Duration
+		LocalSize                 int
+		LocalTTL                  time.Duration
+		RedisCooldown             time.Duration
+		NegativeTTL               time.Duration
+		SlugFilterCapacity        int
+		SlugFilterRebuildInterval time.Duration
+		SlugFilterSyncInterval    time.Duration
+	}
+	CLICKS struct {
+		FlushInterval     time.Duration
+		FlushTimeout      time.Duration
+		QueueSize         int
+		RetentionMonths   int
+		RetentionPlans    map[string]int
+		RetentionArchive  bool
+		RetentionInterval time.Duration
+		PartitionsAhead   int
+	}
+	AUTH struct {
+		AccessTokenTTL       time.Duration
+		RefreshTokenTTL      time.Duration
+		RequireVerifiedEmail bool
+		VerificationTTL      time.Duration
+		PasswordResetTTL     time.Duration
+		TOTPIssuer           string
+		DeletionTransferTTL  time.Duration
+	}
+	LOCKOUT struct {
+		AccountThreshold int
+		IPThreshold      int
+		Window           time.Duration
+		Duration         time.Duration
+		DelayAfter       int
+		MaxDelay         time.Duration
+	}
+	MAIL struct {
+		Driver       string
+		From         string
+		SMTPHost     string
+		SMTPPort     int
+		SMTPUsername string
+		SMTPPassword string
+		SMTPTLS      bool
+		OutboxDir    string
+	}
+	OAUTH struct {
+		CallbackUrl string
+		StateTTL    time.Duration
+		Providers   []OAuthProvider
+	}
+	JWT_SECRET                string
+	FRONTEND_URL              string
+	URL_STRIP_TRACKING_PARAMS bool
+	MAX_URL_LENGTH            int
 }
 
 func NewConfig() (*Config, error) {
@@ -33,7 +149,45 @@ func NewConfig() (*Config, error) {
 		return nil, err
 	}
 
-	dbDataSource, err := getString("DB_DATA_SOURCE", "Error loading DB Data Source")
+	httpBodyLimit, err := getIntOrDefault("HTTP_BODY_LIMIT", 64*1024, "Error loading HTTP Body Limit")
+	if err != nil {
+		return nil, err
+	}
+
+	// DB_DRIVER picks the storage backend. DB_DATA_SOURCE is a connection
+	// url for postgres, a file path for sqlite and unused for memory.
+	dbDriver := env.GetEnvOrDefault("DB_DRIVER", DBDriverPostgres)
+	if dbDriver != DBDriverPostgres && dbDriver != DBDriverSQLite && dbDriver != DBDriverMemory {
+		return nil, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: "Error loading DB Driver",
+		}
+	}
+
+	dbDataSource := env.GetEnvOrDefault("DB_DATA_SOURCE", "")
+	if dbDriver != DBDriverMemory && dbDataSource == "" {
+		return nil, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: "Error loading DB Data Source",
+		}
+	}
+
+	dbTimeout, err := getDurationOrDefault("DB_TIMEOUT", 3*time.Second, "Error loading DB Timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	dbAutoMigrate, err := getBoolOrDefault("DB_AUTO_MIGRATE", false, "Error loading DB Auto Migrate")
+	if err != nil {
+		return nil, err
+	}
+
+	dbReplicaCheckInterval, err := getDurationOrDefault("DB_REPLICA_CHECK_INTERVAL", 5*time.Second, "Error loading DB Replica Check Interval")
+	if err != nil {
+		return nil, err
+	}
+
+	dbReplicaMaxLag, err := getDurationOrDefault("DB_REPLICA_MAX_LAG", 2*time.Second, "Error loading DB Replica Max Lag")
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +197,274 @@ func NewConfig() (*Config, error) {
 		return nil, err
 	}
 
-	redisAddress, err := getString("REDIS_ADDRESS", "Error loading Redis Address")
+	// REDIS_MODE picks a single node (REDIS_ADDRESS, a redis:// or rediss://
+	// url), Sentinel failover or Cluster (REDIS_ADDRESSES, comma-separated).
+	redisMode := env.GetEnvOrDefault("REDIS_MODE", RedisModeSingle)
+	if redisMode != RedisModeSingle && redisMode != RedisModeSentinel && redisMode != RedisModeCluster {
+		return nil, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: "Error loading Redis Mode",
+		}
+	}
+
+	redisAddress := env.GetEnvOrDefault("REDIS_ADDRESS", "")
+	if redisMode == RedisModeSingle && redisAddress == "" {
+		return nil, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: "Error loading Redis Address",
+		}
+	}
+
+	redisAddresses := getList("REDIS_ADDRESSES")
+	if redisMode != RedisModeSingle && len(redisAddresses) == 0 {
+		return nil, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: "Error loading Redis Addresses",
+		}
+	}
+
+	redisMasterName := env.GetEnvOrDefault("REDIS_MASTER_NAME", "")
+	if redisMode == RedisModeSentinel && redisMasterName == "" {
+		return nil, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: "Error loading Redis Master Name",
+		}
+	}
+
+	redisDB, err := getIntOrDefault("REDIS_DB", 0, "Error loading Redis DB")
+	if err != nil {
+		return nil, err
+	}
+
+	redisTLS, err := getBoolOrDefault("REDIS_TLS", false, "Error loading Redis TLS")
+	if err != nil {
+		return nil, err
+	}
+
+	redisTLSInsecureSkipVerify, err := getBoolOrDefault("REDIS_TLS_INSECURE_SKIP_VERIFY", false, "Error loading Redis TLS Insecure Skip Verify")
+	if err != nil {
+		return nil, err
+	}
+
+	redisPoolSize, err := getIntOrDefault("REDIS_POOL_SIZE", 10, "Error loading Redis Pool Size")
+	if err != nil {
+		return nil, err
+	}
+
+	redisMinIdleConns, err := getIntOrDefault("REDIS_MIN_IDLE_CONNS", 5, "Error loading Redis Min Idle Conns")
+	if err != nil {
+		return nil, err
+	}
+
+	redisPoolTimeout, err := getDurationOrDefault("REDIS_POOL_TIMEOUT", 4*time.Second, "Error loading Redis Pool Timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	redisMaxRetries, err := getIntOrDefault("REDIS_MAX_RETRIES", 3, "Error loading Redis Max Retries")
+	if err != nil {
+		return nil, err
+	}
+
+	redisDialTimeout, err := getDurationOrDefault("REDIS_DIAL_TIMEOUT", 5*time.Second, "Error loading Redis Dial Timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	redisReadTimeout, err := getDurationOrDefault("REDIS_READ_TIMEOUT", 3*time.Second, "Error loading Redis Read Timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	redisWriteTimeout, err := getDurationOrDefault("REDIS_WRITE_TIMEOUT", 3*time.Second, "Error loading Redis Write Timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	redisTimeout, err := getDurationOrDefault("REDIS_TIMEOUT", 500*time.Millisecond, "Error loading Redis Timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTTL, err := getDurationOrDefault("CACHE_TTL", 3*time.Minute, "Error loading Cache TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	cacheLocalSize, err := getIntOrDefault("CACHE_LOCAL_SIZE", 10000, "Error loading Cache Local Size")
+	if err != nil {
+		return nil, err
+	}
+
+	cacheLocalTTL, err := getDurationOrDefault("CACHE_LOCAL_TTL", time.Minute, "Error loading Cache Local TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	cacheRedisCooldown, err := getDurationOrDefault("CACHE_REDIS_COOLDOWN", 10*time.Second, "Error loading Cache Redis Cooldown")
+	if err != nil {
+		return nil, err
+	}
+
+	cacheNegativeTTL, err := getDurationOrDefault("CACHE_NEGATIVE_TTL", 30*time.Second, "Error loading Cache Negative TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	slugFilterCapacity, err := getIntOrDefault("SLUG_FILTER_CAPACITY", 1000000, "Error loading Slug Filter Capacity")
+	if err != nil {
+		return nil, err
+	}
+
+	slugFilterRebuildInterval, err := getDurationOrDefault("SLUG_FILTER_REBUILD_INTERVAL", 10*time.Minute, "Error loading Slug Filter Rebuild Interval")
+	if err != nil {
+		return nil, err
+	}
+
+	slugFilterSyncInterval, err := getDurationOrDefault("SLUG_FILTER_SYNC_INTERVAL", 30*time.Second, "Error loading Slug Filter Sync Interval")
+	if err != nil {
+		return nil, err
+	}
+
+	clicksFlushInterval, err := getDurationOrDefault("CLICKS_FLUSH_INTERVAL", 30*time.Second, "Error loading Clicks Flush Interval")
+	if err != nil {
+		return nil, err
+	}
+
+	clicksFlushTimeout, err := getDurationOrDefault("CLICKS_FLUSH_TIMEOUT", time.Minute, "Error loading Clicks Flush Timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	clicksQueueSize, err := getIntOrDefault("CLICKS_QUEUE_SIZE", 10000, "Error loading Clicks Queue Size")
+	if err != nil {
+		return nil, err
+	}
+
+	clicksRetentionMonths, err := getIntOrDefault("CLICKS_RETENTION_MONTHS", 0, "Error loading Clicks Retention Months")
+	if err != nil {
+		return nil, err
+	}
+
+	clicksRetentionPlans, err := getIntMap("CLICKS_RETENTION_PLANS", "Error loading Clicks Retention Plans")
+	if err != nil {
+		return nil, err
+	}
+
+	clicksRetentionArchive, err := getBoolOrDefault("CLICKS_RETENTION_ARCHIVE", false, "Error loading Clicks Retention Archive")
+	if err != nil {
+		return nil, err
+	}
+
+	clicksRetentionInterval, err := getDurationOrDefault("CLICKS_RETENTION_INTERVAL", 24*time.Hour, "Error loading Clicks Retention Interval")
+	if err != nil {
+		return nil, err
+	}
+
+	clicksPartitionsAhead, err := getIntOrDefault("CLICKS_PARTITIONS_AHEAD", 3, "Error loading Clicks Partitions Ahead")
+	if err != nil {
+		return nil, err
+	}
+
+	authAccessTokenTTL, err := getDurationOrDefault("AUTH_ACCESS_TOKEN_TTL", 15*time.Minute, "Error loading Auth Access Token TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	authRefreshTokenTTL, err := getDurationOrDefault("AUTH_REFRESH_TOKEN_TTL", 30*24*time.Hour, "Error loading Auth Refresh Token TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	authRequireVerifiedEmail, err := getBoolOrDefault("AUTH_REQUIRE_VERIFIED_EMAIL", false, "Error loading Auth Require Verified Email")
+	if err != nil {
+		return nil, err
+	}
+
+	authVerificationTTL, err := getDurationOrDefault("AUTH_VERIFICATION_TTL", 24*time.Hour, "Error loading Auth Verification TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	authPasswordResetTTL, err := getDurationOrDefault("AUTH_PASSWORD_RESET_TTL", time.Hour, "Error loading Auth Password Reset TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	// An account deleted with links=transfer is deleted once the transfer of
+	// its links is accepted or declined, or after AUTH_DELETION_TRANSFER_TTL.
+	authDeletionTransferTTL, err := getDurationOrDefault("AUTH_DELETION_TRANSFER_TTL", 7*24*time.Hour, "Error loading Auth Deletion Transfer TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	// Failed sign-ins are counted per account and per IP over LOCKOUT_WINDOW.
+	// After LOCKOUT_DELAY_AFTER failures each attempt must wait longer, up to
+	// LOCKOUT_MAX_DELAY; reaching a threshold locks for LOCKOUT_DURATION.
+	lockoutAccountThreshold, err := getIntOrDefault("LOCKOUT_ACCOUNT_THRESHOLD", 10, "Error loading Lockout Account Threshold")
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutIPThreshold, err := getIntOrDefault("LOCKOUT_IP_THRESHOLD", 50, "Error loading Lockout IP Threshold")
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutWindow, err := getDurationOrDefault("LOCKOUT_WINDOW", 15*time.Minute, "Error loading Lockout Window")
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutDuration, err := getDurationOrDefault("LOCKOUT_DURATION", 15*time.Minute, "Error loading Lockout Duration")
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutDelayAfter, err := getIntOrDefault("LOCKOUT_DELAY_AFTER", 3, "Error loading Lockout Delay After")
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutMaxDelay, err := getDurationOrDefault("LOCKOUT_MAX_DELAY", 30*time.Second, "Error loading Lockout Max Delay")
+	if err != nil {
+		return nil, err
+	}
+
+	// MAIL_DRIVER picks how emails are sent: smtp, log (printed to stdout) or
+	// file (written to MAIL_OUTBOX_DIR, for tests).
+	mailDriver := env.GetEnvOrDefault("MAIL_DRIVER", MailDriverLog)
+	if mailDriver != MailDriverSMTP && mailDriver != MailDriverLog && mailDriver != MailDriverFile {
+		return nil, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: "Error loading Mail Driver",
+		}
+	}
+
+	mailSMTPHost := env.GetEnvOrDefault("MAIL_SMTP_HOST", "")
+	if mailDriver == MailDriverSMTP && mailSMTPHost == "" {
+		return nil, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: "Error loading Mail SMTP Host",
+		}
+	}
+
+	mailSMTPPort, err := getIntOrDefault("MAIL_SMTP_PORT", 587, "Error loading Mail SMTP Port")
+	if err != nil {
+		return nil, err
+	}
+
+	mailSMTPTLS, err := getBoolOrDefault("MAIL_SMTP_TLS", false, "Error loading Mail SMTP TLS")
+	if err != nil {
+		return nil, err
+	}
+
+	oauthStateTTL, err := getDurationOrDefault("OAUTH_STATE_TTL", 10*time.Minute, "Error loading OAuth State TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	oauthProviders, err := getOAuthProviders()
 	if err != nil {
 		return nil, err
 	}
@@ -58,27 +479,187 @@ func NewConfig() (*Config, error) {
 		return nil, err
 	}
 
+	urlStripTrackingParams, err := getBoolOrDefault("URL_STRIP_TRACKING_PARAMS", false, "Error loading URL Strip Tracking Params")
+	if err != nil {
+		return nil, err
+	}
+
+	maxUrlLength, err := getIntOrDefault("MAX_URL_LENGTH", 8192, "Error loading Max URL Length")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		HTTP: struct {
-			Url  string
-			Port int
+			Url       string
+			Port      int
+			BodyLimit int
 		}{
-			Url:  httpUrl,
-			Port: httpPort,
+			Url:       httpUrl,
+			Port:      httpPort,
+			BodyLimit: httpBodyLimit,
 		},
 		DB: struct {
-			DataSource string
+			Driver               string
+			DataSource           string
+			Timeout              time.Duration
+			AutoMigrate          bool
+			ReplicaDataSources   []string
+			ReplicaCheckInterval time.Duration
+			ReplicaMaxLag        time.Duration
 		}{
-			DataSource: dbDataSource,
+			Driver:               dbDriver,
+			DataSource:           dbDataSource,
+			Timeout:              dbTimeout,
+			AutoMigrate:          dbAutoMigrate,
+			ReplicaDataSources:   getList("DB_REPLICA_DATA_SOURCES"),
+			ReplicaCheckInterval: dbReplicaCheckInterval,
+			ReplicaMaxLag:        dbReplicaMaxLag,
 		},
 		URL_SHORTENED_PREFIX: urlShortenedPrefix,
 		REDIS: struct {
-			Address string
+			Address               string
+			Timeout               time.Duration
+			Mode                  string
+			Addresses             []string
+			MasterName            string
+			Username              string
+			Password              string
+			SentinelPassword      string
+			DB                    int
+			TLS                   bool
+			TLSCAFile             string
+			TLSInsecureSkipVerify bool
+			PoolSize              int
+			MinIdleConns          int
+			PoolTimeout           time.Duration
+			MaxRetries            int
+			DialTimeout           time.Duration
+			ReadTimeout           time.Duration
+			WriteTimeout          time.Duration
+		}{
+			Address:               redisAddress,
+			Timeout:               redisTimeout,
+			Mode:                  redisMode,
+			Addresses:             redisAddresses,
+			MasterName:            redisMasterName,
+			Username:              env.GetEnvOrDefault("REDIS_USERNAME", ""),
+			Password:              env.GetEnvOrDefault("REDIS_PASSWORD", ""),
+			SentinelPassword:      env.GetEnvOrDefault("REDIS_SENTINEL_PASSWORD", ""),
+			DB:                    redisDB,
+			TLS:                   redisTLS,
+			TLSCAFile:             env.GetEnvOrDefault("REDIS_TLS_CA_FILE", ""),
+			TLSInsecureSkipVerify: redisTLSInsecureSkipVerify,
+			PoolSize:              redisPoolSize,
+			MinIdleConns:          redisMinIdleConns,
+			PoolTimeout:           redisPoolTimeout,
+			MaxRetries:            redisMaxRetries,
+			DialTimeout:           redisDialTimeout,
+			ReadTimeout:           redisReadTimeout,
+			WriteTimeout:          redisWriteTimeout,
+		},
+		CACHE: struct {
+			TTL                       time.Duration
+			LocalSize                 int
+			LocalTTL                  time.Duration
+			RedisCooldown             time.Duration
+			NegativeTTL               time.Duration
+			SlugFilterCapacity        int
+			SlugFilterRebuildInterval time.Duration
+			SlugFilterSyncInterval    time.Duration
 		}{
-			Address: redisAddress,
+			TTL:                       cacheTTL,
+			LocalSize:                 cacheLocalSize,
+			LocalTTL:                  cacheLocalTTL,
+			RedisCooldown:             cacheRedisCooldown,
+			NegativeTTL:               cacheNegativeTTL,
+			SlugFilterCapacity:        slugFilterCapacity,
+			SlugFilterRebuildInterval: slugFilterRebuildInterval,
+			SlugFilterSyncInterval:    slugFilterSyncInterval,
 		},
-		JWT_SECRET:   jwtSecret,
-		FRONTEND_URL: frontendUrl,
+		CLICKS: struct {
+			FlushInterval     time.Duration
+			FlushTimeout      time.Duration
+			QueueSize         int
+			RetentionMonths   int
+			RetentionPlans    map[string]int
+			RetentionArchive  bool
+			RetentionInterval time.Duration
+			PartitionsAhead   int
+		}{
+			FlushInterval:     clicksFlushInterval,
+			FlushTimeout:      clicksFlushTimeout,
+			QueueSize:         clicksQueueSize,
+			RetentionMonths:   clicksRetentionMonths,
+			RetentionPlans:    clicksRetentionPlans,
+			RetentionArchive:  clicksRetentionArchive,
+			RetentionInterval: clicksRetentionInterval,
+			PartitionsAhead:   clicksPartitionsAhead,
+		},
+		AUTH: struct {
+			AccessTokenTTL       time.Duration
+			RefreshTokenTTL      time.Duration
+			RequireVerifiedEmail bool
+			VerificationTTL      time.Duration
+			PasswordResetTTL     time.Duration
+			TOTPIssuer           string
+			DeletionTransferTTL  time.Duration
+		}{
+			AccessTokenTTL:       authAccessTokenTTL,
+			RefreshTokenTTL:      authRefreshTokenTTL,
+			RequireVerifiedEmail: authRequireVerifiedEmail,
+			VerificationTTL:      authVerificationTTL,
+			PasswordResetTTL:     authPasswordResetTTL,
+			TOTPIssuer:           env.GetEnvOrDefault("AUTH_TOTP_ISSUER", "URL Shortener"),
+			DeletionTransferTTL:  authDeletionTransferTTL,
+		},
+		LOCKOUT: struct {
+			AccountThreshold int
+			IPThreshold      int
+			Window           time.Duration
+			Duration         time.Duration
+			DelayAfter       int
+			MaxDelay         time.Duration
+		}{
+			AccountThreshold: lockoutAccountThreshold,
+			IPThreshold:      lockoutIPThreshold,
+			Window:           lockoutWindow,
+			Duration:         lockoutDuration,
+			DelayAfter:       lockoutDelayAfter,
+			MaxDelay:         lockoutMaxDelay,
+		},
+		MAIL: struct {
+			Driver       string
+			From         string
+			SMTPHost     string
+			SMTPPort     int
+			SMTPUsername string
+			SMTPPassword string
+			SMTPTLS      bool
+			OutboxDir    string
+		}{
+			Driver:       mailDriver,
+			From:         env.GetEnvOrDefault("MAIL_FROM", "URL Shortener <no-reply@localhost>"),
+			SMTPHost:     mailSMTPHost,
+			SMTPPort:     mailSMTPPort,
+			SMTPUsername: env.GetEnvOrDefault("MAIL_SMTP_USERNAME", ""),
+			SMTPPassword: env.GetEnvOrDefault("MAIL_SMTP_PASSWORD", ""),
+			SMTPTLS:      mailSMTPTLS,
+			OutboxDir:    env.GetEnvOrDefault("MAIL_OUTBOX_DIR", "tmp/outbox"),
+		},
+		OAUTH: struct {
+			CallbackUrl string
+			StateTTL    time.Duration
+			Providers   []OAuthProvider
+		}{
+			CallbackUrl: strings.TrimSuffix(env.GetEnvOrDefault("OAUTH_CALLBACK_URL", "http://localhost:"+strconv.Itoa(httpPort)), "/"),
+			StateTTL:    oauthStateTTL,
+			Providers:   oauthProviders,
+		},
+		JWT_SECRET:                jwtSecret,
+		FRONTEND_URL:              frontendUrl,
+		URL_STRIP_TRACKING_PARAMS: urlStripTrackingParams,
+		MAX_URL_LENGTH:            maxUrlLength,
 	}, nil
 }
 
@@ -106,3 +687,115 @@ func getString(key, errorMessage string) (string, error) {
 	}
 	return value, nil
 }
+
+func getIntOrDefault(key string, defaultValue int, errorMessage string) (int, error) {
+	value, err := strconv.Atoi(env.GetEnvOrDefault(key, strconv.Itoa(defaultValue)))
+	if err != nil {
+		return 0, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: errorMessage,
+		}
+	}
+	return value, nil
+}
+
+func getDurationOrDefault(key string, defaultValue time.Duration, errorMessage string) (time.Duration, error) {
+	value, err := time.ParseDuration(env.GetEnvOrDefault(key, defaultValue.String()))
+	if err != nil {
+		return 0, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: errorMessage,
+		}
+	}
+	return value, nil
+}
+
+func getBoolOrDefault(key string, defaultValue bool, errorMessage string) (bool, error) {
+	value, err := strconv.ParseBool(env.GetEnvOrDefault(key, strconv.FormatBool(defaultValue)))
+	if err != nil {
+		return false, &projectError.Error{
+			Code:    projectError.EINVALID,
+			Message: errorMessage,
+		}
+	}
+	return value, nil
+}
+
+// getList reads a comma-separated list, skipping empty items.
+func getList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(env.GetEnvOrDefault(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getIntMap reads a comma-separated list of key:value pairs with integer
+// values, e.g. "free:3,pro:24".
+func getIntMap(key, errorMessage string) (map[string]int, error) {
+	values := map[string]int{}
+	for _, item := range getList(key) {
+		name, number, ok := strings.Cut(item, ":")
+		value, err := strconv.Atoi(strings.TrimSpace(number))
+		if !ok || err != nil || strings.TrimSpace(name) == "" {
+			return nil, &projectError.Error{
+				Code:    projectError.EINVALID,
+				Message: errorMessage,
+			}
+		}
+		values[strings.TrimSpace(name)] = value
+	}
+	return values, nil
+}
+
+// getOAuthProviders returns the providers whose client id is set. Google and
+// GitHub only need client credentials; OAUTH_OIDC_* configures any other
+// OpenID Connect provider, such as a company IdP or a local mock.
+func getOAuthProviders() ([]OAuthProvider, error) {
+	var providers []OAuthProvider
+
+	if clientID := env.GetEnvOrDefault("OAUTH_GOOGLE_CLIENT_ID", ""); clientID != "" {
+		providers = append(providers, OAuthProvider{
+			Name:         "google",
+			Kind:         OAuthKindOIDC,
+			Issuer:       "https://accounts.google.com",
+			ClientID:     clientID,
+			ClientSecret: env.GetEnvOrDefault("OAUTH_GOOGLE_CLIENT_SECRET", ""),
+			Scopes:       []string{"openid", "email", "profile"},
+		})
+	}
+
+	if clientID := env.GetEnvOrDefault("OAUTH_GITHUB_CLIENT_ID", ""); clientID != "" {
+		providers = append(providers, OAuthProvider{
+			Name:         "github",
+			Kind:         OAuthKindGitHub,
+			ClientID:     clientID,
+			ClientSecret: env.GetEnvOrDefault("OAUTH_GITHUB_CLIENT_SECRET", ""),
+			Scopes:       []string{"read:user", "user:email"},
+		})
+	}
+
+	if clientID := env.GetEnvOrDefault("OAUTH_OIDC_CLIENT_ID", ""); clientID != "" {
+		issuer := env.GetEnvOrDefault("OAUTH_OIDC_ISSUER", "")
+		if issuer == "" {
+			return nil, &projectError.Error{
+				Code:    projectError.EINVALID,
+				Message: "Error loading OAuth OIDC Issuer",
+			}
+		}
+
+		scopes := strings.Fields(env.GetEnvOrDefault("OAUTH_OIDC_SCOPES", "openid email profile"))
+		providers = append(providers, OAuthProvider{
+			Name:         env.GetEnvOrDefault("OAUTH_OIDC_NAME", "oidc"),
+			Kind:         OAuthKindOIDC,
+			Issuer:       strings.TrimSuffix(issuer, "/"),
+			ClientID:     clientID,
+			ClientSecret: env.GetEnvOrDefault("OAUTH_OIDC_CLIENT_SECRET", ""),
+			Scopes:       scopes,
+		})
+	}
+
+	return providers, nil
+}
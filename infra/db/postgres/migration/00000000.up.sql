@@ -1,7 +1,3 @@
--- Drop tables in correct order (dependent tables first)
-DROP TABLE IF EXISTS url_shortening;
-DROP TABLE IF EXISTS users;
-
 -- Create users table first (referenced table)
 CREATE TABLE users (
   id varchar(255) PRIMARY KEY,
@@ -10,4 +6,4 @@ CREATE TABLE users (
   password varchar(255) NOT NULL,
   created_at timestamp NOT NULL DEFAULT now(),
   updated_at timestamp NOT NULL DEFAULT now()
-);
\ No newline at end of file
+);
@@ -0,0 +1 @@
+ALTER TABLE url_shortening DROP COLUMN slug;
@@ -0,0 +1 @@
+ALTER TABLE url_shortening DROP CONSTRAINT id_user_url_original_unique;
@@ -0,0 +1,8 @@
+-- Fails if a user has two links with the same original URL, which the
+-- canonical uniqueness allowed; resolve those before rolling back.
+DROP INDEX id_user_url_canonical_unique;
+
+ALTER TABLE url_shortening DROP COLUMN url_canonical;
+
+ALTER TABLE url_shortening
+ADD CONSTRAINT id_user_url_original_unique UNIQUE (id_user, url_original);
@@ -0,0 +1,12 @@
+-- Canonical form of url_original used to detect duplicate links per user.
+-- Existing rows are backfilled with the original URL; new rows are
+-- canonicalized by the application before insert.
+ALTER TABLE url_shortening ADD COLUMN url_canonical varchar(255);
+
+UPDATE url_shortening SET url_canonical = url_original;
+
+ALTER TABLE url_shortening ALTER COLUMN url_canonical SET NOT NULL;
+
+ALTER TABLE url_shortening DROP CONSTRAINT id_user_url_original_unique;
+
+CREATE UNIQUE INDEX id_user_url_canonical_unique ON url_shortening (id_user, url_canonical);
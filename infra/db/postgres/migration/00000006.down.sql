@@ -0,0 +1,10 @@
+-- Fails if a URL is longer than 255 characters or two canonical URLs share a
+-- user; resolve those before rolling back.
+DROP INDEX id_user_url_canonical_hash_unique;
+
+ALTER TABLE url_shortening DROP COLUMN url_canonical_hash;
+
+ALTER TABLE url_shortening ALTER COLUMN url_canonical TYPE varchar(255);
+ALTER TABLE url_shortening ALTER COLUMN url_original TYPE varchar(255);
+
+CREATE UNIQUE INDEX id_user_url_canonical_unique ON url_shortening (id_user, url_canonical);
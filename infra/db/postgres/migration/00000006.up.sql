@@ -0,0 +1,15 @@
+-- Allow destination URLs longer than 255 characters. Btree indexes cannot hold
+-- arbitrarily long values, so duplicates are detected on a SHA-256 hash of the
+-- canonical URL instead of the URL itself.
+ALTER TABLE url_shortening ALTER COLUMN url_original TYPE text;
+ALTER TABLE url_shortening ALTER COLUMN url_canonical TYPE text;
+
+ALTER TABLE url_shortening ADD COLUMN url_canonical_hash char(64);
+
+UPDATE url_shortening SET url_canonical_hash = encode(sha256(convert_to(url_canonical, 'UTF8')), 'hex');
+
+ALTER TABLE url_shortening ALTER COLUMN url_canonical_hash SET NOT NULL;
+
+DROP INDEX id_user_url_canonical_unique;
+
+CREATE UNIQUE INDEX id_user_url_canonical_hash_unique ON url_shortening (id_user, url_canonical_hash);
@@ -0,0 +1,12 @@
+-- Soft-deleted links would come back to life, so this check makes the
+-- rollback fail while any exists; purge or restore them first.
+ALTER TABLE url_shortening ADD CONSTRAINT url_shortening_no_deleted CHECK (deleted_at IS NULL);
+ALTER TABLE url_shortening DROP CONSTRAINT url_shortening_no_deleted;
+
+DROP TABLE url_shortening_history;
+
+DROP INDEX id_user_url_canonical_hash_unique;
+
+CREATE UNIQUE INDEX id_user_url_canonical_hash_unique ON url_shortening (id_user, url_canonical_hash);
+
+ALTER TABLE url_shortening DROP COLUMN deleted_at;
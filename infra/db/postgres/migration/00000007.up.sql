@@ -0,0 +1,27 @@
+-- Links are soft deleted so they can be restored and keep their history.
+ALTER TABLE url_shortening ADD COLUMN deleted_at timestamp;
+
+-- Only live links take part in duplicate detection.
+DROP INDEX id_user_url_canonical_hash_unique;
+
+CREATE UNIQUE INDEX id_user_url_canonical_hash_unique ON url_shortening (id_user, url_canonical_hash) WHERE deleted_at IS NULL;
+
+-- Append-only record of every change made to a link.
+CREATE TABLE url_shortening_history (
+  id varchar(255) PRIMARY KEY,
+  id_url varchar(255) NOT NULL,
+  id_user varchar(255) NOT NULL,
+  action varchar(32) NOT NULL,
+  old_value text,
+  new_value text,
+  client_ip varchar(64) NOT NULL DEFAULT '',
+  created_at timestamp NOT NULL DEFAULT now(),
+
+  FOREIGN KEY (id_url) REFERENCES url_shortening(id)
+);
+
+CREATE INDEX url_shortening_history_id_url_idx ON url_shortening_history (id_url, created_at);
+
+-- Existing links get a synthetic create entry so every link has a history.
+INSERT INTO url_shortening_history (id, id_url, id_user, action, new_value, created_at)
+SELECT gen_random_uuid()::varchar, id, id_user, 'create', url_original, created_at FROM url_shortening;
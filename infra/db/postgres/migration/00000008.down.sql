@@ -0,0 +1,2 @@
+DROP TABLE url_transfer_items;
+DROP TABLE url_transfers;
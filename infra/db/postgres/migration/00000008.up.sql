@@ -0,0 +1,24 @@
+-- Pending and past hand-overs of links from one user to another.
+CREATE TABLE url_transfers (
+  id varchar(255) PRIMARY KEY,
+  id_user_from varchar(255) NOT NULL,
+  id_user_to varchar(255) NOT NULL,
+  status varchar(32) NOT NULL DEFAULT 'pending',
+  created_at timestamp NOT NULL DEFAULT now(),
+  updated_at timestamp NOT NULL DEFAULT now(),
+
+  FOREIGN KEY (id_user_from) REFERENCES users(id),
+  FOREIGN KEY (id_user_to) REFERENCES users(id)
+);
+
+CREATE INDEX url_transfers_id_user_from_idx ON url_transfers (id_user_from, status);
+CREATE INDEX url_transfers_id_user_to_idx ON url_transfers (id_user_to, status);
+
+CREATE TABLE url_transfer_items (
+  id_transfer varchar(255) NOT NULL,
+  id_url varchar(255) NOT NULL,
+
+  PRIMARY KEY (id_transfer, id_url),
+  FOREIGN KEY (id_transfer) REFERENCES url_transfers(id),
+  FOREIGN KEY (id_url) REFERENCES url_shortening(id)
+);
@@ -0,0 +1,4 @@
+DROP TABLE url_click_flushes;
+DROP TABLE url_clicks_daily;
+
+ALTER TABLE url_shortening DROP COLUMN clicks;
@@ -0,0 +1,19 @@
+-- Click counts flushed from Redis: a running total per link and one row per
+-- link and day.
+ALTER TABLE url_shortening ADD COLUMN clicks bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE url_clicks_daily (
+  id_url varchar(255) NOT NULL,
+  day date NOT NULL,
+  clicks bigint NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (id_url, day),
+  FOREIGN KEY (id_url) REFERENCES url_shortening(id)
+);
+
+-- Batches already applied, so a batch retried after a crash is not counted
+-- twice.
+CREATE TABLE url_click_flushes (
+  id varchar(255) PRIMARY KEY,
+  created_at timestamp NOT NULL DEFAULT now()
+);
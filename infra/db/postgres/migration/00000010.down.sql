@@ -0,0 +1,21 @@
+ALTER TABLE url_clicks_daily RENAME TO url_clicks_daily_partitioned;
+ALTER INDEX url_clicks_daily_pkey RENAME TO url_clicks_daily_partitioned_pkey;
+
+CREATE TABLE url_clicks_daily (
+  id_url varchar(255) NOT NULL,
+  day date NOT NULL,
+  clicks bigint NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (id_url, day),
+  FOREIGN KEY (id_url) REFERENCES url_shortening(id)
+);
+
+INSERT INTO url_clicks_daily (id_url, day, clicks) SELECT id_url, day, clicks FROM url_clicks_daily_partitioned;
+
+DROP TABLE url_clicks_daily_partitioned;
+
+-- Fails while archived partitions are left, which must be moved or dropped
+-- by hand first.
+DROP SCHEMA click_archive;
+
+ALTER TABLE users DROP COLUMN plan;
@@ -0,0 +1,43 @@
+-- The plan of a user selects how long the click counts of their links are
+-- kept (CLICKS_RETENTION_PLANS).
+ALTER TABLE users ADD COLUMN plan varchar(32) NOT NULL DEFAULT 'free';
+
+-- Expired click partitions are moved here when CLICKS_RETENTION_ARCHIVE is
+-- set, instead of being dropped.
+CREATE SCHEMA click_archive;
+
+-- Daily click counts are split into one partition per month, named
+-- url_clicks_daily_YYYYMM, so expired months are dropped whole instead of
+-- deleted row by row. The application creates the partitions of the coming
+-- months (CLICKS_PARTITIONS_AHEAD); this creates the ones for the existing
+-- rows and the next three months.
+ALTER TABLE url_clicks_daily RENAME TO url_clicks_daily_old;
+ALTER INDEX url_clicks_daily_pkey RENAME TO url_clicks_daily_old_pkey;
+
+CREATE TABLE url_clicks_daily (
+  id_url varchar(255) NOT NULL,
+  day date NOT NULL,
+  clicks bigint NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (id_url, day),
+  FOREIGN KEY (id_url) REFERENCES url_shortening(id)
+) PARTITION BY RANGE (day);
+
+DO $$
+DECLARE
+  month date;
+BEGIN
+  FOR month IN
+    SELECT generate_series(
+      date_trunc('month', LEAST((SELECT min(day) FROM url_clicks_daily_old), current_date)),
+      date_trunc('month', current_date) + interval '3 months',
+      interval '1 month')::date
+  LOOP
+    EXECUTE format('CREATE TABLE %I PARTITION OF url_clicks_daily FOR VALUES FROM (%L) TO (%L)',
+      'url_clicks_daily_' || to_char(month, 'YYYYMM'), month, (month + interval '1 month')::date);
+  END LOOP;
+END $$;
+
+INSERT INTO url_clicks_daily (id_url, day, clicks) SELECT id_url, day, clicks FROM url_clicks_daily_old;
+
+DROP TABLE url_clicks_daily_old;
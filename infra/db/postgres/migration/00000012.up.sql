@@ -0,0 +1,14 @@
+-- Accounts of external sign-in providers (Google, GitHub, OIDC) linked to a
+-- user. subject is the provider's stable id for the account.
+CREATE TABLE user_identities (
+  provider varchar(64) NOT NULL,
+  subject varchar(255) NOT NULL,
+  id_user varchar(255) NOT NULL,
+  email varchar(255) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT now(),
+
+  PRIMARY KEY (provider, subject),
+  FOREIGN KEY (id_user) REFERENCES users(id)
+);
+
+CREATE INDEX user_identities_id_user_idx ON user_identities (id_user);
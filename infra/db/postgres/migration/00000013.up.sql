@@ -0,0 +1,21 @@
+-- Users must confirm their email. Accounts created before verification
+-- existed are trusted as they are.
+ALTER TABLE users ADD COLUMN email_verified_at timestamp NULL;
+
+UPDATE users SET email_verified_at = created_at;
+
+-- Single-use tokens sent by email, such as email verification links. Only the
+-- SHA-256 of a token is stored. email is the address the token was sent to,
+-- so a token stops working if the user changes their email.
+CREATE TABLE user_tokens (
+  token_hash char(64) PRIMARY KEY,
+  id_user varchar(255) NOT NULL,
+  purpose varchar(32) NOT NULL,
+  email varchar(255) NOT NULL,
+  expires_at timestamp NOT NULL,
+  created_at timestamp NOT NULL DEFAULT now(),
+
+  FOREIGN KEY (id_user) REFERENCES users(id)
+);
+
+CREATE INDEX user_tokens_id_user_purpose_idx ON user_tokens (id_user, purpose);
@@ -0,0 +1,24 @@
+-- Authenticator apps enrolled for two-factor sign-in (TOTP, RFC 6238). An
+-- enrollment is pending until confirmed_at is set by a first valid code.
+-- last_step is the time step of the last accepted code, which cannot be
+-- accepted again.
+CREATE TABLE user_totp (
+  id_user varchar(255) PRIMARY KEY,
+  secret varchar(64) NOT NULL,
+  confirmed_at timestamp NULL,
+  last_step bigint NOT NULL DEFAULT 0,
+  created_at timestamp NOT NULL DEFAULT now(),
+
+  FOREIGN KEY (id_user) REFERENCES users(id)
+);
+
+-- Single-use codes to sign in without the authenticator app. Only their
+-- SHA-256 is stored.
+CREATE TABLE user_recovery_codes (
+  id_user varchar(255) NOT NULL,
+  code_hash char(64) NOT NULL,
+  used_at timestamp NULL,
+
+  PRIMARY KEY (id_user, code_hash),
+  FOREIGN KEY (id_user) REFERENCES users(id)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE url_shortening DROP COLUMN takedown_reason;
+ALTER TABLE url_shortening DROP COLUMN taken_down_at;
+ALTER TABLE url_shortening DROP COLUMN expires_at;
+
+ALTER TABLE users DROP COLUMN disabled_at;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,10 @@
+-- Roles and disabled accounts, set by admins. Admins are appointed with
+-- `main role <email> admin`.
+ALTER TABLE users ADD COLUMN role varchar(32) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN disabled_at timestamp NULL;
+
+-- Links stop redirecting once expires_at has passed, or once an admin took
+-- them down, and answer 410 instead. takedown_reason is shown to visitors.
+ALTER TABLE url_shortening ADD COLUMN expires_at timestamp NULL;
+ALTER TABLE url_shortening ADD COLUMN taken_down_at timestamp NULL;
+ALTER TABLE url_shortening ADD COLUMN takedown_reason text NULL;
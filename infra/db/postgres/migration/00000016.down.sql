@@ -0,0 +1,2 @@
+-- Rows still in the default partition are lost.
+DROP TABLE url_clicks_daily_default;
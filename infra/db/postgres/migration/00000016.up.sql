@@ -0,0 +1,4 @@
+-- Clicks for a month without a partition, e.g. while the maintenance job is
+-- not running, land here instead of failing every flush. The job moves them
+-- into the month's partition when it creates it.
+CREATE TABLE url_clicks_daily_default PARTITION OF url_clicks_daily DEFAULT;
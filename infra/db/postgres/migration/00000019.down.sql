@@ -0,0 +1 @@
+-- The canonical URLs are kept: the application writes links that way anyway.
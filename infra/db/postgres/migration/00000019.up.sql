@@ -0,0 +1,10 @@
+-- 00000005 filled url_canonical of the links that existed then with their
+-- url_original as is. The step canonicalizes every link the way the
+-- application does, and the unique index is rebuilt on the result. The step
+-- fails, listing them, when a user has two live links to the same canonical
+-- URL: delete one of each and migrate again.
+DROP INDEX id_user_url_canonical_hash_unique;
+
+-- step: canonicalize urls
+
+CREATE UNIQUE INDEX id_user_url_canonical_hash_unique ON url_shortening (id_user, url_canonical_hash) WHERE deleted_at IS NULL;
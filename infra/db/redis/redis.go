@@ -2,37 +2,154 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
 	"time"
 	"url_shortening/infra/config/environment"
 
-
 	"github.com/redis/go-redis/v9"
 )
 
 type Redis struct {
-	Client *redis.Client
+	// Client is a single-node, Sentinel or Cluster client depending on
+	// REDIS_MODE. Keys used together in one command must share a hash tag.
+	Client redis.UniversalClient
+	// Timeout bounds every operation on top of the caller's context.
+	Timeout time.Duration
 }
 
 func NewRedis(config *environment.Config) (*Redis, error) {
-	opt, err := redis.ParseURL(config.REDIS.Address)
+	opt, err := universalOptions(config)
 	if err != nil {
 		return nil, err
 	}
 
-	opt.PoolSize = 10
-	opt.MinIdleConns = 5
-	opt.MaxRetries = 3
-	opt.DialTimeout = 5 * time.Second
-	opt.ReadTimeout = 3 * time.Second
-	opt.WriteTimeout = 3 * time.Second
+	var client redis.UniversalClient
+	switch config.REDIS.Mode {
+	case environment.RedisModeSentinel:
+		client = redis.NewFailoverClient(opt.Failover())
+	case environment.RedisModeCluster:
+		client = redis.NewClusterClient(opt.Cluster())
+	default:
+		client = redis.NewClient(opt.Simple())
+	}
+
+	return &Redis{Client: client, Timeout: config.REDIS.Timeout}, nil
+}
+
+// universalOptions builds the client options from the config. In single mode
+// the REDIS_ADDRESS url provides the defaults, which explicit settings
+// override.
+func universalOptions(config *environment.Config) (*redis.UniversalOptions, error) {
+	opt := &redis.UniversalOptions{
+		Addrs:            config.REDIS.Addresses,
+		MasterName:       config.REDIS.MasterName,
+		DB:               config.REDIS.DB,
+		SentinelPassword: config.REDIS.SentinelPassword,
+	}
+
+	if config.REDIS.Mode == environment.RedisModeSingle {
+		url, err := redis.ParseURL(config.REDIS.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		opt.Addrs = []string{url.Addr}
+		opt.Username = url.Username
+		opt.Password = url.Password
+		opt.DB = url.DB
+		opt.TLSConfig = url.TLSConfig
+		if config.REDIS.DB != 0 {
+			opt.DB = config.REDIS.DB
+		}
+	}
+
+	if config.REDIS.Username != "" {
+		opt.Username = config.REDIS.Username
+	}
+	if config.REDIS.Password != "" {
+		opt.Password = config.REDIS.Password
+	}
+
+	if config.REDIS.TLS || config.REDIS.TLSCAFile != "" || config.REDIS.TLSInsecureSkipVerify {
+		tlsConfig, err := newTLSConfig(config, opt.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		opt.TLSConfig = tlsConfig
+	}
+
+	opt.PoolSize = config.REDIS.PoolSize
+	opt.MinIdleConns = config.REDIS.MinIdleConns
+	opt.PoolTimeout = config.REDIS.PoolTimeout
+	opt.MaxRetries = config.REDIS.MaxRetries
+	opt.DialTimeout = config.REDIS.DialTimeout
+	opt.ReadTimeout = config.REDIS.ReadTimeout
+	opt.WriteTimeout = config.REDIS.WriteTimeout
 
-	return &Redis{Client: redis.NewClient(opt)}, nil
+	return opt, nil
 }
 
-func (r *Redis) Get(key string) (string, error) {
-	return r.Client.Get(context.Background(), key).Result()
+func newTLSConfig(config *environment.Config, base *tls.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+
+	tlsConfig.InsecureSkipVerify = config.REDIS.TLSInsecureSkipVerify
+
+	if config.REDIS.TLSCAFile != "" {
+		pem, err := os.ReadFile(config.REDIS.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read redis ca file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in redis ca file %q", config.REDIS.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// WithTimeout derives the context for a single Redis operation.
+func (r *Redis) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.Timeout)
 }
 
-func (r *Redis) Set(key string, value interface{}, expiration time.Duration) error {
-	return r.Client.Set(context.Background(), key, value, expiration).Err()
+func (r *Redis) Ping(ctx context.Context) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+	return r.Client.Ping(ctx).Err()
+}
+
+func (r *Redis) Get(ctx context.Context, key string) (string, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+	return r.Client.Get(ctx, key).Result()
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+	return r.Client.Set(ctx, key, value, expiration).Err()
+}
+
+// Del deletes keys one command each, so keys living in different cluster
+// slots can be deleted together.
+func (r *Redis) Del(ctx context.Context, keys ...string) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
 }
@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"url_shortening/infra/config/environment"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/redis/go-redis/v9"
+)
+
+func testConfig(mode string) *environment.Config {
+	config := &environment.Config{}
+	config.REDIS.Mode = mode
+	config.REDIS.Timeout = time.Second
+	config.REDIS.PoolSize = 2
+	config.REDIS.PoolTimeout = time.Second
+	config.REDIS.DialTimeout = time.Second
+	config.REDIS.ReadTimeout = time.Second
+	config.REDIS.WriteTimeout = time.Second
+	return config
+}
+
+func newTestRedis(t *testing.T, config *environment.Config) *Redis {
+	t.Helper()
+
+	r, err := NewRedis(config)
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	t.Cleanup(func() { r.Client.Close() })
+
+	return r
+}
+
+// roundTrip checks that r reaches a Redis server by writing and reading a key.
+func roundTrip(t *testing.T, r *Redis) {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := r.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := r.Set(ctx, "key", "value", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if value, err := r.Get(ctx, "key"); err != nil || value != "value" {
+		t.Fatalf("Get = %q, %v; want value", value, err)
+	}
+}
+
+func TestNewRedisSingle(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	config := testConfig(environment.RedisModeSingle)
+	config.REDIS.Address = "redis://" + s.Addr() + "/2"
+
+	r := newTestRedis(t, config)
+	if _, ok := r.Client.(*redis.Client); !ok {
+		t.Fatalf("client is %T; want *redis.Client", r.Client)
+	}
+
+	roundTrip(t, r)
+
+	s.Select(2)
+	if value, err := s.Get("key"); err != nil || value != "value" {
+		t.Fatalf("db 2 holds %q, %v; want the database of the url", value, err)
+	}
+}
+
+func TestNewRedisSingleCredentialsOverrideUrl(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.RequireUserAuth("app", "secret")
+
+	config := testConfig(environment.RedisModeSingle)
+	config.REDIS.Address = "redis://default:wrong@" + s.Addr()
+	config.REDIS.Username = "app"
+	config.REDIS.Password = "secret"
+
+	roundTrip(t, newTestRedis(t, config))
+}
+
+func TestNewRedisCluster(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	config := testConfig(environment.RedisModeCluster)
+	config.REDIS.Addresses = []string{s.Addr()}
+
+	r := newTestRedis(t, config)
+	if _, ok := r.Client.(*redis.ClusterClient); !ok {
+		t.Fatalf("client is %T; want *redis.ClusterClient", r.Client)
+	}
+
+	roundTrip(t, r)
+
+	if value, err := s.Get("key"); err != nil || value != "value" {
+		t.Fatalf("node holds %q, %v; want the key written through the cluster", value, err)
+	}
+}
+
+func TestNewRedisSentinel(t *testing.T) {
+	master := miniredis.RunT(t)
+	master.RequireAuth("secret")
+
+	// miniredis has no Sentinel, so a second instance answers the few
+	// SENTINEL commands the failover client sends.
+	sentinel := miniredis.RunT(t)
+	host, port, _ := strings.Cut(master.Addr(), ":")
+	err := sentinel.Server().Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		switch {
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name") && args[1] == "mymaster":
+			c.WriteLen(2)
+			c.WriteBulk(host)
+			c.WriteBulk(port)
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name"):
+			c.WriteNull()
+		case len(args) > 0 && (strings.EqualFold(args[0], "sentinels") || strings.EqualFold(args[0], "replicas")):
+			c.WriteLen(0)
+		default:
+			c.WriteError("ERR unknown sentinel subcommand " + strconv.Quote(strings.Join(args, " ")))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := testConfig(environment.RedisModeSentinel)
+	config.REDIS.Addresses = []string{sentinel.Addr()}
+	config.REDIS.MasterName = "mymaster"
+	config.REDIS.Password = "secret"
+
+	r := newTestRedis(t, config)
+	roundTrip(t, r)
+
+	if value, err := master.Get("key"); err != nil || value != "value" {
+		t.Fatalf("master holds %q, %v; want the key written through the sentinel", value, err)
+	}
+}
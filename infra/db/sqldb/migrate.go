@@ -0,0 +1,497 @@
+package sqldb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationLockKey is the Postgres advisory lock held while migrating, so
+// instances starting together do not apply the same migration twice.
+const migrationLockKey int64 = 0x75726c5f6d6967
+
+const (
+	MigrationApplied  = "applied"
+	MigrationPending  = "pending"
+	MigrationModified = "modified"
+	MigrationMissing  = "missing"
+)
+
+// Migration is a pair of NNNNNNNN.up.sql and NNNNNNNN.down.sql files.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus is a migration file, an applied migration or both.
+// Modified means the up file changed after it was applied and Missing means
+// an applied migration has no file anymore.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	State     string
+	AppliedAt *time.Time
+}
+
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// stepPrefix starts the line of a migration file where a Step runs.
+const stepPrefix = "-- step: "
+
+// Step is Go code a migration runs where its file has a `-- step: <name>`
+// line, in the transaction of the migration, for changes SQL cannot make
+// such as applying the URL rules of the application.
+type Step func(tx *gorm.DB) error
+
+// Migrator applies and rolls back the migrations of a Database. With DryRun
+// set it writes the SQL it would run to Output instead of running it.
+type Migrator struct {
+	db         *Database
+	migrations []Migration
+	steps      map[string]Step
+	DryRun     bool
+	Output     io.Writer
+}
+
+// NewMigrator reads the *.up.sql and *.down.sql files at the root of
+// migrations.
+func NewMigrator(db *Database, migrations fs.FS) (*Migrator, error) {
+	names, err := fs.Glob(migrations, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, name := range names {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %q: name must end in .up.sql or .down.sql", name)
+		}
+
+		version, err := strconv.ParseInt(strings.SplitN(base, "_", 2)[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q: name must start with a version number", name)
+		}
+
+		buf, err := fs.ReadFile(migrations, name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: base}
+			byVersion[version] = migration
+		} else if migration.Name != base {
+			return nil, fmt.Errorf("migration %q: version %d is also used by %q", name, version, migration.Name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(buf)
+			sum := sha256.Sum256(buf)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(buf)
+		}
+	}
+
+	m := &Migrator{db: db, steps: map[string]Step{}, Output: io.Discard}
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migration %q has no up file", migration.Name)
+		}
+		m.migrations = append(m.migrations, *migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return m, nil
+}
+
+// AddStep registers step under name for the migrations that run it.
+func (m *Migrator) AddStep(name string, step Step) {
+	m.steps[name] = step
+}
+
+// Status lists every migration file and applied migration by version.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, false, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		statuses = m.status(applied)
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns how many migrations Up would apply.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if status.State == MigrationPending {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.latest())
+}
+
+// Down rolls back the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, !m.DryRun, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		versions := appliedVersions(applied)
+		if steps > len(versions) {
+			steps = len(versions)
+		}
+		target := int64(-1)
+		if steps < len(versions) {
+			target = versions[len(versions)-steps-1]
+		}
+
+		return m.migrate(conn, applied, target)
+	})
+}
+
+// To applies or rolls back migrations until version is the last one applied.
+// A negative version rolls back every migration.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version >= 0 && m.find(version) == nil {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.withLock(ctx, !m.DryRun, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		return m.migrate(conn, applied, version)
+	})
+}
+
+func (m *Migrator) migrate(conn *gorm.DB, applied map[int64]appliedMigration, target int64) error {
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok && migration.Version <= target {
+			if err := m.apply(conn, migration, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	versions := appliedVersions(applied)
+	for i := len(versions) - 1; i >= 0 && versions[i] > target; i-- {
+		if err := m.apply(conn, *m.find(versions[i]), false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply runs one migration in its own transaction together with the change
+// to schema_migrations, so a failed migration leaves no trace.
+func (m *Migrator) apply(conn *gorm.DB, migration Migration, up bool) error {
+	direction, script := "up", migration.Up
+	if !up {
+		direction, script = "down", migration.Down
+		if strings.TrimSpace(script) == "" {
+			return fmt.Errorf("migration %q cannot be rolled back: no down file", migration.Name)
+		}
+	}
+
+	if m.DryRun {
+		fmt.Fprintf(m.Output, "-- %s.%s.sql\n%s\n", migration.Name, direction, strings.TrimSpace(script))
+		return nil
+	}
+
+	start := time.Now()
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := m.run(tx, script); err != nil {
+			return err
+		}
+
+		if up {
+			return tx.Exec(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?,?,?,?)`,
+				migration.Version, migration.Name, migration.Checksum, time.Now()).Error
+		}
+		return tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, migration.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration error: name=%q direction=%s err=%w", migration.Name, direction, err)
+	}
+
+	log.Printf("migration %s %s (%s)", migration.Name, direction, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// run runs script, and the steps it names between its statements.
+func (m *Migrator) run(tx *gorm.DB, script string) error {
+	var statements strings.Builder
+	flush := func() error {
+		defer statements.Reset()
+		if onlyComments(statements.String()) {
+			return nil
+		}
+		return tx.Exec(statements.String()).Error
+	}
+
+	for _, line := range strings.SplitAfter(script, "\n") {
+		name, ok := strings.CutPrefix(strings.TrimSpace(line), stepPrefix)
+		if !ok {
+			statements.WriteString(line)
+			continue
+		}
+
+		step, ok := m.steps[name]
+		if !ok {
+			return fmt.Errorf("unknown step %q", name)
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if err := step(tx); err != nil {
+			return fmt.Errorf("step %q: %w", name, err)
+		}
+	}
+
+	return flush()
+}
+
+// onlyComments reports whether sql has no statement, which some drivers
+// refuse to run.
+func onlyComments(sql string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// verify refuses to migrate when an applied migration was edited or removed,
+// since the schema would no longer match the files.
+func (m *Migrator) verify(applied map[int64]appliedMigration) error {
+	for _, status := range m.status(applied) {
+		switch status.State {
+		case MigrationModified:
+			return fmt.Errorf("migration %q was modified after it was applied", status.Name)
+		case MigrationMissing:
+			return fmt.Errorf("migration %q was applied but its file is missing", status.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) status(applied map[int64]appliedMigration) []MigrationStatus {
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name, State: MigrationPending}
+		if row, ok := applied[migration.Version]; ok {
+			status.State = MigrationApplied
+			status.AppliedAt = &row.AppliedAt
+			if row.Checksum != migration.Checksum {
+				status.State = MigrationModified
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, row := range applied {
+		if m.find(row.Version) == nil {
+			statuses = append(statuses, MigrationStatus{Version: row.Version, Name: row.Name, State: MigrationMissing, AppliedAt: &row.AppliedAt})
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses
+}
+
+// applied reads schema_migrations. Before it exists, which only happens
+// without writes (status and dry runs), the legacy table stands in for it.
+func (m *Migrator) applied(conn *gorm.DB) (map[int64]appliedMigration, error) {
+	if !conn.Migrator().HasTable("schema_migrations") {
+		return m.legacyApplied(conn)
+	}
+
+	rows, err := conn.Raw(`SELECT version, name, checksum, applied_at FROM schema_migrations`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]appliedMigration{}
+	for rows.Next() {
+		var row appliedMigration
+		if err := rows.Scan(&row.Version, &row.Name, &row.Checksum, &row.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[row.Version] = row
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) latest() int64 {
+	if len(m.migrations) == 0 {
+		return -1
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func appliedVersions(applied map[int64]appliedMigration) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// withLock runs fn on a single connection holding the migration lock. When
+// fn writes, schema_migrations is created first. SQLite needs no advisory
+// lock: its transactions take the database write lock.
+func (m *Migrator) withLock(ctx context.Context, write bool, fn func(conn *gorm.DB) error) error {
+	return m.db.Db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if conn.Dialector.Name() == "postgres" {
+			var locked bool
+			if err := conn.Raw(`SELECT pg_try_advisory_lock(?)`, migrationLockKey).Scan(&locked).Error; err != nil {
+				return err
+			}
+			if !locked {
+				log.Printf("waiting for another instance to finish migrating")
+				if err := conn.Exec(`SELECT pg_advisory_lock(?)`, migrationLockKey).Error; err != nil {
+					return err
+				}
+			}
+			defer conn.Exec(`SELECT pg_advisory_unlock(?)`, migrationLockKey)
+		}
+
+		if write {
+			if err := m.prepare(conn); err != nil {
+				return err
+			}
+		}
+
+		return fn(conn)
+	})
+}
+
+// prepare creates schema_migrations. Databases migrated before it existed
+// list applied files in the legacy migrations table; those are imported once,
+// with the checksum of the current files, when schema_migrations is created.
+// The legacy table is kept so an older binary does not see an empty table and
+// re-run every migration.
+func (m *Migrator) prepare(conn *gorm.DB) error {
+	if conn.Migrator().HasTable("schema_migrations") {
+		return nil
+	}
+
+	legacy, err := m.legacyApplied(conn)
+	if err != nil {
+		return err
+	}
+
+	return conn.Transaction(func(tx *gorm.DB) error {
+		query := `CREATE TABLE schema_migrations (
+			version bigint PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			checksum char(64) NOT NULL,
+			applied_at timestamp NOT NULL
+		)`
+		if err := tx.Exec(query).Error; err != nil {
+			return fmt.Errorf("cannot create schema_migrations table: %w", err)
+		}
+
+		for _, row := range legacy {
+			query := `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?,?,?,?)`
+			if err := tx.Exec(query, row.Version, row.Name, row.Checksum, row.AppliedAt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// legacyApplied reads the migrations table of the previous, forward-only
+// migrator, which recorded file paths such as migration/00000005.sql.
+func (m *Migrator) legacyApplied(conn *gorm.DB) (map[int64]appliedMigration, error) {
+	applied := map[int64]appliedMigration{}
+	if !conn.Migrator().HasTable("migrations") {
+		return applied, nil
+	}
+
+	var names []string
+	if err := conn.Raw(`SELECT name FROM migrations`).Scan(&names).Error; err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		version, err := strconv.ParseInt(strings.TrimSuffix(path.Base(name), ".sql"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("legacy migration %q: %w", name, err)
+		}
+
+		migration := m.find(version)
+		if migration == nil {
+			return nil, fmt.Errorf("legacy migration %q has no file", name)
+		}
+
+		applied[version] = appliedMigration{Version: version, Name: migration.Name, Checksum: migration.Checksum, AppliedAt: time.Now()}
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,324 @@
+package sqldb
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// testMigrations creates one table per migration.
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"00000001.up.sql":   {Data: []byte("CREATE TABLE a (id integer);")},
+		"00000001.down.sql": {Data: []byte("DROP TABLE a;")},
+		"00000002.up.sql":   {Data: []byte("CREATE TABLE b (id integer);")},
+		"00000002.down.sql": {Data: []byte("DROP TABLE b;")},
+		"00000003.up.sql":   {Data: []byte("CREATE TABLE c (id integer);")},
+		"00000003.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+}
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_txlock=immediate"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return &Database{Db: db, Timeout: 5 * time.Second}
+}
+
+func newTestMigrator(t *testing.T, db *Database, migrations fstest.MapFS) *Migrator {
+	t.Helper()
+
+	m, err := NewMigrator(db, migrations)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	return m
+}
+
+// wantTables checks which of the tables a, b and c exist.
+func wantTables(t *testing.T, db *Database, want ...string) {
+	t.Helper()
+
+	for _, table := range []string{"a", "b", "c"} {
+		exists := slices.Contains(want, table)
+		if db.Db.Migrator().HasTable(table) != exists {
+			t.Fatalf("table %s exists = %v; want %v", table, !exists, exists)
+		}
+	}
+}
+
+// wantApplied checks the versions recorded in schema_migrations.
+func wantApplied(t *testing.T, db *Database, want ...int64) {
+	t.Helper()
+
+	var versions []int64
+	if err := db.Db.Raw(`SELECT version FROM schema_migrations ORDER BY version`).Scan(&versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("applied versions = %v; want %v", versions, want)
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Fatalf("applied versions = %v; want %v", versions, want)
+		}
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, db *Database)
+	}{
+		{
+			name: "up applies every migration",
+			test: func(t *testing.T, db *Database) {
+				m := newTestMigrator(t, db, testMigrations())
+				if err := m.Up(ctx); err != nil {
+					t.Fatalf("Up: %v", err)
+				}
+				wantTables(t, db, "a", "b", "c")
+				wantApplied(t, db, 1, 2, 3)
+
+				if pending, err := m.Pending(ctx); err != nil || pending != 0 {
+					t.Fatalf("Pending = %d, %v; want 0", pending, err)
+				}
+			},
+		},
+		{
+			name: "down rolls back the last steps",
+			test: func(t *testing.T, db *Database) {
+				m := newTestMigrator(t, db, testMigrations())
+				if err := m.Up(ctx); err != nil {
+					t.Fatalf("Up: %v", err)
+				}
+				if err := m.Down(ctx, 2); err != nil {
+					t.Fatalf("Down: %v", err)
+				}
+				wantTables(t, db, "a")
+				wantApplied(t, db, 1)
+
+				// More steps than applied migrations rolls back every one.
+				if err := m.Down(ctx, 5); err != nil {
+					t.Fatalf("Down: %v", err)
+				}
+				wantTables(t, db)
+				wantApplied(t, db)
+			},
+		},
+		{
+			name: "to moves up and down",
+			test: func(t *testing.T, db *Database) {
+				m := newTestMigrator(t, db, testMigrations())
+				for _, step := range []struct {
+					version int64
+					tables  []string
+				}{
+					{2, []string{"a", "b"}},
+					{3, []string{"a", "b", "c"}},
+					{1, []string{"a"}},
+					{-1, nil},
+				} {
+					if err := m.To(ctx, step.version); err != nil {
+						t.Fatalf("To(%d): %v", step.version, err)
+					}
+					wantTables(t, db, step.tables...)
+				}
+
+				if err := m.To(ctx, 4); err == nil {
+					t.Fatal("To(4) = nil; want an error for an unknown version")
+				}
+			},
+		},
+		{
+			name: "dry run prints the SQL without running it",
+			test: func(t *testing.T, db *Database) {
+				m := newTestMigrator(t, db, testMigrations())
+				var output bytes.Buffer
+				m.DryRun, m.Output = true, &output
+
+				if err := m.Up(ctx); err != nil {
+					t.Fatalf("Up: %v", err)
+				}
+				wantTables(t, db)
+				if db.Db.Migrator().HasTable("schema_migrations") {
+					t.Fatal("schema_migrations created by a dry run")
+				}
+				if !strings.Contains(output.String(), "-- 00000002.up.sql\nCREATE TABLE b (id integer);") {
+					t.Fatalf("dry run output = %q; want the up files", output.String())
+				}
+			},
+		},
+		{
+			name: "edited migration is refused",
+			test: func(t *testing.T, db *Database) {
+				if err := newTestMigrator(t, db, testMigrations()).To(ctx, 2); err != nil {
+					t.Fatalf("To: %v", err)
+				}
+
+				migrations := testMigrations()
+				migrations["00000001.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE a (id integer, name text);")}
+				m := newTestMigrator(t, db, migrations)
+
+				statuses, err := m.Status(ctx)
+				if err != nil || statuses[0].State != MigrationModified || statuses[2].State != MigrationPending {
+					t.Fatalf("Status = %+v, %v; want 00000001 modified", statuses, err)
+				}
+				for name, migrate := range map[string]func() error{
+					"Up":   func() error { return m.Up(ctx) },
+					"Down": func() error { return m.Down(ctx, 1) },
+					"To":   func() error { return m.To(ctx, 1) },
+				} {
+					if err := migrate(); err == nil || !strings.Contains(err.Error(), "modified") {
+						t.Fatalf("%s = %v; want the checksum mismatch refused", name, err)
+					}
+				}
+				wantTables(t, db, "a", "b")
+			},
+		},
+		{
+			name: "applied migration without a file is refused",
+			test: func(t *testing.T, db *Database) {
+				if err := newTestMigrator(t, db, testMigrations()).Up(ctx); err != nil {
+					t.Fatalf("Up: %v", err)
+				}
+
+				migrations := testMigrations()
+				delete(migrations, "00000003.up.sql")
+				delete(migrations, "00000003.down.sql")
+				if err := newTestMigrator(t, db, migrations).Down(ctx, 1); err == nil || !strings.Contains(err.Error(), "missing") {
+					t.Fatalf("Down = %v; want the missing file refused", err)
+				}
+				wantTables(t, db, "a", "b", "c")
+			},
+		},
+		{
+			name: "legacy migrations are imported",
+			test: func(t *testing.T, db *Database) {
+				// The previous migrator applied the first two files.
+				for _, query := range []string{
+					`CREATE TABLE migrations (name varchar(255))`,
+					`INSERT INTO migrations (name) VALUES ('migration/00000001.sql'), ('migration/00000002.sql')`,
+					`CREATE TABLE a (id integer)`,
+					`CREATE TABLE b (id integer)`,
+				} {
+					if err := db.Db.Exec(query).Error; err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				m := newTestMigrator(t, db, testMigrations())
+				if pending, err := m.Pending(ctx); err != nil || pending != 1 {
+					t.Fatalf("Pending = %d, %v; want 1", pending, err)
+				}
+				if err := m.Up(ctx); err != nil {
+					t.Fatalf("Up: %v", err)
+				}
+				wantTables(t, db, "a", "b", "c")
+				wantApplied(t, db, 1, 2, 3)
+
+				if !db.Db.Migrator().HasTable("migrations") {
+					t.Fatal("legacy migrations table dropped; older binaries would re-run every migration")
+				}
+			},
+		},
+		{
+			name: "legacy migration without a file is refused",
+			test: func(t *testing.T, db *Database) {
+				for _, query := range []string{
+					`CREATE TABLE migrations (name varchar(255))`,
+					`INSERT INTO migrations (name) VALUES ('migration/00000009.sql')`,
+				} {
+					if err := db.Db.Exec(query).Error; err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if err := newTestMigrator(t, db, testMigrations()).Up(ctx); err == nil {
+					t.Fatal("Up = nil; want an error for the unknown legacy migration")
+				}
+				wantTables(t, db)
+			},
+		},
+		{
+			name: "step runs between the statements around it",
+			test: func(t *testing.T, db *Database) {
+				migrations := testMigrations()
+				migrations["00000002.up.sql"] = &fstest.MapFile{Data: []byte("-- b is filled by a step.\nCREATE TABLE b (id integer);\n\n-- step: fill b\n\nINSERT INTO a SELECT id FROM b;\n")}
+				m := newTestMigrator(t, db, migrations)
+				m.AddStep("fill b", func(tx *gorm.DB) error {
+					return tx.Exec(`INSERT INTO b (id) VALUES (1), (2)`).Error
+				})
+
+				if err := m.To(ctx, 2); err != nil {
+					t.Fatalf("To: %v", err)
+				}
+				var count int64
+				if err := db.Db.Raw(`SELECT COUNT(*) FROM a`).Scan(&count).Error; err != nil || count != 2 {
+					t.Fatalf("rows copied after the step = %d, %v; want 2", count, err)
+				}
+			},
+		},
+		{
+			name: "unknown step rolls the migration back",
+			test: func(t *testing.T, db *Database) {
+				migrations := testMigrations()
+				migrations["00000002.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE b (id integer);\n-- step: missing\n")}
+
+				if err := newTestMigrator(t, db, migrations).Up(ctx); err == nil || !strings.Contains(err.Error(), "missing") {
+					t.Fatalf("Up = %v; want the unknown step refused", err)
+				}
+				wantTables(t, db, "a")
+				wantApplied(t, db, 1)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newTestDatabase(t))
+		})
+	}
+}
+
+func TestNewMigratorRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"no up file", fstest.MapFS{"00000001.down.sql": {Data: []byte("DROP TABLE a;")}}},
+		{"no direction", fstest.MapFS{"00000001.sql": {Data: []byte("CREATE TABLE a (id integer);")}}},
+		{"no version", fstest.MapFS{"create_a.up.sql": {Data: []byte("CREATE TABLE a (id integer);")}}},
+		{"version used twice", fstest.MapFS{
+			"00000001_a.up.sql": {Data: []byte("CREATE TABLE a (id integer);")},
+			"00000001_b.up.sql": {Data: []byte("CREATE TABLE b (id integer);")},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewMigrator(newTestDatabase(t), test.files); err == nil {
+				t.Fatal("NewMigrator = nil; want an error")
+			}
+		})
+	}
+}
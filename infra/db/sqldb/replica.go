@@ -0,0 +1,170 @@
+package sqldb
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// replicaLagQuery returns whether a Postgres standby has lost its WAL
+// receiver and how far it is behind, in seconds. A standby that replayed
+// everything it received is not lagging even if the last transaction is old,
+// but only while it is still receiving: a disconnected one has replayed all it
+// got and falls behind silently. The receiver status is hidden from roles
+// without pg_read_all_stats, so a running receiver counts as streaming then.
+// A server that is not a standby reports 0.
+const replicaLagQuery = `SELECT pg_is_in_recovery() AND NOT EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming'),
+	COALESCE(CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) END, 0)`
+
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+func (r *replica) setHealthy(healthy bool, reason string) {
+	if r.healthy.Swap(healthy) != healthy {
+		if healthy {
+			log.Printf("read replica %s is back", r.name)
+		} else {
+			log.Printf("read replica %s is down, reading from the primary: %s", r.name, reason)
+		}
+	}
+}
+
+// AddReplica registers a read replica. It is not used until MonitorReplicas
+// has found it healthy.
+func (d *Database) AddReplica(name string, db *gorm.DB) {
+	d.replicas = append(d.replicas, &replica{name: name, db: db})
+}
+
+// MonitorReplicas checks every replica now and then every interval. A replica
+// is healthy while it answers and lags less than maxLag. Keys written
+// recently keep reading from the primary for maxLag plus interval, after
+// which any healthy replica has the write.
+func (d *Database) MonitorReplicas(interval time.Duration, maxLag time.Duration) {
+	if len(d.replicas) == 0 {
+		return
+	}
+
+	d.stickiness = maxLag + interval
+	d.checkReplicas(maxLag)
+
+	go func() {
+		for range time.Tick(interval) {
+			d.checkReplicas(maxLag)
+
+			d.written.Range(func(key, at any) bool {
+				if time.Since(at.(time.Time)) > d.stickiness {
+					d.written.Delete(key)
+				}
+				return true
+			})
+		}
+	}()
+}
+
+func (d *Database) checkReplicas(maxLag time.Duration) {
+	for _, replica := range d.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout)
+
+		var disconnected bool
+		var lag float64
+		err := replica.db.WithContext(ctx).Raw(replicaLagQuery).Row().Scan(&disconnected, &lag)
+		cancel()
+
+		if err != nil {
+			replica.setHealthy(false, err.Error())
+		} else if disconnected {
+			replica.setHealthy(false, "not streaming from the primary")
+		} else if time.Duration(lag*float64(time.Second)) > maxLag {
+			replica.setHealthy(false, "replication lag "+time.Duration(lag*float64(time.Second)).Round(time.Millisecond).String())
+		} else {
+			replica.setHealthy(true, "")
+		}
+	}
+}
+
+// OnWritten registers fn to be called with the keys passed to Written, so
+// they can be sent to the other instances, whose reads of them must stay on
+// the primary too. It must be called before the first write.
+func (d *Database) OnWritten(fn func(keys ...string)) {
+	d.onWritten = fn
+}
+
+// Written records that keys just changed, so reads of them stay on the
+// primary until every healthy replica has the change.
+func (d *Database) Written(keys ...string) {
+	if len(d.replicas) == 0 {
+		return
+	}
+
+	d.WrittenElsewhere(keys...)
+
+	if d.onWritten != nil {
+		d.onWritten(keys...)
+	}
+}
+
+// WrittenElsewhere records keys that another instance changed, like Written
+// but without calling the OnWritten function again.
+func (d *Database) WrittenElsewhere(keys ...string) {
+	if len(d.replicas) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		d.written.Store(key, now)
+	}
+}
+
+// Read runs fn on a healthy replica, or on the primary when there is none,
+// key was written recently or ctx is in a transaction. If fn fails on the replica, or asks to retry
+// because a replica result may be stale (e.g. a row not found that may just
+// not be replicated yet), it runs again on the primary.
+func (d *Database) Read(ctx context.Context, key string, fn func(db *gorm.DB) (retry bool, err error)) error {
+	if replica := d.replica(ctx, key); replica != nil {
+		rctx, cancel := context.WithTimeout(ctx, d.Timeout)
+		retry, err := fn(replica.db.WithContext(rctx))
+		cancel()
+
+		if err == nil && !retry {
+			return nil
+		} else if err != nil && ctx.Err() != nil {
+			return err
+		} else if err != nil {
+			replica.setHealthy(false, err.Error())
+		}
+	}
+
+	db, cancel := d.WithContext(ctx)
+	defer cancel()
+
+	_, err := fn(db)
+	return err
+}
+
+func (d *Database) replica(ctx context.Context, key string) *replica {
+	if len(d.replicas) == 0 || ctx.Value(txKey{}) != nil {
+		return nil
+	}
+
+	if at, ok := d.written.Load(key); ok && time.Since(at.(time.Time)) <= d.stickiness {
+		return nil
+	}
+
+	start := d.next.Add(1)
+	for i := range d.replicas {
+		replica := d.replicas[(start+uint64(i))%uint64(len(d.replicas))]
+		if replica.healthy.Load() {
+			return replica
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package sqldb
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Database is a GORM connection shared by the SQL backends (Postgres and
+// SQLite). Queries use `?` placeholders so GORM binds them for either one.
+type Database struct {
+	Db *gorm.DB
+	// Timeout bounds every query on top of the caller's context.
+	Timeout time.Duration
+
+	// Read replicas, used by Read. Only the Postgres backend has any.
+	replicas   []*replica
+	next       atomic.Uint64
+	stickiness time.Duration
+	written    sync.Map
+	onWritten  func(keys ...string)
+}
+
+// txKey holds the transaction started by Transaction in a context.
+type txKey struct{}
+
+// WithContext returns a session bound to ctx and limited to Timeout, in the
+// transaction of ctx if there is one. The cancel function must be called once
+// the results have been read.
+func (d *Database) WithContext(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx), cancel
+	}
+	return d.Db.WithContext(ctx), cancel
+}
+
+// Transaction runs fn in a transaction. Repository methods called with the
+// context fn gets run in it too, so changes spanning several repositories
+// commit or roll back together. Their own transactions become savepoints, as
+// does Transaction called with a context already in one.
+func (d *Database) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	db := d.Db
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		db = tx
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// Contains returns a pattern matching text anywhere, for `LIKE ? ESCAPE '\'`.
+// Wildcards in text match themselves. Patterns are lowercased, so compare
+// them with LOWER(column): LIKE is case-sensitive on Postgres.
+func Contains(text string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(text))
+	return "%" + escaped + "%"
+}
+
+// ForUpdate returns the clause that locks the rows read by a SELECT until the
+// end of the transaction. SQLite has none and needs none: its transactions
+// take the write lock when they begin (_txlock=immediate), so they run one at
+// a time.
+func ForUpdate(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return " FOR UPDATE"
+	}
+	return ""
+}
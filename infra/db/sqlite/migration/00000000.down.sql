@@ -0,0 +1,7 @@
+DROP TABLE url_click_flushes;
+DROP TABLE url_clicks_daily;
+DROP TABLE url_transfer_items;
+DROP TABLE url_transfers;
+DROP TABLE url_shortening_history;
+DROP TABLE url_shortening;
+DROP TABLE users;
@@ -0,0 +1,80 @@
+-- SQLite schema, equivalent to the Postgres migrations up to 00000009.
+CREATE TABLE users (
+  id varchar(255) PRIMARY KEY,
+  name varchar(255) NOT NULL,
+  email varchar(255) NOT NULL UNIQUE,
+  password varchar(255) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE url_shortening (
+  id varchar(255) PRIMARY KEY,
+  id_user varchar(255) NOT NULL,
+  url_original text NOT NULL,
+  url_shortened varchar(255) NOT NULL UNIQUE,
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  slug varchar(255) NOT NULL UNIQUE,
+  url_canonical text NOT NULL,
+  url_canonical_hash char(64) NOT NULL,
+  deleted_at timestamp NULL,
+  clicks bigint NOT NULL DEFAULT 0,
+
+  FOREIGN KEY (id_user) REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX id_user_url_canonical_hash_unique ON url_shortening (id_user, url_canonical_hash) WHERE deleted_at IS NULL;
+
+CREATE TABLE url_shortening_history (
+  id varchar(255) PRIMARY KEY,
+  id_url varchar(255) NOT NULL,
+  id_user varchar(255) NOT NULL,
+  action varchar(32) NOT NULL,
+  old_value text NULL,
+  new_value text NULL,
+  client_ip varchar(64) NOT NULL DEFAULT '',
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (id_url) REFERENCES url_shortening(id)
+);
+
+CREATE INDEX url_shortening_history_id_url_idx ON url_shortening_history (id_url, created_at);
+
+CREATE TABLE url_transfers (
+  id varchar(255) PRIMARY KEY,
+  id_user_from varchar(255) NOT NULL,
+  id_user_to varchar(255) NOT NULL,
+  status varchar(32) NOT NULL DEFAULT 'pending',
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (id_user_from) REFERENCES users(id),
+  FOREIGN KEY (id_user_to) REFERENCES users(id)
+);
+
+CREATE INDEX url_transfers_id_user_from_idx ON url_transfers (id_user_from, status);
+CREATE INDEX url_transfers_id_user_to_idx ON url_transfers (id_user_to, status);
+
+CREATE TABLE url_transfer_items (
+  id_transfer varchar(255) NOT NULL,
+  id_url varchar(255) NOT NULL,
+
+  PRIMARY KEY (id_transfer, id_url),
+  FOREIGN KEY (id_transfer) REFERENCES url_transfers(id),
+  FOREIGN KEY (id_url) REFERENCES url_shortening(id)
+);
+
+CREATE TABLE url_clicks_daily (
+  id_url varchar(255) NOT NULL,
+  day date NOT NULL,
+  clicks bigint NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (id_url, day),
+  FOREIGN KEY (id_url) REFERENCES url_shortening(id)
+);
+
+CREATE TABLE url_click_flushes (
+  id varchar(255) PRIMARY KEY,
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- The plan of a user selects how long the click counts of their links are
+-- kept. SQLite has no partitions, so expired counts are deleted row by row.
+ALTER TABLE users ADD COLUMN plan varchar(32) NOT NULL DEFAULT 'free';
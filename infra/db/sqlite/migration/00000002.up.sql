@@ -0,0 +1,18 @@
+-- API keys for programmatic access. Only the SHA-256 of a key is stored; the
+-- prefix is kept in clear so users can tell their keys apart. scopes is a
+-- space separated list, e.g. 'links:read links:write'.
+CREATE TABLE api_keys (
+  id varchar(255) PRIMARY KEY,
+  id_user varchar(255) NOT NULL,
+  name varchar(255) NOT NULL,
+  prefix varchar(32) NOT NULL,
+  key_hash char(64) NOT NULL UNIQUE,
+  scopes text NOT NULL,
+  expires_at timestamp NULL,
+  last_used_at timestamp NULL,
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (id_user) REFERENCES users(id)
+);
+
+CREATE INDEX api_keys_id_user_idx ON api_keys (id_user);
@@ -0,0 +1 @@
+DROP INDEX url_shortening_updated_at;
@@ -0,0 +1,3 @@
+-- The slug filter of every instance looks up the links changed in the last
+-- minute or so, in case the broadcast of a new slug was lost.
+CREATE INDEX url_shortening_updated_at ON url_shortening (updated_at);
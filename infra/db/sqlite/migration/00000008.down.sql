@@ -0,0 +1,3 @@
+DROP INDEX url_transfers_delete_sender_idx;
+
+ALTER TABLE url_transfers DROP COLUMN delete_sender;
@@ -0,0 +1,5 @@
+-- A transfer made to delete an account deletes its sender once accepted,
+-- declined or expired.
+ALTER TABLE url_transfers ADD COLUMN delete_sender boolean NOT NULL DEFAULT false;
+
+CREATE INDEX url_transfers_delete_sender_idx ON url_transfers (status, created_at) WHERE delete_sender;
@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"embed"
+	"io/fs"
+	"strings"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/sqldb"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// pragmas make SQLite behave under concurrent requests: foreign keys are
+// enforced, readers do not block the writer, and transactions take the write
+// lock up front and wait for it instead of failing with SQLITE_BUSY.
+const pragmas = "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite"
+
+//go:embed migration/*.sql
+var migrationFS embed.FS
+
+// NewSQLite opens the database file named by DB_DATA_SOURCE, creating it if
+// needed, so the service can run as a single binary without a database
+// server.
+func NewSQLite(config *environment.Config) (*sqldb.Database, error) {
+	dataSource := config.DB.DataSource
+	if strings.Contains(dataSource, "?") {
+		dataSource += "&" + pragmas
+	} else {
+		dataSource += "?" + pragmas
+	}
+
+	db, err := gorm.Open(sqlite.Open(dataSource), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqldb.Database{Db: db, Timeout: config.DB.Timeout}, nil
+}
+
+// Migrations returns the embedded SQLite schema migrations.
+func Migrations() fs.FS {
+	migrations, _ := fs.Sub(migrationFS, "migration")
+	return migrations
+}
@@ -0,0 +1,220 @@
+package lockout
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/redis"
+	"url_shortening/pkg/projectError"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Failed sign-ins of an account or IP are counted in the hash
+// keyPrefix+kind+":"+id, with the time of the last failure and, once locked,
+// the end of the lock. The key expires with the window that started at the
+// first failure, or with the lock, so counts start over afterwards.
+const keyPrefix = "login_failures:"
+
+// Kinds of subjects whose failures are counted.
+const (
+	KindAccount = "account"
+	KindIP      = "ip"
+)
+
+// baseDelay is the wait after the first failure past the free attempts. It
+// doubles with every further failure.
+const baseDelay = time.Second
+
+// failScript counts a failure and locks the subject once it reaches the
+// threshold. It returns 1 if this failure locked it, so the lock is reported
+// once even when failures race.
+var failScript = goredis.NewScript(`
+local count = redis.call('HINCRBY', KEYS[1], 'count', 1)
+redis.call('HSET', KEYS[1], 'last', ARGV[1])
+if count == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+local threshold = tonumber(ARGV[3])
+if threshold > 0 and count >= threshold and redis.call('HEXISTS', KEYS[1], 'locked_until') == 0 then
+  redis.call('HSET', KEYS[1], 'locked_until', tonumber(ARGV[1]) + tonumber(ARGV[4]))
+  redis.call('PEXPIRE', KEYS[1], ARGV[4])
+  return 1
+end
+return 0
+`)
+
+// Status is the failure record of an account or IP.
+type Status struct {
+	Failures    int
+	LastFailure time.Time
+	// LockedUntil is zero unless the subject is locked.
+	LockedUntil time.Time
+}
+
+// Guard slows down and locks sign-ins after repeated failures. Failures of
+// an account make its next attempts wait longer and longer, then lock it.
+// Failures from an IP only lock it past a higher threshold, as many users
+// may share an address. The counts live in Redis so every instance sees them.
+type Guard struct {
+	redis            *redis.Redis
+	accountThreshold int
+	ipThreshold      int
+	window           time.Duration
+	duration         time.Duration
+	delayAfter       int
+	maxDelay         time.Duration
+}
+
+func NewGuard(redis *redis.Redis, config *environment.Config) *Guard {
+	return &Guard{
+		redis:            redis,
+		accountThreshold: config.LOCKOUT.AccountThreshold,
+		ipThreshold:      config.LOCKOUT.IPThreshold,
+		window:           config.LOCKOUT.Window,
+		duration:         config.LOCKOUT.Duration,
+		delayAfter:       config.LOCKOUT.DelayAfter,
+		maxDelay:         config.LOCKOUT.MaxDelay,
+	}
+}
+
+// Check returns how long a sign-in to email from ip must wait, zero if it
+// may proceed. Unknown emails are tracked like existing ones, so a lock does
+// not reveal whether an account exists.
+func (g *Guard) Check(ctx context.Context, email string, ip string) (time.Duration, error) {
+	ctx, cancel := g.redis.WithTimeout(ctx)
+	defer cancel()
+
+	// One command per key: on Redis Cluster they live in different slots.
+	var account, address *goredis.SliceCmd
+	_, err := g.redis.Client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		account = pipe.HMGet(ctx, key(KindAccount, email), statusFields...)
+		address = pipe.HMGet(ctx, key(KindIP, ip), statusFields...)
+		return nil
+	})
+	if err != nil {
+		return 0, unavailable(err)
+	}
+
+	now := time.Now()
+	return max(g.wait(parseStatus(account.Val()), now), lockedFor(parseStatus(address.Val()), now)), nil
+}
+
+// wait returns how long an account with status must wait at now.
+func (g *Guard) wait(status Status, now time.Time) time.Duration {
+	if locked := lockedFor(status, now); locked > 0 {
+		return locked
+	}
+
+	if status.Failures < g.delayAfter || status.Failures == 0 {
+		return 0
+	}
+
+	delay := g.maxDelay
+	if shift := status.Failures - g.delayAfter; shift < 30 {
+		delay = min(baseDelay<<shift, g.maxDelay)
+	}
+
+	return max(status.LastFailure.Add(delay).Sub(now), 0)
+}
+
+// Fail records a failed sign-in to email from ip. It reports whether the
+// account got locked by this failure, so the owner can be told once.
+func (g *Guard) Fail(ctx context.Context, email string, ip string) (bool, error) {
+	ctx, cancel := g.redis.WithTimeout(ctx)
+	defer cancel()
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	locked, err := failScript.Run(ctx, g.redis.Client, []string{key(KindAccount, email)}, now, g.window.Milliseconds(), g.accountThreshold, g.duration.Milliseconds()).Int()
+	if err != nil {
+		return false, unavailable(err)
+	}
+
+	ipLocked, err := failScript.Run(ctx, g.redis.Client, []string{key(KindIP, ip)}, now, g.window.Milliseconds(), g.ipThreshold, g.duration.Milliseconds()).Int()
+	if err != nil {
+		return false, unavailable(err)
+	}
+
+	if locked == 1 {
+		log.Printf("sign-in locked for account %s after failures, last from %s", email, ip)
+	}
+	if ipLocked == 1 {
+		log.Printf("sign-in locked for ip %s after failures", ip)
+	}
+
+	return locked == 1, nil
+}
+
+// Succeed forgets the failures of email after a completed sign-in. Failures
+// of the IP are kept, otherwise signing in to one's own account would hide
+// guesses against others.
+func (g *Guard) Succeed(ctx context.Context, email string) error {
+	return g.Unlock(ctx, KindAccount, email)
+}
+
+// Unlock forgets the failures and lock of an account or IP.
+func (g *Guard) Unlock(ctx context.Context, kind string, id string) error {
+	ctx, cancel := g.redis.WithTimeout(ctx)
+	defer cancel()
+
+	if err := g.redis.Client.Del(ctx, key(kind, id)).Err(); err != nil {
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+// Status returns the failure record of an account or IP.
+func (g *Guard) Status(ctx context.Context, kind string, id string) (Status, error) {
+	ctx, cancel := g.redis.WithTimeout(ctx)
+	defer cancel()
+
+	values, err := g.redis.Client.HMGet(ctx, key(kind, id), statusFields...).Result()
+	if err != nil {
+		return Status{}, unavailable(err)
+	}
+
+	return parseStatus(values), nil
+}
+
+func lockedFor(status Status, now time.Time) time.Duration {
+	return max(status.LockedUntil.Sub(now), 0)
+}
+
+var statusFields = []string{"count", "last", "locked_until"}
+
+func parseStatus(values []any) Status {
+	fields := make([]int64, len(values))
+	for i, value := range values {
+		text, _ := value.(string)
+		fields[i], _ = strconv.ParseInt(text, 10, 64)
+	}
+
+	status := Status{Failures: int(fields[0]), LastFailure: time.UnixMilli(fields[1])}
+	if fields[2] > 0 {
+		status.LockedUntil = time.UnixMilli(fields[2])
+	}
+
+	return status
+}
+
+// key returns the Redis key of a subject. Emails are lowercased so their
+// spelling cannot be varied to get fresh attempts.
+func key(kind string, id string) string {
+	if kind == KindAccount {
+		id = strings.ToLower(strings.TrimSpace(id))
+	}
+	return keyPrefix + kind + ":" + id
+}
+
+func unavailable(err error) error {
+	if projectError.ErrorCode(err) != projectError.EINTERNAL {
+		return err
+	}
+	log.Printf("lockout store: %v", err)
+	return projectError.Errorf(projectError.EUNAVAILABLE, "Sign-in temporarily unavailable, try again later")
+}
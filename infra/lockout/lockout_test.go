@@ -0,0 +1,222 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/redis"
+	"url_shortening/pkg/projectError"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func testConfig() *environment.Config {
+	config := &environment.Config{}
+	config.LOCKOUT.AccountThreshold = 3
+	config.LOCKOUT.IPThreshold = 5
+	config.LOCKOUT.Window = 15 * time.Minute
+	config.LOCKOUT.Duration = time.Hour
+	config.LOCKOUT.DelayAfter = 2
+	config.LOCKOUT.MaxDelay = 4 * time.Second
+	return config
+}
+
+func newTestGuard(t *testing.T) (*Guard, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	return NewGuard(&redis.Redis{Client: client, Timeout: time.Second}, testConfig()), server
+}
+
+func fail(t *testing.T, g *Guard, email string, ip string) bool {
+	t.Helper()
+
+	locked, err := g.Fail(context.Background(), email, ip)
+	if err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+	return locked
+}
+
+func check(t *testing.T, g *Guard, email string, ip string) time.Duration {
+	t.Helper()
+
+	wait, err := g.Check(context.Background(), email, ip)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return wait
+}
+
+func TestAccountThreshold(t *testing.T) {
+	g, server := newTestGuard(t)
+
+	if wait := check(t, g, "ada@example.com", "1.1.1.1"); wait != 0 {
+		t.Fatalf("Check without failures = %v; want 0", wait)
+	}
+
+	for i := range 2 {
+		if fail(t, g, "ada@example.com", "1.1.1.1") {
+			t.Fatalf("failure %d locked the account; want the lock at 3", i+1)
+		}
+	}
+	if !fail(t, g, "Ada@Example.com ", "2.2.2.2") {
+		t.Fatal("third failure did not lock the account")
+	}
+	// The lock is reported once.
+	if fail(t, g, "ada@example.com", "3.3.3.3") {
+		t.Fatal("fourth failure reported the lock again")
+	}
+
+	wait := check(t, g, "ada@example.com", "4.4.4.4")
+	if wait <= 59*time.Minute || wait > time.Hour {
+		t.Fatalf("Check of the locked account = %v; want about an hour", wait)
+	}
+	if wait := check(t, g, "alan@example.com", "1.1.1.1"); wait != 0 {
+		t.Fatalf("Check of another account = %v; want 0", wait)
+	}
+
+	status, err := g.Status(context.Background(), KindAccount, "ada@example.com")
+	if err != nil || status.Failures != 4 || status.LockedUntil.IsZero() {
+		t.Fatalf("Status = %+v, %v; want 4 failures and locked", status, err)
+	}
+
+	// The key lives as long as the lock, then the account starts over.
+	if ttl := server.TTL(key(KindAccount, "ada@example.com")); ttl != time.Hour {
+		t.Fatalf("TTL of the locked account = %v; want the lock duration", ttl)
+	}
+	server.FastForward(time.Hour)
+	status, err = g.Status(context.Background(), KindAccount, "ada@example.com")
+	if err != nil || status.Failures != 0 || !status.LockedUntil.IsZero() {
+		t.Fatalf("Status after the lock = %+v, %v; want no failures", status, err)
+	}
+}
+
+func TestIPThreshold(t *testing.T) {
+	g, _ := newTestGuard(t)
+
+	// One failure per account, so only the IP reaches its threshold.
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		if fail(t, g, email, "1.1.1.1") {
+			t.Fatalf("failure of %s locked the account", email)
+		}
+	}
+
+	if wait := check(t, g, "f@example.com", "1.1.1.1"); wait <= 59*time.Minute {
+		t.Fatalf("Check from the locked ip = %v; want about an hour", wait)
+	}
+	if wait := check(t, g, "f@example.com", "2.2.2.2"); wait != 0 {
+		t.Fatalf("Check from another ip = %v; want 0", wait)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	g, server := newTestGuard(t)
+
+	fail(t, g, "ada@example.com", "1.1.1.1")
+	fail(t, g, "ada@example.com", "1.1.1.1")
+
+	// The window starts at the first failure and is not extended by later ones.
+	server.FastForward(15 * time.Minute)
+
+	if fail(t, g, "ada@example.com", "1.1.1.1") {
+		t.Fatal("failure after the window locked the account")
+	}
+	status, err := g.Status(context.Background(), KindAccount, "ada@example.com")
+	if err != nil || status.Failures != 1 {
+		t.Fatalf("Status = %+v, %v; want the count started over", status, err)
+	}
+}
+
+func TestWait(t *testing.T) {
+	g, _ := newTestGuard(t)
+	last := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name   string
+		status Status
+		now    time.Time
+		want   time.Duration
+	}{
+		{"no failures", Status{}, last, 0},
+		{"below the delay", Status{Failures: 1, LastFailure: last}, last, 0},
+		{"first delay", Status{Failures: 2, LastFailure: last}, last, time.Second},
+		{"delay doubles", Status{Failures: 3, LastFailure: last}, last, 2 * time.Second},
+		{"delay partly waited", Status{Failures: 3, LastFailure: last}, last.Add(1500 * time.Millisecond), 500 * time.Millisecond},
+		{"delay waited", Status{Failures: 3, LastFailure: last}, last.Add(2 * time.Second), 0},
+		{"delay capped", Status{Failures: 6, LastFailure: last}, last, 4 * time.Second},
+		{"delay capped without overflow", Status{Failures: 100, LastFailure: last}, last, 4 * time.Second},
+		{"locked", Status{Failures: 3, LastFailure: last, LockedUntil: last.Add(time.Hour)}, last.Add(time.Minute), 59 * time.Minute},
+		{"lock over", Status{Failures: 3, LastFailure: last, LockedUntil: last.Add(time.Hour)}, last.Add(time.Hour), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if wait := g.wait(test.status, test.now); wait != test.want {
+				t.Fatalf("wait = %v; want %v", wait, test.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	g, _ := newTestGuard(t)
+
+	fail(t, g, "ada@example.com", "1.1.1.1")
+	if wait := check(t, g, "ada@example.com", "1.1.1.1"); wait != 0 {
+		t.Fatalf("Check after one failure = %v; want 0", wait)
+	}
+
+	fail(t, g, "ada@example.com", "1.1.1.1")
+	if wait := check(t, g, "ada@example.com", "1.1.1.1"); wait <= 0 || wait > time.Second {
+		t.Fatalf("Check after two failures = %v; want up to a second", wait)
+	}
+	// The delay is per account, not per IP.
+	if wait := check(t, g, "ada@example.com", "2.2.2.2"); wait <= 0 {
+		t.Fatalf("Check from another ip = %v; want the account delay", wait)
+	}
+}
+
+func TestSucceed(t *testing.T) {
+	g, _ := newTestGuard(t)
+	ctx := context.Background()
+
+	for range 3 {
+		fail(t, g, "ada@example.com", "1.1.1.1")
+	}
+
+	if err := g.Succeed(ctx, " ADA@example.com"); err != nil {
+		t.Fatalf("Succeed: %v", err)
+	}
+	if wait := check(t, g, "ada@example.com", "2.2.2.2"); wait != 0 {
+		t.Fatalf("Check after Succeed = %v; want 0", wait)
+	}
+	if fail(t, g, "ada@example.com", "2.2.2.2") {
+		t.Fatal("first failure after Succeed locked the account")
+	}
+
+	// Failures of the IP are kept.
+	status, err := g.Status(ctx, KindIP, "1.1.1.1")
+	if err != nil || status.Failures != 3 {
+		t.Fatalf("Status of the ip = %+v, %v; want 3 failures kept", status, err)
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	g, server := newTestGuard(t)
+	server.Close()
+
+	_, err := g.Check(context.Background(), "ada@example.com", "1.1.1.1")
+	if projectError.ErrorCode(err) != projectError.EUNAVAILABLE {
+		t.Fatalf("Check = %v; want unavailable", err)
+	}
+	_, err = g.Fail(context.Background(), "ada@example.com", "1.1.1.1")
+	if projectError.ErrorCode(err) != projectError.EUNAVAILABLE {
+		t.Fatalf("Fail = %v; want unavailable", err)
+	}
+}
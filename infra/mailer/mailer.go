@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/pkg/cryptPkg"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer sends emails. SMTPMailer delivers them, LogMailer prints them and
+// FileMailer writes them to an outbox directory for tests to read.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var (
+	_ Mailer = (*SMTPMailer)(nil)
+	_ Mailer = (*LogMailer)(nil)
+	_ Mailer = (*FileMailer)(nil)
+)
+
+// NewMailer returns the Mailer selected by MAIL_DRIVER.
+func NewMailer(config *environment.Config) (Mailer, error) {
+	from, err := mail.ParseAddress(config.MAIL.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	switch config.MAIL.Driver {
+	case environment.MailDriverSMTP:
+		return NewSMTPMailer(from, config.MAIL.SMTPHost, config.MAIL.SMTPPort, config.MAIL.SMTPUsername, config.MAIL.SMTPPassword, config.MAIL.SMTPTLS), nil
+	case environment.MailDriverFile:
+		return NewFileMailer(from, config.MAIL.OutboxDir)
+	default:
+		return NewLogMailer(from), nil
+	}
+}
+
+// format renders message as an RFC 5322 email from from.
+func format(from *mail.Address, message Message) []byte {
+	var buffer bytes.Buffer
+
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	fmt.Fprintf(&buffer, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buffer, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buffer, "Message-ID: <%s@%s>\r\n", cryptPkg.RandomToken(16), domain)
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buffer.WriteString("\r\n")
+
+	text := strings.ReplaceAll(message.Text, "\r\n", "\n")
+	buffer.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+
+	return buffer.Bytes()
+}
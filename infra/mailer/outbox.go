@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+	"url_shortening/pkg/cryptPkg"
+)
+
+// LogMailer prints emails to stdout instead of sending them, for
+// development.
+type LogMailer struct {
+	from *mail.Address
+}
+
+func NewLogMailer(from *mail.Address) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	log.Printf("mail to %s: %s\n%s", message.To, message.Subject, message.Text)
+	return nil
+}
+
+// FileMailer writes every email to its own .eml file in an outbox
+// directory. Names start with the send time, so they sort in order.
+type FileMailer struct {
+	from *mail.Address
+	dir  string
+}
+
+// NewFileMailer returns a FileMailer writing to dir, which is created if
+// needed.
+func NewFileMailer(from *mail.Address, dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mail outbox: %w", err)
+	}
+	return &FileMailer{from: from, dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), cryptPkg.RandomToken(6))
+	return os.WriteFile(filepath.Join(m.dir, name), format(m.from, message), 0o644)
+}
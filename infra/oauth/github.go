@@ -0,0 +1,74 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"url_shortening/infra/config/environment"
+)
+
+const (
+	githubAuthorizeURL = "https://github.com/login/oauth/authorize"
+	githubTokenURL     = "https://github.com/login/oauth/access_token"
+	githubAPI          = "https://api.github.com"
+)
+
+// githubProvider signs users in with GitHub, which speaks plain OAuth2: the
+// user and their verified emails are read from the API.
+type githubProvider struct {
+	config      environment.OAuthProvider
+	redirectURL string
+	client      *http.Client
+}
+
+func (p *githubProvider) authorizeURL(ctx context.Context, params url.Values) (string, error) {
+	params.Del("nonce")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.redirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("allow_signup", "false")
+
+	return addParams(githubAuthorizeURL, params), nil
+}
+
+func (p *githubProvider) identify(ctx context.Context, code string, verifier string, nonce string) (Identity, error) {
+	token, err := exchangeCode(ctx, p.client, githubTokenURL, p.config, p.redirectURL, code, verifier)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, p.client, githubAPI+"/user", token.AccessToken, &user); err != nil {
+		return Identity{}, providerUnavailable(p.config.Name, err)
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.client, githubAPI+"/user/emails", token.AccessToken, &emails); err != nil {
+		return Identity{}, providerUnavailable(p.config.Name, err)
+	}
+
+	identity := Identity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	// Prefer the primary email, but only a verified one can link accounts.
+	for _, email := range emails {
+		if email.Verified && (email.Primary || identity.Email == "") {
+			identity.Email = email.Email
+			identity.EmailVerified = true
+		}
+	}
+
+	return identity, nil
+}
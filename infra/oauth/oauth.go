@@ -0,0 +1,237 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/redis"
+	"url_shortening/pkg/cryptPkg"
+	"url_shortening/pkg/projectError"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// statePrefix+state is the hash of a sign-in in progress: its provider, PKCE
+// verifier and OIDC nonce. It is deleted when the provider redirects back, so
+// every state is used at most once.
+const statePrefix = "oauth_state:"
+
+// Identity is a user as vouched for by a provider. Subject is the provider's
+// stable id for the user; emails can change.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// provider is an OAuth2 authorization server users sign in with.
+type provider interface {
+	// authorizeURL returns the url the browser is sent to, with params added.
+	authorizeURL(ctx context.Context, params url.Values) (string, error)
+	// identify exchanges an authorization code for the user it was issued to.
+	identify(ctx context.Context, code string, verifier string, nonce string) (Identity, error)
+}
+
+// Manager runs the authorization code flow, with PKCE, against the configured
+// providers. The state of each sign-in is kept in Redis so the callback can
+// land on any instance.
+type Manager struct {
+	redis     *redis.Redis
+	ttl       time.Duration
+	providers map[string]provider
+	names     []string
+}
+
+// NewManager returns a Manager for the providers in config. OIDC providers
+// are discovered on first use, so an unreachable provider does not prevent
+// startup.
+func NewManager(redis *redis.Redis, config *environment.Config) *Manager {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	m := &Manager{redis: redis, ttl: config.OAUTH.StateTTL, providers: map[string]provider{}}
+	for _, providerConfig := range config.OAUTH.Providers {
+		redirectURL := config.OAUTH.CallbackUrl + "/auth/oauth/" + providerConfig.Name + "/callback"
+
+		switch providerConfig.Kind {
+		case environment.OAuthKindGitHub:
+			m.providers[providerConfig.Name] = &githubProvider{config: providerConfig, redirectURL: redirectURL, client: client}
+		default:
+			m.providers[providerConfig.Name] = &oidcProvider{config: providerConfig, redirectURL: redirectURL, client: client}
+		}
+		m.names = append(m.names, providerConfig.Name)
+	}
+
+	return m
+}
+
+// Providers returns the names of the configured providers.
+func (m *Manager) Providers() []string {
+	return m.names
+}
+
+// Begin starts a sign-in with provider name. It returns the state, which the
+// caller binds to the browser, and the url to redirect the browser to.
+func (m *Manager) Begin(ctx context.Context, name string) (string, string, error) {
+	provider, ok := m.providers[name]
+	if !ok {
+		return "", "", projectError.Errorf(projectError.ENOTFOUND, "Unknown sign-in provider")
+	}
+
+	state := cryptPkg.RandomToken(24)
+	verifier := cryptPkg.RandomToken(32)
+	nonce := cryptPkg.RandomToken(24)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	authorizeURL, err := provider.authorizeURL(ctx, url.Values{
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	redisCtx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	_, err = m.redis.Client.TxPipelined(redisCtx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(redisCtx, statePrefix+state, "provider", name, "verifier", verifier, "nonce", nonce)
+		pipe.PExpire(redisCtx, statePrefix+state, m.ttl)
+		return nil
+	})
+	if err != nil {
+		return "", "", unavailable(err)
+	}
+
+	return state, authorizeURL, nil
+}
+
+// Complete finishes a sign-in with provider name and returns the identity
+// the authorization code was issued to.
+func (m *Manager) Complete(ctx context.Context, name string, state string, code string) (Identity, error) {
+	provider, ok := m.providers[name]
+	if !ok {
+		return Identity{}, projectError.Errorf(projectError.ENOTFOUND, "Unknown sign-in provider")
+	}
+
+	redisCtx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	var values *goredis.MapStringStringCmd
+	_, err := m.redis.Client.TxPipelined(redisCtx, func(pipe goredis.Pipeliner) error {
+		values = pipe.HGetAll(redisCtx, statePrefix+state)
+		pipe.Del(redisCtx, statePrefix+state)
+		return nil
+	})
+	if err != nil {
+		return Identity{}, unavailable(err)
+	}
+
+	saved := values.Val()
+	if saved["provider"] != name {
+		return Identity{}, projectError.Errorf(projectError.EUNAUTHORIZED, "Sign-in expired or already used, try again")
+	}
+
+	identity, err := provider.identify(ctx, code, saved["verifier"], saved["nonce"])
+	if err != nil {
+		return Identity{}, err
+	}
+
+	identity.Provider = name
+	return identity, nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode redeems an authorization code at the token endpoint.
+func exchangeCode(ctx context.Context, client *http.Client, tokenURL string, config environment.OAuthProvider, redirectURL string, code string, verifier string) (tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return tokenResponse{}, providerUnavailable(config.Name, err)
+	}
+	defer response.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&token); err != nil {
+		return tokenResponse{}, providerUnavailable(config.Name, fmt.Errorf("token response: %s: %w", response.Status, err))
+	}
+
+	// An invalid, expired or replayed code, or a PKCE verifier that does not
+	// match. GitHub answers these with 200.
+	if token.Error != "" || token.AccessToken == "" {
+		log.Printf("oauth %s: code exchange failed: %s %s", config.Name, token.Error, token.ErrorDescription)
+		return tokenResponse{}, projectError.Errorf(projectError.EUNAUTHORIZED, "Sign-in was rejected by the provider, try again")
+	}
+
+	return token, nil
+}
+
+// getJSON fetches u into value, authenticated with accessToken if set.
+func getJSON(ctx context.Context, client *http.Client, u string, accessToken string, value any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, response.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(value)
+}
+
+func providerUnavailable(name string, err error) error {
+	log.Printf("oauth %s: %v", name, err)
+	return projectError.Errorf(projectError.EUNAVAILABLE, "Sign-in provider unavailable, try again later")
+}
+
+func unavailable(err error) error {
+	if projectError.ErrorCode(err) != projectError.EINTERNAL {
+		return err
+	}
+	log.Printf("oauth state store: %v", err)
+	return projectError.Errorf(projectError.EUNAVAILABLE, "Sign-in unavailable, try again later")
+}
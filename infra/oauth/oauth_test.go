@@ -0,0 +1,246 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/redis"
+	"url_shortening/pkg/projectError"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// testProvider is an OpenID Connect provider serving discovery, its key set
+// and a token endpoint that checks the PKCE verifier of the code it issued.
+type testProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	// nonce goes in the next ID token.
+	nonce string
+	email string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key, email: "ada@example.com"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JwksURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{{
+			Kty: "RSA",
+			Kid: "k1",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// authorized records the PKCE challenge and nonce of the authorization url
+// the browser would be sent to.
+func (p *testProvider) authorized(t *testing.T, authorizeURL string) url.Values {
+	t.Helper()
+
+	u, err := url.Parse(authorizeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := u.Query()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.challenge, p.nonce = params.Get("code_challenge"), params.Get("nonce")
+
+	return params
+}
+
+func (p *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if r.PostFormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            "client",
+		"sub":            "subject",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          p.nonce,
+		"email":          p.email,
+		"email_verified": true,
+		"name":           "Ada",
+	})
+	idToken.Header["kid"] = "k1"
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "id_token": signed})
+}
+
+func newTestManager(t *testing.T, p *testProvider) *Manager {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	config := &environment.Config{}
+	config.OAUTH.CallbackUrl = "http://app.test"
+	config.OAUTH.StateTTL = time.Minute
+	config.OAUTH.Providers = []environment.OAuthProvider{{
+		Name:     "test",
+		Kind:     environment.OAuthKindOIDC,
+		Issuer:   p.URL,
+		ClientID: "client",
+		Scopes:   []string{"openid", "email"},
+	}}
+
+	return NewManager(&redis.Redis{Client: client, Timeout: time.Second}, config)
+}
+
+func TestSignIn(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+	m := newTestManager(t, p)
+
+	state, authorizeURL, err := m.Begin(ctx, "test")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	params := p.authorized(t, authorizeURL)
+	if params.Get("state") != state || params.Get("code_challenge_method") != "S256" || params.Get("nonce") == "" ||
+		params.Get("redirect_uri") != "http://app.test/auth/oauth/test/callback" {
+		t.Fatalf("authorize url params = %v; want state, nonce and S256 challenge", params)
+	}
+
+	identity, err := m.Complete(ctx, "test", state, "code")
+	want := Identity{Provider: "test", Subject: "subject", Email: "ada@example.com", EmailVerified: true, Name: "Ada"}
+	if err != nil || identity != want {
+		t.Fatalf("Complete = %+v, %v; want %+v", identity, err, want)
+	}
+
+	// A state works once.
+	_, err = m.Complete(ctx, "test", state, "code")
+	if projectError.ErrorCode(err) != projectError.EUNAUTHORIZED {
+		t.Fatalf("Complete replayed = %v; want unauthorized", err)
+	}
+}
+
+func TestSignInRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		// complete finishes the sign-in started with state.
+		complete func(m *Manager, p *testProvider, state string) error
+	}{
+		{
+			name: "unknown state",
+			complete: func(m *Manager, p *testProvider, state string) error {
+				_, err := m.Complete(context.Background(), "test", "other", "code")
+				return err
+			},
+		},
+		{
+			name: "state of another provider",
+			complete: func(m *Manager, p *testProvider, state string) error {
+				m.providers["other"] = m.providers["test"]
+				_, err := m.Complete(context.Background(), "other", state, "code")
+				return err
+			},
+		},
+		{
+			name: "wrong nonce",
+			complete: func(m *Manager, p *testProvider, state string) error {
+				p.mu.Lock()
+				p.nonce = "other"
+				p.mu.Unlock()
+				_, err := m.Complete(context.Background(), "test", state, "code")
+				return err
+			},
+		},
+		{
+			name: "wrong PKCE verifier",
+			complete: func(m *Manager, p *testProvider, state string) error {
+				p.mu.Lock()
+				p.challenge = "other"
+				p.mu.Unlock()
+				_, err := m.Complete(context.Background(), "test", state, "code")
+				return err
+			},
+		},
+		{
+			name: "wrong code",
+			complete: func(m *Manager, p *testProvider, state string) error {
+				_, err := m.Complete(context.Background(), "test", state, "other")
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			m := newTestManager(t, p)
+
+			state, authorizeURL, err := m.Begin(context.Background(), "test")
+			if err != nil {
+				t.Fatalf("Begin: %v", err)
+			}
+			p.authorized(t, authorizeURL)
+
+			if err := test.complete(m, p, state); projectError.ErrorCode(err) != projectError.EUNAUTHORIZED {
+				t.Fatalf("Complete = %v; want unauthorized", err)
+			}
+		})
+	}
+}
+
+func TestUnknownProvider(t *testing.T) {
+	m := newTestManager(t, newTestProvider(t))
+
+	if _, _, err := m.Begin(context.Background(), "other"); projectError.ErrorCode(err) != projectError.ENOTFOUND {
+		t.Fatalf("Begin = %v; want not found", err)
+	}
+}
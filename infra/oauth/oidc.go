@@ -0,0 +1,282 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/pkg/projectError"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshInterval limits how often the signing keys are fetched again
+// when an ID token names a key we do not know.
+const jwksRefreshInterval = time.Minute
+
+// oidcProvider signs users in with OpenID Connect. Endpoints and signing keys
+// are discovered from the issuer.
+type oidcProvider struct {
+	config      environment.OAuthProvider
+	redirectURL string
+	client      *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+func (p *oidcProvider) authorizeURL(ctx context.Context, params url.Values) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.redirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+
+	return addParams(discovery.AuthorizationEndpoint, params), nil
+}
+
+func (p *oidcProvider) identify(ctx context.Context, code string, verifier string, nonce string) (Identity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	token, err := exchangeCode(ctx, p.client, discovery.TokenEndpoint, p.config, p.redirectURL, code, verifier)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if token.IDToken == "" {
+		return Identity{}, providerUnavailable(p.config.Name, fmt.Errorf("token response without id_token"))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token.IDToken, claims, func(idToken *jwt.Token) (any, error) {
+		kid, _ := idToken.Header["kid"].(string)
+		return p.key(ctx, discovery, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		if projectError.ErrorCode(err) == projectError.EUNAVAILABLE {
+			return Identity{}, err
+		}
+		return Identity{}, projectError.Errorf(projectError.EUNAUTHORIZED, "Invalid ID token: %v", err)
+	}
+
+	// The nonce ties the ID token to this sign-in, so a token issued for
+	// another one cannot be replayed here.
+	if claimNonce, _ := claims["nonce"].(string); claimNonce == "" || claimNonce != nonce {
+		return Identity{}, projectError.Errorf(projectError.EUNAUTHORIZED, "Invalid ID token: nonce mismatch")
+	}
+
+	identity := identityFromClaims(claims)
+	if identity.Subject == "" {
+		return Identity{}, projectError.Errorf(projectError.EUNAUTHORIZED, "Invalid ID token: no subject")
+	}
+
+	// Some providers only put the email in the userinfo response.
+	if identity.Email == "" && discovery.UserinfoEndpoint != "" {
+		userinfo := map[string]any{}
+		if err := getJSON(ctx, p.client, discovery.UserinfoEndpoint, token.AccessToken, &userinfo); err != nil {
+			return Identity{}, providerUnavailable(p.config.Name, err)
+		}
+
+		if info := identityFromClaims(userinfo); info.Subject == identity.Subject {
+			identity.Email, identity.EmailVerified = info.Email, info.EmailVerified
+			if identity.Name == "" {
+				identity.Name = info.Name
+			}
+		}
+	}
+
+	return identity, nil
+}
+
+// discover fetches the provider's metadata, once.
+func (p *oidcProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, p.client, p.config.Issuer+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return nil, providerUnavailable(p.config.Name, err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.Issuer {
+		return nil, providerUnavailable(p.config.Name, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, p.config.Issuer))
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// key returns the signing key kid, fetching the key set again if it is
+// unknown, as providers rotate their keys.
+func (p *oidcProvider) key(ctx context.Context, discovery *oidcDiscovery, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, p.client, discovery.JwksURI, "", &set); err != nil {
+		return nil, providerUnavailable(p.config.Name, err)
+	}
+
+	p.keys = map[string]any{}
+	p.keysFetchedAt = time.Now()
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if publicKey, err := key.publicKey(); err == nil {
+			p.keys[key.Kid] = publicKey
+		}
+	}
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds key kid. Tokens without a kid are accepted when the
+// provider has a single key.
+func (p *oidcProvider) lookupKey(kid string) (any, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// identityFromClaims reads the standard claims of an ID token or userinfo
+// response.
+func identityFromClaims(claims map[string]any) Identity {
+	identity := Identity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+
+	return identity
+}
+
+// jwk is a public key of a JSON Web Key Set (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+// addParams appends params to u, which may already have a query.
+func addParams(u string, params url.Values) string {
+	if strings.Contains(u, "?") {
+		return u + "&" + params.Encode()
+	}
+	return u + "?" + params.Encode()
+}
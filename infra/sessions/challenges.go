@@ -0,0 +1,113 @@
+package sessions
+
+import (
+	"context"
+	"time"
+	"url_shortening/pkg/cryptPkg"
+	"url_shortening/pkg/projectError"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// A login challenge is the hash challengePrefix+hash of its token. It is
+// created when a password was right but the user must still enter a
+// two-factor code, and ends once a session is opened.
+const (
+	challengePrefix = "login_challenge:"
+	// ChallengeTTL is how long a user has to enter the code.
+	ChallengeTTL = 5 * time.Minute
+	// maxChallengeAttempts wrong codes end a challenge, so codes cannot be
+	// guessed without the password again.
+	maxChallengeAttempts = 5
+)
+
+// failChallengeScript counts a wrong code and deletes the challenge once it
+// had too many. It returns -1 if the challenge no longer exists.
+var failChallengeScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return -1
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts >= tonumber(ARGV[1]) then
+  redis.call('DEL', KEYS[1])
+end
+return attempts
+`)
+
+type Challenge struct {
+	IdUser string
+	Email  string
+}
+
+// CreateChallenge starts a login challenge for idUser and returns its token.
+func (m *Manager) CreateChallenge(ctx context.Context, idUser string, email string) (string, error) {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	token := cryptPkg.RandomToken(32)
+	key := challengePrefix + cryptPkg.HashToken(token)
+
+	_, err := m.redis.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user", idUser, "email", email, "attempts", 0)
+		pipe.PExpire(ctx, key, ChallengeTTL)
+		return nil
+	})
+	if err != nil {
+		return "", unavailable(err)
+	}
+
+	return token, nil
+}
+
+// Challenge returns the login challenge of token.
+func (m *Manager) Challenge(ctx context.Context, token string) (Challenge, error) {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	values, err := m.redis.Client.HMGet(ctx, challengePrefix+cryptPkg.HashToken(token), "user", "email").Result()
+	if err != nil {
+		return Challenge{}, unavailable(err)
+	}
+
+	idUser, _ := values[0].(string)
+	email, _ := values[1].(string)
+	if idUser == "" {
+		return Challenge{}, challengeExpired()
+	}
+
+	return Challenge{IdUser: idUser, Email: email}, nil
+}
+
+// FailChallenge records a wrong code for the challenge of token and reports
+// whether the challenge can still be answered.
+func (m *Manager) FailChallenge(ctx context.Context, token string) (bool, error) {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	attempts, err := failChallengeScript.Run(ctx, m.redis.Client, []string{challengePrefix + cryptPkg.HashToken(token)}, maxChallengeAttempts).Int()
+	if err != nil {
+		return false, unavailable(err)
+	}
+
+	return attempts >= 0 && attempts < maxChallengeAttempts, nil
+}
+
+// CompleteChallenge ends the challenge of token after a right code. Only one
+// caller succeeds, so a code sent twice opens a single session.
+func (m *Manager) CompleteChallenge(ctx context.Context, token string) error {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	deleted, err := m.redis.Client.Del(ctx, challengePrefix+cryptPkg.HashToken(token)).Result()
+	if err != nil {
+		return unavailable(err)
+	} else if deleted == 0 {
+		return challengeExpired()
+	}
+
+	return nil
+}
+
+func challengeExpired() error {
+	return projectError.Errorf(projectError.EUNAUTHORIZED, "Sign-in expired, enter your password again")
+}
@@ -0,0 +1,370 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"url_shortening/infra/db/redis"
+	"url_shortening/pkg/cryptPkg"
+	"url_shortening/pkg/projectError"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// A session is the hash sessionPrefix+id. Its refresh field holds the hash of
+// the current refresh token and rotatedPrefix+hash fields the tokens already
+// exchanged, which must never be presented again. userPrefix+idUser is the
+// set of the user's session ids; ids of expired sessions are pruned on List.
+const (
+	sessionPrefix = "session:"
+	userPrefix    = "user_sessions:"
+	rotatedPrefix = "rotated:"
+)
+
+// rotateScript swaps the current refresh token of a session for a new one. A
+// token that was already rotated means it was stolen, or the thief already
+// used it, so the whole session is revoked.
+var rotateScript = goredis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'refresh')
+if not current then
+  return 0
+end
+if current == ARGV[1] then
+  redis.call('HSET', KEYS[1], 'refresh', ARGV[2], 'rotated:' .. ARGV[1], '1', 'last_seen', ARGV[3], 'ip', ARGV[4])
+  redis.call('PEXPIRE', KEYS[1], ARGV[5])
+  return 1
+end
+if redis.call('HEXISTS', KEYS[1], 'rotated:' .. ARGV[1]) == 1 then
+  redis.call('DEL', KEYS[1])
+  return -1
+end
+return 0
+`)
+
+// touchScript records activity on a session, if it still exists.
+var touchScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return 0
+end
+redis.call('HSET', KEYS[1], 'last_seen', ARGV[1], 'ip', ARGV[2])
+return 1
+`)
+
+// revokeScript deletes a session if token is its current or a rotated refresh
+// token, so only its holder can end it without an access token.
+var revokeScript = goredis.NewScript(`
+if redis.call('HGET', KEYS[1], 'refresh') == ARGV[1] or redis.call('HEXISTS', KEYS[1], 'rotated:' .. ARGV[1]) == 1 then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type Session struct {
+	ID        string    `json:"id"`
+	IdUser    string    `json:"-"`
+	Email     string    `json:"-"`
+	Role      string    `json:"-"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Manager keeps login sessions in Redis. Each one is identified by the sid of
+// its access tokens and renewed with a refresh token that is rotated on every
+// use.
+type Manager struct {
+	redis *redis.Redis
+	ttl   time.Duration
+}
+
+// NewManager returns a Manager whose sessions end after ttl without a refresh.
+func NewManager(redis *redis.Redis, ttl time.Duration) *Manager {
+	return &Manager{redis: redis, ttl: ttl}
+}
+
+// Create starts a session for idUser and returns it with its refresh token.
+// role is copied into the access tokens of the session, so a change of role
+// must revoke the sessions of the user.
+func (m *Manager) Create(ctx context.Context, idUser string, email string, role string, userAgent string, ip string) (Session, string, error) {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	session := Session{
+		ID:        uuid.NewString(),
+		IdUser:    idUser,
+		Email:     email,
+		Role:      role,
+		UserAgent: userAgent,
+		IP:        ip,
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+
+	token, hash := newRefreshToken(session.ID)
+
+	_, err := m.redis.Client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, sessionPrefix+session.ID,
+			"user", idUser,
+			"email", email,
+			"role", role,
+			"refresh", hash,
+			"user_agent", userAgent,
+			"ip", ip,
+			"created_at", now.UnixMilli(),
+			"last_seen", now.UnixMilli(),
+		)
+		pipe.PExpire(ctx, sessionPrefix+session.ID, m.ttl)
+		pipe.SAdd(ctx, userPrefix+idUser, session.ID)
+		pipe.PExpire(ctx, userPrefix+idUser, m.ttl)
+		return nil
+	})
+	if err != nil {
+		return Session{}, "", unavailable(err)
+	}
+
+	return session, token, nil
+}
+
+// Refresh exchanges a refresh token for a new one and returns its session.
+// Presenting a token that was already exchanged revokes the session.
+func (m *Manager) Refresh(ctx context.Context, token string, ip string) (Session, string, error) {
+	id, hash, ok := parseRefreshToken(token)
+	if !ok {
+		return Session{}, "", projectError.Errorf(projectError.EUNAUTHORIZED, "Invalid refresh token")
+	}
+
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	newToken, newHash := newRefreshToken(id)
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	result, err := rotateScript.Run(ctx, m.redis.Client, []string{sessionPrefix + id}, hash, newHash, now, ip, m.ttl.Milliseconds()).Int()
+	if err != nil {
+		return Session{}, "", unavailable(err)
+	}
+
+	switch result {
+	case 1:
+	case -1:
+		log.Printf("refresh token of session %s reused, session revoked", id)
+		return Session{}, "", projectError.Errorf(projectError.EUNAUTHORIZED, "Refresh token reused, session revoked")
+	default:
+		return Session{}, "", projectError.Errorf(projectError.EUNAUTHORIZED, "Session expired")
+	}
+
+	session, err := m.get(ctx, id)
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	// Keep the user's index alive as long as their newest session.
+	if err := m.redis.Client.PExpire(ctx, userPrefix+session.IdUser, m.ttl).Err(); err != nil {
+		return Session{}, "", unavailable(err)
+	}
+
+	return session, newToken, nil
+}
+
+// Touch records a request made with an access token of session id and
+// reports whether the session is still active.
+func (m *Manager) Touch(ctx context.Context, id string, ip string) (bool, error) {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	active, err := touchScript.Run(ctx, m.redis.Client, []string{sessionPrefix + id}, now, ip).Int()
+	if err != nil {
+		return false, unavailable(err)
+	}
+
+	return active == 1, nil
+}
+
+// List returns the active sessions of idUser, most recently used first.
+func (m *Manager) List(ctx context.Context, idUser string) ([]Session, error) {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	ids, err := m.redis.Client.SMembers(ctx, userPrefix+idUser).Result()
+	if err != nil {
+		return nil, unavailable(err)
+	}
+
+	// One command per session: on Redis Cluster they live in different slots.
+	commands := make([]*goredis.SliceCmd, len(ids))
+	_, err = m.redis.Client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i, id := range ids {
+			commands[i] = pipe.HMGet(ctx, sessionPrefix+id, sessionFields...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, unavailable(err)
+	}
+
+	sessions := []Session{}
+	var expired []any
+	for i, command := range commands {
+		session, ok := parseSession(ids[i], command.Val())
+		if !ok {
+			expired = append(expired, ids[i])
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	if len(expired) > 0 {
+		if err := m.redis.Client.SRem(ctx, userPrefix+idUser, expired...).Err(); err != nil {
+			log.Printf("failed to prune expired sessions of user %s: %v", idUser, err)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+
+	return sessions, nil
+}
+
+// Revoke ends session id of idUser.
+func (m *Manager) Revoke(ctx context.Context, idUser string, id string) error {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	owner, err := m.redis.Client.HGet(ctx, sessionPrefix+id, "user").Result()
+	if errors.Is(err, goredis.Nil) || (err == nil && owner != idUser) {
+		return projectError.Errorf(projectError.ENOTFOUND, "session not found")
+	} else if err != nil {
+		return unavailable(err)
+	}
+
+	_, err = m.redis.Client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, sessionPrefix+id)
+		pipe.SRem(ctx, userPrefix+idUser, id)
+		return nil
+	})
+	if err != nil {
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+// RevokeAll ends every session of idUser except the session id except, if
+// set. It is used when the password changes, so a stolen session does not
+// outlive it.
+func (m *Manager) RevokeAll(ctx context.Context, idUser string, except string) error {
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	ids, err := m.redis.Client.SMembers(ctx, userPrefix+idUser).Result()
+	if err != nil {
+		return unavailable(err)
+	}
+
+	_, err = m.redis.Client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, id := range ids {
+			if id == except {
+				continue
+			}
+			pipe.Del(ctx, sessionPrefix+id)
+			pipe.SRem(ctx, userPrefix+idUser, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+// RevokeToken ends the session of a refresh token, current or rotated. An
+// unknown token is not an error: the session is gone either way.
+func (m *Manager) RevokeToken(ctx context.Context, token string) error {
+	id, hash, ok := parseRefreshToken(token)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := m.redis.WithTimeout(ctx)
+	defer cancel()
+
+	if err := revokeScript.Run(ctx, m.redis.Client, []string{sessionPrefix + id}, hash).Err(); err != nil {
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+func (m *Manager) get(ctx context.Context, id string) (Session, error) {
+	values, err := m.redis.Client.HMGet(ctx, sessionPrefix+id, sessionFields...).Result()
+	if err != nil {
+		return Session{}, unavailable(err)
+	}
+
+	session, ok := parseSession(id, values)
+	if !ok {
+		return Session{}, projectError.Errorf(projectError.EUNAUTHORIZED, "Session expired")
+	}
+
+	return session, nil
+}
+
+var sessionFields = []string{"user", "email", "user_agent", "ip", "created_at", "last_seen", "role"}
+
+func parseSession(id string, values []any) (Session, bool) {
+	fields := make([]string, len(values))
+	for i, value := range values {
+		fields[i], _ = value.(string)
+	}
+	if fields[0] == "" {
+		return Session{}, false
+	}
+
+	createdAt, _ := strconv.ParseInt(fields[4], 10, 64)
+	lastSeen, _ := strconv.ParseInt(fields[5], 10, 64)
+
+	return Session{
+		ID:        id,
+		IdUser:    fields[0],
+		Email:     fields[1],
+		Role:      fields[6],
+		UserAgent: fields[2],
+		IP:        fields[3],
+		CreatedAt: time.UnixMilli(createdAt),
+		LastSeen:  time.UnixMilli(lastSeen),
+	}, true
+}
+
+// newRefreshToken returns a token for session id and the hash stored for it.
+// Only the hash is kept, so a Redis dump does not leak usable tokens.
+func newRefreshToken(id string) (string, string) {
+	secret := cryptPkg.RandomToken(32)
+	return id + "." + secret, cryptPkg.HashToken(secret)
+}
+
+func parseRefreshToken(token string) (string, string, bool) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+
+	return id, cryptPkg.HashToken(secret), true
+}
+
+func unavailable(err error) error {
+	if projectError.ErrorCode(err) != projectError.EINTERNAL {
+		return err
+	}
+	log.Printf("session store: %v", err)
+	return projectError.Errorf(projectError.EUNAVAILABLE, "Session store unavailable, try again later")
+}
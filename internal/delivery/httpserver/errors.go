@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"errors"
+	"log"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorStatuses maps projectError codes to HTTP statuses. Codes missing here,
+// EINTERNAL included, are answered with 500.
+var errorStatuses = map[string]int{
+	projectError.EINVALID:        fiber.StatusBadRequest,
+	projectError.EUNAUTHORIZED:   fiber.StatusUnauthorized,
+	projectError.EFORBIDDEN:      fiber.StatusForbidden,
+	projectError.ENOTFOUND:       fiber.StatusNotFound,
+	projectError.ECONFLICT:       fiber.StatusConflict,
+	projectError.EGONE:           fiber.StatusGone,
+	projectError.ETOOLARGE:       fiber.StatusRequestEntityTooLarge,
+	projectError.ERATELIMITED:    fiber.StatusTooManyRequests,
+	projectError.ENOTIMPLEMENTED: fiber.StatusNotImplemented,
+	projectError.EUNAVAILABLE:    fiber.StatusServiceUnavailable,
+}
+
+// ErrorHandler answers every error returned by a handler or middleware with
+// the same envelope, {"error": message, "code": code}. Internal errors are
+// logged and answered with a generic message, so SQL or driver text never
+// reaches the client.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	// Errors raised by Fiber itself: unknown routes, body too large...
+	var fiberError *fiber.Error
+	if errors.As(err, &fiberError) {
+		return c.Status(fiberError.Code).JSON(fiber.Map{
+			"error": fiberError.Message,
+			"code":  errorCodeOf(fiberError.Code),
+		})
+	}
+
+	code := projectError.ErrorCode(err)
+	status, ok := errorStatuses[code]
+	if !ok {
+		status = fiber.StatusInternalServerError
+	}
+
+	if status == fiber.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Method(), c.Path(), err)
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"error": projectError.ErrorMessage(err),
+		"code":  code,
+	})
+}
+
+// limitReached answers requests over a rate limit through ErrorHandler.
+func limitReached(c *fiber.Ctx) error {
+	return projectError.Errorf(projectError.ERATELIMITED, "Too many requests, try again later")
+}
+
+// errorCodeOf is the projectError code answered with status.
+func errorCodeOf(status int) string {
+	for code, codeStatus := range errorStatuses {
+		if codeStatus == status {
+			return code
+		}
+	}
+
+	if status >= fiber.StatusInternalServerError {
+		return projectError.EINTERNAL
+	}
+	return projectError.EINVALID
+}
@@ -1,29 +1,148 @@
 package middleware
 
 import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"time"
 	"url_shortening/infra/config/environment"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/cryptPkg"
 	"url_shortening/pkg/jwtpkg"
+	"url_shortening/pkg/projectError"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func AuthMiddleware(c *fiber.Ctx, config *environment.Config) error {
+// AuthMiddleware accepts requests with an API key in the Authorization
+// header, or with a valid access token cookie whose session is still active,
+// which rejects tokens of revoked sessions before they expire.
+func AuthMiddleware(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, config *environment.Config) error {
+	if key, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok {
+		return apiKeyAuth(c, store, strings.TrimSpace(key))
+	}
+
 	token := c.Cookies("token")
 	if token == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Unauthorized",
-		})
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Unauthorized")
 	}
 
 	claims, err := jwtpkg.ValidateToken(token, config.JWT_SECRET)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Unauthorized",
-		})
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Unauthorized")
+	}
+
+	// Tokens issued before sessions existed have no sid and must log in again.
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Unauthorized")
+	}
+
+	active, err := sessionManager.Touch(c.UserContext(), sid, c.IP())
+	if err != nil {
+		return err
+	} else if !active {
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Session revoked")
 	}
 
 	c.Locals("email", claims["email"])
 	c.Locals("id", claims["id"])
+	c.Locals("sid", sid)
+	c.Locals("role", claims["role"])
+
+	return c.Next()
+}
+
+// apiKeyAuth authenticates a request made with an API key. Its scopes are
+// kept in the "scopes" local for RequireScope.
+func apiKeyAuth(c *fiber.Ctx, store *store.Store, key string) error {
+	repository := store.Users
+	apiKey, err := repository.GetApiKeyByHash(c.UserContext(), cryptPkg.HashToken(key))
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Invalid API key")
+	} else if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if apiKey.Expired(now) {
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "API key expired")
+	}
+
+	// Tracking use must not delay the request.
+	go func(ctx context.Context) {
+		if err := repository.TouchApiKey(ctx, apiKey.ID, now); err != nil {
+			log.Printf("failed to record use of api key %s: %v", apiKey.ID, err)
+		}
+	}(context.WithoutCancel(c.UserContext()))
+
+	c.Locals("id", apiKey.IdUser)
+	c.Locals("apiKey", apiKey.ID)
+	c.Locals("scopes", apiKey.Scopes)
+
+	return c.Next()
+}
+
+// RequireScope lets through login sessions, which have every scope, and API
+// keys granted scope.
+func RequireScope(c *fiber.Ctx, scope string) error {
+	if scopes, ok := c.Locals("scopes").([]string); ok && !slices.Contains(scopes, scope) {
+		return projectError.Errorf(projectError.EFORBIDDEN, "API key lacks the %s scope", scope)
+	}
+
+	return c.Next()
+}
+
+// RequireSession rejects API keys on endpoints that manage the account, such
+// as sessions and the API keys themselves.
+func RequireSession(c *fiber.Ctx) error {
+	if c.Locals("apiKey") != nil {
+		return projectError.Errorf(projectError.EFORBIDDEN, "This endpoint requires a login session")
+	}
+
+	return c.Next()
+}
+
+// RequireVerifiedEmail rejects users who have not confirmed their email yet,
+// when AUTH_REQUIRE_VERIFIED_EMAIL is set.
+func RequireVerifiedEmail(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	if !config.AUTH.RequireVerifiedEmail {
+		return c.Next()
+	}
+
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		return projectError.Errorf(projectError.EFORBIDDEN, "Verify your email before creating links")
+	}
+
+	return c.Next()
+}
+
+// RequireAdmin lets through admins only. The role in the access token can
+// be a few minutes old, so it is checked against the database: admin
+// requests are few, and a demoted or disabled admin must lose access at once.
+func RequireAdmin(c *fiber.Ctx, store *store.Store) error {
+	if c.Locals("role") != user_repo.RoleAdmin {
+		return projectError.Errorf(projectError.EFORBIDDEN, "Admins only")
+	}
+
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	if !user.Admin() || user.Disabled() {
+		return projectError.Errorf(projectError.EFORBIDDEN, "Admins only")
+	}
 
 	return c.Next()
 }
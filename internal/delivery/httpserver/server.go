@@ -2,57 +2,270 @@ package httpserver
 
 import (
 	"time"
+	"url_shortening/infra/cache"
+	"url_shortening/infra/clicks"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
 	"url_shortening/infra/db/redis"
+	"url_shortening/infra/lockout"
+	"url_shortening/infra/mailer"
+	"url_shortening/infra/oauth"
+	"url_shortening/infra/sessions"
 	"url_shortening/internal/delivery/httpserver/middleware"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/internal/useCase/admin"
 	"url_shortening/internal/useCase/auth"
 	"url_shortening/internal/useCase/urlShortening"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 )
 
 type Server struct {
-	App    *fiber.App
-	Db     *postgres.Postgres
-	Redis  *redis.Redis
-	Config *environment.Config
+	App      *fiber.App
+	Store    *store.Store
+	Redis    *redis.Redis
+	Cache    cache.Cache
+	Slugs    *cache.Slugs
+	Clicks   *clicks.Counter
+	Sessions *sessions.Manager
+	Lockout  *lockout.Guard
+	OAuth    *oauth.Manager
+	Mailer   mailer.Mailer
+	Config   *environment.Config
 }
 
-func NewServer(app *fiber.App, db *postgres.Postgres, redis *redis.Redis, config *environment.Config) (*Server, error) {
-	return &Server{App: app, Db: db, Redis: redis, Config: config}, nil
+func NewServer(app *fiber.App, store *store.Store, redis *redis.Redis, cache cache.Cache, slugs *cache.Slugs, clicks *clicks.Counter, sessions *sessions.Manager, lockout *lockout.Guard, oauth *oauth.Manager, mailer mailer.Mailer, config *environment.Config) (*Server, error) {
+	return &Server{App: app, Store: store, Redis: redis, Cache: cache, Slugs: slugs, Clicks: clicks, Sessions: sessions, Lockout: lockout, OAuth: oauth, Mailer: mailer, Config: config}, nil
+}
+
+func (s *Server) requireAuth(c *fiber.Ctx) error {
+	return middleware.AuthMiddleware(c, s.Store, s.Sessions, s.Config)
+}
+
+// requireScope returns a handler rejecting API keys without scope. It must
+// run after requireAuth.
+func requireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return middleware.RequireScope(c, scope)
+	}
+}
+
+func requireSession(c *fiber.Ctx) error {
+	return middleware.RequireSession(c)
+}
+
+func (s *Server) requireVerifiedEmail(c *fiber.Ctx) error {
+	return middleware.RequireVerifiedEmail(c, s.Store, s.Config)
+}
+
+func (s *Server) requireAdmin(c *fiber.Ctx) error {
+	return middleware.RequireAdmin(c, s.Store)
 }
 
 // URL handlers
 func (s *Server) handleURLRegister(c *fiber.Ctx) error {
-	return urlShortening.Register(c, s.Db, s.Redis, s.Config)
+	return urlShortening.Register(c, s.Store, s.Cache, s.Slugs, s.Config)
 }
 
 func (s *Server) handleURLGet(c *fiber.Ctx) error {
-	return urlShortening.GetUrl(c, s.Db, s.Redis, s.Config)
+	return urlShortening.GetUrl(c, s.Store, s.Cache, s.Slugs, s.Clicks, s.Config)
 }
 
-
 func (s *Server) handleURLList(c *fiber.Ctx) error {
-	return urlShortening.ListUserUrls(c, s.Db, s.Redis, s.Config)
+	return urlShortening.ListUserUrls(c, s.Store, s.Cache, s.Clicks, s.Config)
+}
+
+func (s *Server) handleURLUpdate(c *fiber.Ctx) error {
+	return urlShortening.Update(c, s.Store, s.Cache, s.Config)
+}
+
+func (s *Server) handleURLDelete(c *fiber.Ctx) error {
+	return urlShortening.Delete(c, s.Store, s.Cache, s.Slugs, s.Config)
+}
+
+func (s *Server) handleURLRestore(c *fiber.Ctx) error {
+	return urlShortening.Restore(c, s.Store, s.Cache, s.Slugs, s.Config)
+}
+
+func (s *Server) handleURLHistory(c *fiber.Ctx) error {
+	return urlShortening.History(c, s.Store, s.Cache, s.Config)
+}
+
+func (s *Server) handleURLClicks(c *fiber.Ctx) error {
+	return urlShortening.Clicks(c, s.Store, s.Cache, s.Config)
+}
+
+func (s *Server) handleURLRevert(c *fiber.Ctx) error {
+	return urlShortening.Revert(c, s.Store, s.Cache, s.Config)
+}
+
+func (s *Server) handleURLTransferCreate(c *fiber.Ctx) error {
+	return urlShortening.CreateTransfer(c, s.Store, s.Cache, s.Config)
+}
+
+func (s *Server) handleURLTransferList(c *fiber.Ctx) error {
+	return urlShortening.ListTransfers(c, s.Store, s.Cache, s.Config)
+}
+
+func (s *Server) handleURLTransferAccept(c *fiber.Ctx) error {
+	return urlShortening.AcceptTransfer(c, s.Store, s.Cache, s.Slugs, s.Sessions, s.Config)
+}
+
+func (s *Server) handleURLTransferDecline(c *fiber.Ctx) error {
+	return urlShortening.DeclineTransfer(c, s.Store, s.Cache, s.Slugs, s.Sessions, s.Config)
+}
+
+func (s *Server) handleURLTransferCancel(c *fiber.Ctx) error {
+	return urlShortening.CancelTransfer(c, s.Store, s.Cache, s.Config)
 }
+
 // Auth handlers
 func (s *Server) handleAuthRegister(c *fiber.Ctx) error {
-	return auth.Register(c, s.Db, s.Redis, s.Config)
+	return auth.Register(c, s.Store, s.Sessions, s.Mailer, s.Config)
 }
 
 func (s *Server) handleAuthLogin(c *fiber.Ctx) error {
-	return auth.Login(c, s.Db, s.Redis, s.Config)
+	return auth.Login(c, s.Store, s.Sessions, s.Lockout, s.Mailer, s.Config)
+}
+
+func (s *Server) handleAuthLoginTwoFactor(c *fiber.Ctx) error {
+	return auth.LoginTwoFactor(c, s.Store, s.Sessions, s.Lockout, s.Mailer, s.Config)
 }
 
 func (s *Server) handleAuthLogout(c *fiber.Ctx) error {
-	return auth.Logout(c, s.Db, s.Redis, s.Config)
+	return auth.Logout(c, s.Store, s.Sessions, s.Config)
 }
 
 func (s *Server) handleAuthMe(c *fiber.Ctx) error {
-	return auth.Me(c, s.Db, s.Redis, s.Config)
+	return auth.Me(c, s.Store, s.Sessions, s.Config)
+}
+
+func (s *Server) handleAuthUpdateProfile(c *fiber.Ctx) error {
+	return auth.UpdateProfile(c, s.Store, s.Mailer, s.Config)
+}
+
+func (s *Server) handleAuthDeleteAccount(c *fiber.Ctx) error {
+	return auth.DeleteAccount(c, s.Store, s.Sessions, s.Cache, s.Slugs, s.Config)
+}
+
+func (s *Server) handleAuthConfirmEmailChange(c *fiber.Ctx) error {
+	return auth.ConfirmEmailChange(c, s.Store, s.Mailer, s.Config)
+}
+
+func (s *Server) handleAuthRefresh(c *fiber.Ctx) error {
+	return auth.Refresh(c, s.Sessions, s.Config)
+}
+
+func (s *Server) handleAuthSessionList(c *fiber.Ctx) error {
+	return auth.ListSessions(c, s.Sessions, s.Config)
+}
+
+func (s *Server) handleAuthSessionRevoke(c *fiber.Ctx) error {
+	return auth.RevokeSession(c, s.Sessions, s.Config)
+}
+
+func (s *Server) handleAuthVerifyEmail(c *fiber.Ctx) error {
+	return auth.VerifyEmail(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAuthResendVerification(c *fiber.Ctx) error {
+	return auth.ResendVerification(c, s.Store, s.Mailer, s.Config)
+}
+
+func (s *Server) handleAuthForgotPassword(c *fiber.Ctx) error {
+	return auth.ForgotPassword(c, s.Store, s.Mailer, s.Config)
+}
+
+func (s *Server) handleAuthResetPassword(c *fiber.Ctx) error {
+	return auth.ResetPassword(c, s.Store, s.Sessions, s.Lockout, s.Config)
+}
+
+func (s *Server) handleAuthChangePassword(c *fiber.Ctx) error {
+	return auth.ChangePassword(c, s.Store, s.Sessions, s.Config)
+}
+
+func (s *Server) handleAuthTwoFactorStatus(c *fiber.Ctx) error {
+	return auth.TwoFactorStatus(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAuthTwoFactorEnroll(c *fiber.Ctx) error {
+	return auth.EnrollTwoFactor(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAuthTwoFactorConfirm(c *fiber.Ctx) error {
+	return auth.ConfirmTwoFactor(c, s.Store, s.Sessions, s.Config)
+}
+
+func (s *Server) handleAuthTwoFactorRecoveryCodes(c *fiber.Ctx) error {
+	return auth.RegenerateRecoveryCodes(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAuthTwoFactorDisable(c *fiber.Ctx) error {
+	return auth.DisableTwoFactor(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAuthOAuthProviders(c *fiber.Ctx) error {
+	return auth.OAuthProviders(c, s.OAuth, s.Config)
+}
+
+func (s *Server) handleAuthOAuthStart(c *fiber.Ctx) error {
+	return auth.OAuthStart(c, s.OAuth, s.Config)
+}
+
+func (s *Server) handleAuthOAuthCallback(c *fiber.Ctx) error {
+	return auth.OAuthCallback(c, s.Store, s.Sessions, s.OAuth, s.Config)
+}
+
+func (s *Server) handleAuthApiKeyCreate(c *fiber.Ctx) error {
+	return auth.CreateApiKey(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAuthApiKeyList(c *fiber.Ctx) error {
+	return auth.ListApiKeys(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAuthApiKeyRevoke(c *fiber.Ctx) error {
+	return auth.RevokeApiKey(c, s.Store, s.Config)
+}
+
+// Admin handlers
+func (s *Server) handleAdminStats(c *fiber.Ctx) error {
+	return admin.Stats(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAdminUserList(c *fiber.Ctx) error {
+	return admin.ListUsers(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAdminUserRole(c *fiber.Ctx) error {
+	return admin.SetRole(c, s.Store, s.Sessions, s.Config)
+}
+
+func (s *Server) handleAdminUserDisable(c *fiber.Ctx) error {
+	return admin.DisableUser(c, s.Store, s.Sessions, s.Config)
+}
+
+func (s *Server) handleAdminUserEnable(c *fiber.Ctx) error {
+	return admin.EnableUser(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAdminUrlList(c *fiber.Ctx) error {
+	return admin.ListUrls(c, s.Store, s.Config)
+}
+
+func (s *Server) handleAdminUrlExpire(c *fiber.Ctx) error {
+	return admin.ExpireUrl(c, s.Store, s.Cache, s.Config)
+}
+
+func (s *Server) handleAdminUrlTakeDown(c *fiber.Ctx) error {
+	return admin.TakeDownUrl(c, s.Store, s.Cache, s.Config)
+}
+
+func (s *Server) handleAdminUrlReinstate(c *fiber.Ctx) error {
+	return admin.ReinstateUrl(c, s.Store, s.Cache, s.Config)
 }
 
 // Home handler
@@ -66,6 +279,7 @@ func (s *Server) Router() {
 		AllowOrigins:     s.Config.FRONTEND_URL,
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
 		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
+		ExposeHeaders:    "Retry-After",
 		AllowCredentials: true,
 	}))
 
@@ -75,31 +289,85 @@ func (s *Server) Router() {
 	authGroup := s.App.Group("/auth")
 
 	authGroup.Use(limiter.New(limiter.Config{
-		Max:        20,
-		Expiration: 1 * time.Minute,
+		Max:          20,
+		Expiration:   1 * time.Minute,
+		LimitReached: limitReached,
 	}))
 
 	authGroup.Post("/register", s.handleAuthRegister)
 	authGroup.Post("/login", s.handleAuthLogin)
+	authGroup.Post("/login/2fa", s.handleAuthLoginTwoFactor)
+	authGroup.Post("/refresh", s.handleAuthRefresh)
 	authGroup.Post("/logout", s.handleAuthLogout)
-	authGroup.Get("/me", s.handleAuthMe)
+	authGroup.Post("/verify-email", s.handleAuthVerifyEmail)
+	authGroup.Post("/verify-email/resend", s.requireAuth, requireSession, s.handleAuthResendVerification)
+	authGroup.Post("/password/forgot", s.handleAuthForgotPassword)
+	authGroup.Post("/password/reset", s.handleAuthResetPassword)
+	authGroup.Post("/password/change", s.requireAuth, requireSession, s.handleAuthChangePassword)
+	authGroup.Get("/2fa", s.requireAuth, requireSession, s.handleAuthTwoFactorStatus)
+	authGroup.Post("/2fa/enroll", s.requireAuth, requireSession, s.handleAuthTwoFactorEnroll)
+	authGroup.Post("/2fa/confirm", s.requireAuth, requireSession, s.handleAuthTwoFactorConfirm)
+	authGroup.Post("/2fa/recovery-codes", s.requireAuth, requireSession, s.handleAuthTwoFactorRecoveryCodes)
+	authGroup.Post("/2fa/disable", s.requireAuth, requireSession, s.handleAuthTwoFactorDisable)
+	authGroup.Get("/oauth", s.handleAuthOAuthProviders)
+	authGroup.Get("/oauth/:provider", s.handleAuthOAuthStart)
+	authGroup.Get("/oauth/:provider/callback", s.handleAuthOAuthCallback)
+	authGroup.Get("/me", s.requireAuth, requireSession, s.handleAuthMe)
+	authGroup.Put("/me", s.requireAuth, requireSession, s.handleAuthUpdateProfile)
+	authGroup.Delete("/me", s.requireAuth, requireSession, s.handleAuthDeleteAccount)
+	authGroup.Post("/email/confirm", s.handleAuthConfirmEmailChange)
+	authGroup.Get("/sessions", s.requireAuth, requireSession, s.handleAuthSessionList)
+	authGroup.Delete("/sessions/:id", s.requireAuth, requireSession, s.handleAuthSessionRevoke)
+	authGroup.Post("/keys", s.requireAuth, requireSession, s.handleAuthApiKeyCreate)
+	authGroup.Get("/keys", s.requireAuth, requireSession, s.handleAuthApiKeyList)
+	authGroup.Delete("/keys/:id", s.requireAuth, requireSession, s.handleAuthApiKeyRevoke)
 
 	// Só para /url/register
 	s.App.Use("/register", limiter.New(limiter.Config{
-		Max:        100,
-		Expiration: 1 * time.Minute,
+		Max:          100,
+		Expiration:   1 * time.Minute,
+		LimitReached: limitReached,
 	}))
 
-	s.App.Use("/register", func(c *fiber.Ctx) error {
-		return middleware.AuthMiddleware(c, s.Config)
-	})
+	s.App.Use("/register", s.requireAuth)
+
+	s.App.Post("/register", requireScope(user_repo.ScopeLinksWrite), s.requireVerifiedEmail, s.handleURLRegister)
+
+	// Rotas protegidas para gerenciar as URLs do usuário
+	urlsGroup := s.App.Group("/urls", s.requireAuth)
+
+	linksRead := requireScope(user_repo.ScopeLinksRead)
+	linksWrite := requireScope(user_repo.ScopeLinksWrite)
+
+	urlsGroup.Get("", linksRead, s.handleURLList)
+	urlsGroup.Post("/transfers", linksWrite, s.handleURLTransferCreate)
+	urlsGroup.Get("/transfers", linksRead, s.handleURLTransferList)
+	urlsGroup.Post("/transfers/:id/accept", linksWrite, s.handleURLTransferAccept)
+	urlsGroup.Post("/transfers/:id/decline", linksWrite, s.handleURLTransferDecline)
+	urlsGroup.Post("/transfers/:id/cancel", linksWrite, s.handleURLTransferCancel)
+	urlsGroup.Put("/:id", linksWrite, s.handleURLUpdate)
+	urlsGroup.Delete("/:id", linksWrite, s.handleURLDelete)
+	urlsGroup.Post("/:id/restore", linksWrite, s.handleURLRestore)
+	urlsGroup.Get("/:id/clicks", requireScope(user_repo.ScopeStatsRead), s.handleURLClicks)
+	urlsGroup.Get("/:id/history", linksRead, s.handleURLHistory)
+	urlsGroup.Post("/:id/history/:historyId/revert", linksWrite, s.handleURLRevert)
+
+	// Moderation of every user and link, for admins signed in with a session
+	adminGroup := s.App.Group("/admin", s.requireAuth, requireSession, s.requireAdmin)
 
-	s.App.Post("/register", s.handleURLRegister)
+	adminGroup.Get("/stats", s.handleAdminStats)
+	adminGroup.Get("/users", s.handleAdminUserList)
+	adminGroup.Put("/users/:id/role", s.handleAdminUserRole)
+	adminGroup.Post("/users/:id/disable", s.handleAdminUserDisable)
+	adminGroup.Post("/users/:id/enable", s.handleAdminUserEnable)
+	adminGroup.Get("/urls", s.handleAdminUrlList)
+	adminGroup.Post("/urls/:id/expire", s.handleAdminUrlExpire)
+	adminGroup.Post("/urls/:id/takedown", s.handleAdminUrlTakeDown)
+	adminGroup.Post("/urls/:id/reinstate", s.handleAdminUrlReinstate)
 
-	// Rota protegida para listar URLs do usuário
-	s.App.Get("/urls", func(c *fiber.Ctx) error {
-		return middleware.AuthMiddleware(c, s.Config)
-	}, s.handleURLList)
+	// Runtime counters, including the url lookup stats. They reveal memory
+	// stats and the command line, so only admins may read them.
+	s.App.Get("/debug/vars", s.requireAuth, requireSession, s.requireAdmin, expvar.New())
 
 	s.App.Get("/:urlShortened", s.handleURLGet)
 
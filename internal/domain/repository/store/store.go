@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/db/postgres"
+	"url_shortening/infra/db/sqldb"
+	"url_shortening/infra/db/sqlite"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/internal/domain/repository/user_repo"
+)
+
+// Store holds the repositories of the backend selected by DB_DRIVER.
+type Store struct {
+	Urls  urlShortening_repo.Repository
+	Users user_repo.Repository
+
+	db *sqldb.Database
+}
+
+// NewStore opens the configured backend. The schema is migrated only when
+// DB_AUTO_MIGRATE is set; otherwise run `migrate up` before starting.
+func NewStore(config *environment.Config) (*Store, error) {
+	if config.DB.Driver == environment.DBDriverMemory {
+		return &Store{
+			Urls:  urlShortening_repo.NewMemoryRepository(config),
+			Users: user_repo.NewMemoryRepository(),
+		}, nil
+	}
+
+	db, migrations, err := openDatabase(config)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := newMigrator(db, migrations, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.DB.AutoMigrate {
+		if err := migrator.Up(context.Background()); err != nil {
+			return nil, err
+		}
+	} else if pending, err := migrator.Pending(context.Background()); err != nil {
+		return nil, err
+	} else if pending > 0 {
+		log.Printf("%d database migrations are pending, run `migrate up`", pending)
+	}
+
+	return &Store{
+		Urls:  urlShortening_repo.NewUrlShorteningRepository(db, config),
+		Users: user_repo.NewUserRepository(db, config),
+		db:    db,
+	}, nil
+}
+
+// Transaction runs fn so that the repository calls it makes with its context
+// commit or roll back together. The memory backend cannot roll back: changes
+// made before fn fails are kept.
+func (s *Store) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.db == nil {
+		return fn(ctx)
+	}
+	return s.db.Transaction(ctx, fn)
+}
+
+// DeleteUser deletes idUser for good with their links, and returns the slugs
+// of the links. The links go with the user or not at all, so a failure
+// leaves an account that can be deleted again rather than one without its
+// links.
+func (s *Store) DeleteUser(ctx context.Context, idUser string) ([]string, error) {
+	var purged []string
+	err := s.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if purged, err = s.Urls.PurgeUserUrls(ctx, idUser); err != nil {
+			return err
+		}
+
+		return s.Users.DeleteUser(ctx, idUser)
+	})
+	if err != nil {
+		return []string{}, err
+	}
+
+	return purged, nil
+}
+
+// Written keeps reads of keys on the primary database until the read
+// replicas have caught up with a change made by another instance. It does
+// nothing without replicas.
+func (s *Store) Written(keys ...string) {
+	if s.db != nil {
+		s.db.WrittenElsewhere(keys...)
+	}
+}
+
+// OnWritten registers fn to be called with the keys the repositories change,
+// so other instances can be told through Written. It does nothing without
+// replicas.
+func (s *Store) OnWritten(fn func(keys ...string)) {
+	if s.db != nil {
+		s.db.OnWritten(fn)
+	}
+}
+
+// NewMigrator returns the migrator of the configured SQL backend.
+func NewMigrator(config *environment.Config) (*sqldb.Migrator, error) {
+	if config.DB.Driver == environment.DBDriverMemory {
+		return nil, errors.New("the memory driver has no schema to migrate")
+	}
+
+	db, migrations, err := openDatabase(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrator(db, migrations, config)
+}
+
+// newMigrator returns the migrator of db with the steps its migrations run.
+func newMigrator(db *sqldb.Database, migrations fs.FS, config *environment.Config) (*sqldb.Migrator, error) {
+	migrator, err := sqldb.NewMigrator(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator.AddStep("canonicalize urls", urlShortening_repo.CanonicalizeUrls(config.URL_STRIP_TRACKING_PARAMS))
+
+	return migrator, nil
+}
+
+func openDatabase(config *environment.Config) (*sqldb.Database, fs.FS, error) {
+	switch config.DB.Driver {
+	case environment.DBDriverPostgres:
+		db, err := postgres.NewPostgres(config)
+		return db, postgres.Migrations(), err
+	case environment.DBDriverSQLite:
+		db, err := sqlite.NewSQLite(config)
+		return db, sqlite.Migrations(), err
+	default:
+		return nil, nil, fmt.Errorf("unknown database driver %q", config.DB.Driver)
+	}
+}
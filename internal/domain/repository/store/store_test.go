@@ -0,0 +1,651 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/projectError"
+)
+
+// backends opens a store of every driver that needs no database server. The
+// tests run against each, so the memory repositories keep behaving like the
+// SQL ones.
+func backends(t *testing.T) map[string]func(t *testing.T) *Store {
+	return map[string]func(t *testing.T) *Store{
+		environment.DBDriverMemory: func(t *testing.T) *Store {
+			return newTestStore(t, environment.DBDriverMemory, "")
+		},
+		environment.DBDriverSQLite: func(t *testing.T) *Store {
+			return newTestStore(t, environment.DBDriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+		},
+	}
+}
+
+func newTestStore(t *testing.T, driver string, dataSource string) *Store {
+	t.Helper()
+
+	config := &environment.Config{}
+	config.URL_SHORTENED_PREFIX = "http://short.test"
+	config.DB.Driver = driver
+	config.DB.DataSource = dataSource
+	config.DB.AutoMigrate = true
+	config.DB.Timeout = 5 * time.Second
+
+	s, err := NewStore(config)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if s.db != nil {
+		t.Cleanup(func() {
+			if db, err := s.db.Db.DB(); err == nil {
+				db.Close()
+			}
+		})
+	}
+
+	return s
+}
+
+func forEachBackend(t *testing.T, test func(t *testing.T, s *Store)) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			test(t, open(t))
+		})
+	}
+}
+
+func wantCode(t *testing.T, err error, code string) {
+	t.Helper()
+
+	if projectError.ErrorCode(err) != code {
+		t.Fatalf("error = %v; want %s", err, code)
+	}
+}
+
+func registerUser(t *testing.T, s *Store, name string, email string) string {
+	t.Helper()
+
+	id, _, err := s.Users.RegisterUser(context.Background(), &user_repo.User{Name: name, Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+
+	return id
+}
+
+func registerUrl(t *testing.T, s *Store, url string, idUser string) urlShortening_repo.UrlOriginal {
+	t.Helper()
+
+	registered, err := s.Urls.RegisterUrl(context.Background(), &url, url, urlShortening_repo.Actor{IdUser: idUser})
+	if err != nil {
+		t.Fatalf("RegisterUrl: %v", err)
+	}
+
+	return registered
+}
+
+func TestUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		id := registerUser(t, s, "Ada", "ada@example.com")
+
+		_, _, err := s.Users.RegisterUser(ctx, &user_repo.User{Name: "Other", Email: "ada@example.com", Password: "hash"})
+		wantCode(t, err, projectError.ECONFLICT)
+
+		user, err := s.Users.GetUserByEmail(ctx, "ada@example.com")
+		if err != nil || user.ID != id || user.Name != "Ada" || user.Role != user_repo.RoleUser {
+			t.Fatalf("GetUserByEmail = %+v, %v; want the registered user", user, err)
+		}
+		if user.EmailVerifiedAt != nil || user.Disabled() {
+			t.Fatalf("new user = %+v; want unverified and enabled", user)
+		}
+
+		_, err = s.Users.GetUserByEmail(ctx, "nobody@example.com")
+		wantCode(t, err, projectError.ENOTFOUND)
+
+		if err := s.Users.SetRole(ctx, id, user_repo.RoleAdmin); err != nil {
+			t.Fatalf("SetRole: %v", err)
+		}
+		now := time.Now()
+		if err := s.Users.SetDisabled(ctx, id, &now); err != nil {
+			t.Fatalf("SetDisabled: %v", err)
+		}
+
+		user, err = s.Users.GetUserByID(ctx, id)
+		if err != nil || !user.Admin() || !user.Disabled() {
+			t.Fatalf("GetUserByID = %+v, %v; want a disabled admin", user, err)
+		}
+
+		wantCode(t, s.Users.SetRole(ctx, "missing", user_repo.RoleAdmin), projectError.ENOTFOUND)
+		wantCode(t, s.Users.SetDisabled(ctx, "missing", nil), projectError.ENOTFOUND)
+
+		if err := s.Users.DeleteUser(ctx, id); err != nil {
+			t.Fatalf("DeleteUser: %v", err)
+		}
+		_, err = s.Users.GetUserByID(ctx, id)
+		wantCode(t, err, projectError.ENOTFOUND)
+	})
+}
+
+func TestListUsersSearch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		registerUser(t, s, "Ada Lovelace", "ada@example.com")
+		registerUser(t, s, "Alan Turing", "alan@example.org")
+		registerUser(t, s, "Grace 100%", "grace@example.com")
+
+		for search, want := range map[string]int64{"": 3, "example.com": 2, "TURING": 1, "100%": 1, "%": 1, "nobody": 0} {
+			users, total, err := s.Users.ListUsers(context.Background(), search, 10, 0)
+			if err != nil || total != want || int64(len(users)) != want {
+				t.Fatalf("ListUsers(%q) = %d users of %d, %v; want %d", search, len(users), total, err, want)
+			}
+		}
+	})
+}
+
+func TestApiKeysOfDisabledUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		id := registerUser(t, s, "Ada", "ada@example.com")
+
+		key, err := s.Users.CreateApiKey(ctx, &user_repo.ApiKey{IdUser: id, Name: "ci", Prefix: "sk_test", Scopes: []string{"urls:read"}}, "hash")
+		if err != nil {
+			t.Fatalf("CreateApiKey: %v", err)
+		}
+
+		if found, err := s.Users.GetApiKeyByHash(ctx, "hash"); err != nil || found.ID != key.ID || found.IdUser != id {
+			t.Fatalf("GetApiKeyByHash = %+v, %v; want the created key", found, err)
+		}
+
+		now := time.Now()
+		if err := s.Users.SetDisabled(ctx, id, &now); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Users.GetApiKeyByHash(ctx, "hash")
+		wantCode(t, err, projectError.ENOTFOUND)
+	})
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		id := registerUser(t, s, "Ada", "ada@example.com")
+
+		if err := s.Users.SaveTOTP(ctx, id, "SECRET"); err != nil {
+			t.Fatalf("SaveTOTP: %v", err)
+		}
+		wantCode(t, s.Users.UseTOTPStep(ctx, id, 99), projectError.ECONFLICT)
+
+		if err := s.Users.ConfirmTOTP(ctx, id, 100, time.Now(), nil); err != nil {
+			t.Fatalf("ConfirmTOTP: %v", err)
+		}
+		// The code that confirmed the app cannot sign in.
+		wantCode(t, s.Users.UseTOTPStep(ctx, id, 100), projectError.ECONFLICT)
+
+		if err := s.Users.UseTOTPStep(ctx, id, 101); err != nil {
+			t.Fatalf("UseTOTPStep: %v", err)
+		}
+		wantCode(t, s.Users.UseTOTPStep(ctx, id, 101), projectError.ECONFLICT)
+		// An older code still within the skew window is refused too.
+		wantCode(t, s.Users.UseTOTPStep(ctx, id, 100), projectError.ECONFLICT)
+
+		totp, err := s.Users.GetTOTP(ctx, id)
+		if err != nil || !totp.Enabled() || totp.LastStep != 101 {
+			t.Fatalf("GetTOTP = %+v, %v; want step 101 used", totp, err)
+		}
+	})
+}
+
+func TestConsumeRecoveryCode(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		id := registerUser(t, s, "Ada", "ada@example.com")
+		other := registerUser(t, s, "Alan", "alan@example.com")
+
+		if err := s.Users.SaveTOTP(ctx, id, "SECRET"); err != nil {
+			t.Fatalf("SaveTOTP: %v", err)
+		}
+		if err := s.Users.ConfirmTOTP(ctx, id, 100, time.Now(), []string{"hash-1", "hash-2"}); err != nil {
+			t.Fatalf("ConfirmTOTP: %v", err)
+		}
+
+		wantCode(t, s.Users.ConsumeRecoveryCode(ctx, other, "hash-1", time.Now()), projectError.ENOTFOUND)
+		wantCode(t, s.Users.ConsumeRecoveryCode(ctx, id, "unknown", time.Now()), projectError.ENOTFOUND)
+
+		if err := s.Users.ConsumeRecoveryCode(ctx, id, "hash-1", time.Now()); err != nil {
+			t.Fatalf("ConsumeRecoveryCode: %v", err)
+		}
+		wantCode(t, s.Users.ConsumeRecoveryCode(ctx, id, "hash-1", time.Now()), projectError.ENOTFOUND)
+
+		if count, err := s.Users.CountRecoveryCodes(ctx, id); err != nil || count != 1 {
+			t.Fatalf("CountRecoveryCodes = %d, %v; want 1 left", count, err)
+		}
+
+		// New codes replace the old ones, used or not.
+		if err := s.Users.ReplaceRecoveryCodes(ctx, id, []string{"hash-3"}); err != nil {
+			t.Fatalf("ReplaceRecoveryCodes: %v", err)
+		}
+		wantCode(t, s.Users.ConsumeRecoveryCode(ctx, id, "hash-2", time.Now()), projectError.ENOTFOUND)
+		if err := s.Users.ConsumeRecoveryCode(ctx, id, "hash-3", time.Now()); err != nil {
+			t.Fatalf("ConsumeRecoveryCode: %v", err)
+		}
+	})
+}
+
+func TestUrlLifecycle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		idUser := registerUser(t, s, "Ada", "ada@example.com")
+		actor := urlShortening_repo.Actor{IdUser: idUser, ClientIP: "127.0.0.1"}
+
+		registered := registerUrl(t, s, "https://example.com/a", idUser)
+		if again := registerUrl(t, s, "https://example.com/a", idUser); again.Slug != registered.Slug {
+			t.Fatalf("registering the same url again gave slug %q; want %q", again.Slug, registered.Slug)
+		}
+
+		url, err := s.Urls.GetUrl(ctx, registered.Slug)
+		if err != nil || url.UrlOriginal != "https://example.com/a" {
+			t.Fatalf("GetUrl = %+v, %v; want the registered url", url, err)
+		}
+
+		_, err = s.Urls.GetUrl(ctx, "missing")
+		wantCode(t, err, projectError.ENOTFOUND)
+
+		other := "https://example.com/b"
+		_, err = s.Urls.UpdateUrl(ctx, registered.ID, other, other, urlShortening_repo.HistoryUpdate, urlShortening_repo.Actor{IdUser: "someone else"})
+		wantCode(t, err, projectError.ENOTFOUND)
+
+		if _, err := s.Urls.UpdateUrl(ctx, registered.ID, other, other, urlShortening_repo.HistoryUpdate, actor); err != nil {
+			t.Fatalf("UpdateUrl: %v", err)
+		}
+		if url, err := s.Urls.GetUrl(ctx, registered.Slug); err != nil || url.UrlOriginal != other {
+			t.Fatalf("GetUrl after the update = %+v, %v; want %s", url, err, other)
+		}
+
+		if _, err := s.Urls.DeleteUrl(ctx, registered.ID, actor); err != nil {
+			t.Fatalf("DeleteUrl: %v", err)
+		}
+		_, err = s.Urls.GetUrl(ctx, registered.Slug)
+		wantCode(t, err, projectError.ENOTFOUND)
+
+		if deleted, err := s.Urls.GetUserUrls(ctx, idUser, true); err != nil || len(deleted) != 1 {
+			t.Fatalf("GetUserUrls(deleted) = %+v, %v; want the deleted url", deleted, err)
+		}
+		if live, err := s.Urls.GetUserUrls(ctx, idUser, false); err != nil || len(live) != 0 {
+			t.Fatalf("GetUserUrls = %+v, %v; want none", live, err)
+		}
+
+		if _, err := s.Urls.RestoreUrl(ctx, registered.ID, actor); err != nil {
+			t.Fatalf("RestoreUrl: %v", err)
+		}
+		_, err = s.Urls.RestoreUrl(ctx, registered.ID, actor)
+		wantCode(t, err, projectError.ECONFLICT)
+
+		history, err := s.Urls.GetUrlHistory(ctx, registered.ID, idUser)
+		if err != nil {
+			t.Fatalf("GetUrlHistory: %v", err)
+		}
+
+		actions := []string{}
+		for _, item := range history {
+			actions = append(actions, item.Action)
+		}
+		want := []string{urlShortening_repo.HistoryRestore, urlShortening_repo.HistoryDelete, urlShortening_repo.HistoryUpdate, urlShortening_repo.HistoryCreate}
+		if len(actions) != len(want) {
+			t.Fatalf("history = %v; want %v", actions, want)
+		}
+		for i := range want {
+			if actions[i] != want[i] {
+				t.Fatalf("history = %v; want %v", actions, want)
+			}
+		}
+
+		update := history[2]
+		if update.OldValue == nil || *update.OldValue != "https://example.com/a" || update.NewValue == nil || *update.NewValue != other {
+			t.Fatalf("update entry = %+v; want the old and new url", update)
+		}
+	})
+}
+
+func TestRegisterUrlConcurrentDuplicates(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		idUser := registerUser(t, s, "Ada", "ada@example.com")
+
+		registered := make([]urlShortening_repo.UrlOriginal, 8)
+		errs := make([]error, len(registered))
+		var wg sync.WaitGroup
+		for i := range registered {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				url := "https://example.com/a"
+				registered[i], errs[i] = s.Urls.RegisterUrl(ctx, &url, url, urlShortening_repo.Actor{IdUser: idUser})
+			}()
+		}
+		wg.Wait()
+
+		for i := range registered {
+			if errs[i] != nil || registered[i].ID == "" || registered[i].Slug != registered[0].Slug {
+				t.Fatalf("RegisterUrl %d = %+v, %v; want the link of %+v", i, registered[i], errs[i], registered[0])
+			}
+		}
+		if urls, err := s.Urls.GetUserUrls(ctx, idUser, false); err != nil || len(urls) != 1 {
+			t.Fatalf("GetUserUrls = %+v, %v; want one url", urls, err)
+		}
+	})
+}
+
+func TestCanonicalizeUrls(t *testing.T) {
+	ctx := context.Background()
+	s := backends(t)[environment.DBDriverSQLite](t)
+	idUser := registerUser(t, s, "Ada", "ada@example.com")
+	actor := urlShortening_repo.Actor{IdUser: idUser}
+
+	// Registered with their raw form as canonical, like the links
+	// 00000005 backfilled.
+	tracked := registerUrl(t, s, "https://Example.com/a?utm_source=mail", idUser)
+	plain := registerUrl(t, s, "https://example.com/a", idUser)
+	deleted := registerUrl(t, s, "https://EXAMPLE.com/a", idUser)
+	if _, err := s.Urls.DeleteUrl(ctx, deleted.ID, actor); err != nil {
+		t.Fatal(err)
+	}
+
+	canonicalize := urlShortening_repo.CanonicalizeUrls(true)
+	if err := s.db.Db.Transaction(canonicalize); err == nil || !strings.Contains(err.Error(), tracked.ID+" and "+plain.ID) {
+		t.Fatalf("CanonicalizeUrls with duplicates = %v; want them listed", err)
+	}
+
+	if _, err := s.Urls.DeleteUrl(ctx, tracked.ID, actor); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Db.Transaction(canonicalize); err != nil {
+		t.Fatalf("CanonicalizeUrls: %v", err)
+	}
+
+	url := "https://example.com:443/a#top"
+	registered, err := s.Urls.RegisterUrl(ctx, &url, "https://example.com/a", actor)
+	if err != nil || registered.ID != plain.ID {
+		t.Fatalf("RegisterUrl after CanonicalizeUrls = %+v, %v; want the link of %+v", registered, err, plain)
+	}
+}
+
+func TestTakeDown(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		idUser := registerUser(t, s, "Ada", "ada@example.com")
+		registered := registerUrl(t, s, "https://example.com/a", idUser)
+		admin := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Admin", "admin@example.com")}
+
+		if _, err := s.Urls.TakeDownUrl(ctx, registered.ID, "phishing", admin); err != nil {
+			t.Fatalf("TakeDownUrl: %v", err)
+		}
+
+		url, err := s.Urls.GetUrl(ctx, registered.Slug)
+		if err != nil {
+			t.Fatalf("GetUrl: %v", err)
+		}
+		if reason, gone := url.Gone(time.Now()); !gone || reason != "This link was taken down: phishing" {
+			t.Fatalf("Gone = %q, %v; want the takedown", reason, gone)
+		}
+
+		if _, err := s.Urls.ReinstateUrl(ctx, registered.ID, admin); err != nil {
+			t.Fatalf("ReinstateUrl: %v", err)
+		}
+		if url, err := s.Urls.GetUrl(ctx, registered.Slug); err != nil || url.TakenDownAt != nil {
+			t.Fatalf("GetUrl after reinstating = %+v, %v; want it live", url, err)
+		}
+	})
+}
+
+func TestTransfers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		from := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Ada", "ada@example.com")}
+		to := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Alan", "alan@example.com")}
+		registered := registerUrl(t, s, "https://example.com/a", from.IdUser)
+
+		_, err := s.Urls.CreateTransfer(ctx, []string{registered.ID}, from.IdUser, from)
+		wantCode(t, err, projectError.EINVALID)
+
+		cancelled, err := s.Urls.CreateTransfer(ctx, []string{registered.ID}, to.IdUser, from)
+		if err != nil {
+			t.Fatalf("CreateTransfer: %v", err)
+		}
+		if _, err := s.Urls.CloseTransfer(ctx, cancelled.ID, urlShortening_repo.TransferCancelled, from); err != nil {
+			t.Fatalf("CloseTransfer: %v", err)
+		}
+		_, err = s.Urls.AcceptTransfer(ctx, cancelled.ID, to)
+		wantCode(t, err, projectError.ECONFLICT)
+
+		transfer, err := s.Urls.CreateTransfer(ctx, []string{registered.ID}, to.IdUser, from)
+		if err != nil {
+			t.Fatalf("CreateTransfer: %v", err)
+		}
+		_, err = s.Urls.CloseTransfer(ctx, transfer.ID, urlShortening_repo.TransferDeclined, from)
+		wantCode(t, err, projectError.ENOTFOUND)
+
+		accepted, err := s.Urls.AcceptTransfer(ctx, transfer.ID, to)
+		if err != nil || accepted.Status != urlShortening_repo.TransferAccepted {
+			t.Fatalf("AcceptTransfer = %+v, %v; want it accepted", accepted, err)
+		}
+		_, err = s.Urls.CloseTransfer(ctx, transfer.ID, urlShortening_repo.TransferCancelled, from)
+		wantCode(t, err, projectError.ECONFLICT)
+
+		if urls, err := s.Urls.GetUserUrls(ctx, to.IdUser, false); err != nil || len(urls) != 1 || urls[0].ID != registered.ID {
+			t.Fatalf("GetUserUrls of the recipient = %+v, %v; want the transferred url", urls, err)
+		}
+		if urls, err := s.Urls.GetUserUrls(ctx, from.IdUser, false); err != nil || len(urls) != 0 {
+			t.Fatalf("GetUserUrls of the sender = %+v, %v; want none", urls, err)
+		}
+	})
+}
+
+func TestDeletionTransfers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		from := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Ada", "ada@example.com")}
+		to := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Alan", "alan@example.com")}
+
+		_, err := s.Urls.CreateDeletionTransfer(ctx, to.IdUser, from)
+		wantCode(t, err, projectError.EINVALID)
+
+		kept := registerUrl(t, s, "https://example.com/a", from.IdUser)
+		deleted := registerUrl(t, s, "https://example.com/b", from.IdUser)
+		if _, err := s.Urls.DeleteUrl(ctx, deleted.ID, from); err != nil {
+			t.Fatal(err)
+		}
+
+		transfer, err := s.Urls.CreateDeletionTransfer(ctx, to.IdUser, from)
+		if err != nil || !transfer.DeleteSender || len(transfer.UrlIDs) != 1 || transfer.UrlIDs[0] != kept.ID {
+			t.Fatalf("CreateDeletionTransfer = %+v, %v; want the live url offered", transfer, err)
+		}
+		_, err = s.Urls.CreateDeletionTransfer(ctx, to.IdUser, from)
+		wantCode(t, err, projectError.ECONFLICT)
+
+		if expired, err := s.Urls.GetExpiredDeletionTransfers(ctx, transfer.CreatedAt); err != nil || len(expired) != 0 {
+			t.Fatalf("GetExpiredDeletionTransfers before it expires = %+v, %v; want none", expired, err)
+		}
+		expired, err := s.Urls.GetExpiredDeletionTransfers(ctx, time.Now().Add(time.Minute))
+		if err != nil || len(expired) != 1 || expired[0].ID != transfer.ID || !expired[0].DeleteSender {
+			t.Fatalf("GetExpiredDeletionTransfers = %+v, %v; want the transfer", expired, err)
+		}
+
+		err = s.Transaction(ctx, func(ctx context.Context) error {
+			accepted, err := s.Urls.AcceptTransfer(ctx, transfer.ID, to)
+			if err != nil {
+				return err
+			}
+			_, err = s.DeleteUser(ctx, accepted.IdUserFrom)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("accepting and deleting the sender: %v", err)
+		}
+
+		_, err = s.Users.GetUserByID(ctx, from.IdUser)
+		wantCode(t, err, projectError.ENOTFOUND)
+		if url, err := s.Urls.GetUrl(ctx, kept.Slug); err != nil || url.UrlOriginal != "https://example.com/a" {
+			t.Fatalf("GetUrl of the transferred url = %+v, %v; want it kept", url, err)
+		}
+		if urls, err := s.Urls.GetUserUrls(ctx, to.IdUser, false); err != nil || len(urls) != 1 || urls[0].ID != kept.ID {
+			t.Fatalf("GetUserUrls of the recipient = %+v, %v; want the transferred url", urls, err)
+		}
+		// The transfer went with the account.
+		_, err = s.Urls.ExpireTransfer(ctx, transfer.ID)
+		wantCode(t, err, projectError.ENOTFOUND)
+	})
+}
+
+func TestExpireTransfer(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		from := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Ada", "ada@example.com")}
+		to := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Alan", "alan@example.com")}
+		registerUrl(t, s, "https://example.com/a", from.IdUser)
+
+		transfer, err := s.Urls.CreateDeletionTransfer(ctx, to.IdUser, from)
+		if err != nil {
+			t.Fatalf("CreateDeletionTransfer: %v", err)
+		}
+
+		expired, err := s.Urls.ExpireTransfer(ctx, transfer.ID)
+		if err != nil || expired.Status != urlShortening_repo.TransferExpired {
+			t.Fatalf("ExpireTransfer = %+v, %v; want it expired", expired, err)
+		}
+		_, err = s.Urls.AcceptTransfer(ctx, transfer.ID, to)
+		wantCode(t, err, projectError.ECONFLICT)
+
+		if _, err := s.Urls.CreateDeletionTransfer(ctx, to.IdUser, from); err != nil {
+			t.Fatalf("CreateDeletionTransfer after the expiry: %v", err)
+		}
+	})
+}
+
+func TestAddClicksIgnoresRetriedBatches(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		idUser := registerUser(t, s, "Ada", "ada@example.com")
+		registered := registerUrl(t, s, "https://example.com/a", idUser)
+
+		day := time.Now().UTC().Format(time.DateOnly)
+		clicks := map[string]map[string]int64{day: {registered.Slug: 3}}
+		for range 2 {
+			if err := s.Urls.AddClicks(ctx, "batch", clicks); err != nil {
+				t.Fatalf("AddClicks: %v", err)
+			}
+		}
+
+		urls, err := s.Urls.GetUserUrls(ctx, idUser, false)
+		if err != nil || len(urls) != 1 || urls[0].Clicks != 3 {
+			t.Fatalf("GetUserUrls = %+v, %v; want 3 clicks", urls, err)
+		}
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		idUser := registerUser(t, s, "Ada", "ada@example.com")
+		registered := registerUrl(t, s, "https://example.com/a", idUser)
+
+		if _, err := s.DeleteUser(ctx, idUser); err != nil {
+			t.Fatalf("DeleteUser: %v", err)
+		}
+
+		_, err := s.Users.GetUserByID(ctx, idUser)
+		wantCode(t, err, projectError.ENOTFOUND)
+		_, err = s.Urls.GetUrl(ctx, registered.Slug)
+		wantCode(t, err, projectError.ENOTFOUND)
+	})
+}
+
+func TestTransactionRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := backends(t)[environment.DBDriverSQLite](t)
+	idUser := registerUser(t, s, "Ada", "ada@example.com")
+	registered := registerUrl(t, s, "https://example.com/a", idUser)
+
+	err := s.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.Urls.PurgeUserUrls(ctx, idUser); err != nil {
+			return err
+		}
+		return s.Users.DeleteUser(ctx, "missing")
+	})
+	wantCode(t, err, projectError.ENOTFOUND)
+
+	if url, err := s.Urls.GetUrl(ctx, registered.Slug); err != nil || url.UrlOriginal != "https://example.com/a" {
+		t.Fatalf("GetUrl after the rollback = %+v, %v; want the url kept", url, err)
+	}
+}
+
+func TestNestedTransactionRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := backends(t)[environment.DBDriverSQLite](t)
+	from := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Ada", "ada@example.com")}
+	to := urlShortening_repo.Actor{IdUser: registerUser(t, s, "Alan", "alan@example.com")}
+	registered := registerUrl(t, s, "https://example.com/a", from.IdUser)
+
+	transfer, err := s.Urls.CreateDeletionTransfer(ctx, to.IdUser, from)
+	if err != nil {
+		t.Fatalf("CreateDeletionTransfer: %v", err)
+	}
+
+	failed := errors.New("failed")
+	err = s.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.Urls.AcceptTransfer(ctx, transfer.ID, to); err != nil {
+			return err
+		}
+		if _, err := s.DeleteUser(ctx, from.IdUser); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Transaction = %v; want %v", err, failed)
+	}
+
+	if _, err := s.Users.GetUserByID(ctx, from.IdUser); err != nil {
+		t.Fatalf("GetUserByID after the rollback: %v; want the user kept", err)
+	}
+	if urls, err := s.Urls.GetUserUrls(ctx, from.IdUser, false); err != nil || len(urls) != 1 || urls[0].ID != registered.ID {
+		t.Fatalf("GetUserUrls after the rollback = %+v, %v; want the url kept by the sender", urls, err)
+	}
+}
+
+func TestForEachSlug(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		idUser := registerUser(t, s, "Ada", "ada@example.com")
+		kept := registerUrl(t, s, "https://example.com/a", idUser)
+		deleted := registerUrl(t, s, "https://example.com/b", idUser)
+		if _, err := s.Urls.DeleteUrl(ctx, deleted.ID, urlShortening_repo.Actor{IdUser: idUser}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, since := range []time.Time{{}, time.Now().Add(-time.Minute)} {
+			slugs := map[string]bool{}
+			err := s.Urls.ForEachSlug(ctx, since, func(slug string) { slugs[slug] = true })
+			if err != nil || !slugs[kept.Slug] || slugs[deleted.Slug] {
+				t.Fatalf("ForEachSlug(%v) = %v, %v; want the live slug only", since, slugs, err)
+			}
+		}
+
+		// The memory backend may return every slug; the SQL ones filter.
+		if s.db != nil {
+			err := s.Urls.ForEachSlug(ctx, time.Now().Add(time.Hour), func(slug string) {
+				t.Fatalf("ForEachSlug of the future returned %q", slug)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
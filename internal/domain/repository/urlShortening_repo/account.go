@@ -0,0 +1,60 @@
+package urlShortening_repo
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// DeletedUser replaces the id of a deleted user in the history of the links
+// they touched but did not own.
+const DeletedUser = "deleted"
+
+// PurgeUserUrls deletes for good the links of idUser with their history,
+// click counts and the transfers idUser sent or received, and returns their
+// slugs. The history idUser left on links of other users is anonymized.
+func (r *UrlShorteningRepository) PurgeUserUrls(ctx context.Context, idUser string) ([]string, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	slugs := []string{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw(`SELECT slug FROM url_shortening WHERE id_user = ?`, idUser).Scan(&slugs).Error; err != nil {
+			return err
+		}
+
+		owned := `SELECT id FROM url_shortening WHERE id_user = ?`
+		transfers := `SELECT id FROM url_transfers WHERE id_user_from = ? OR id_user_to = ?`
+
+		statements := []struct {
+			query string
+			args  []any
+		}{
+			{`DELETE FROM url_transfer_items WHERE id_transfer IN (` + transfers + `)`, []any{idUser, idUser}},
+			{`DELETE FROM url_transfers WHERE id_user_from = ? OR id_user_to = ?`, []any{idUser, idUser}},
+			{`DELETE FROM url_transfer_items WHERE id_url IN (` + owned + `)`, []any{idUser}},
+			{`DELETE FROM url_clicks_daily WHERE id_url IN (` + owned + `)`, []any{idUser}},
+			{`DELETE FROM url_shortening_history WHERE id_url IN (` + owned + `)`, []any{idUser}},
+			{`DELETE FROM url_shortening WHERE id_user = ?`, []any{idUser}},
+			{`UPDATE url_shortening_history SET id_user = ?, client_ip = '' WHERE id_user = ?`, []any{DeletedUser, idUser}},
+			{`UPDATE url_shortening_history SET old_value = ? WHERE action = ? AND old_value = ?`, []any{DeletedUser, HistoryTransfer, idUser}},
+			{`UPDATE url_shortening_history SET new_value = ? WHERE action = ? AND new_value = ?`, []any{DeletedUser, HistoryTransfer, idUser}},
+		}
+
+		for _, statement := range statements {
+			if err := tx.Exec(statement.query, statement.args...).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return []string{}, err
+	}
+
+	r.db.Written(append([]string{userKey(idUser)}, slugs...)...)
+
+	return slugs, nil
+}
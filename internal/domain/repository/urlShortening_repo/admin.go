@@ -0,0 +1,238 @@
+package urlShortening_repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"url_shortening/infra/db/sqldb"
+	"url_shortening/pkg/projectError"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of links, to filter the admin list.
+const (
+	StatusLive      = "live"
+	StatusDeleted   = "deleted"
+	StatusExpired   = "expired"
+	StatusTakenDown = "taken_down"
+)
+
+// UrlFilter selects the links listed to admins. Empty fields match every
+// link.
+type UrlFilter struct {
+	// Search matches the destination or the slug.
+	Search string
+	IdUser string
+	Status string
+}
+
+// AdminUrlItem is a link of any user, as listed to admins.
+type AdminUrlItem struct {
+	ID             string     `json:"id"`
+	IdUser         string     `json:"id_user"`
+	UrlOriginal    string     `json:"url_original"`
+	UrlShortened   string     `json:"url_shortened"`
+	Slug           string     `json:"slug"`
+	Clicks         int64      `json:"clicks"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeletedAt      *time.Time `json:"deleted_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	TakenDownAt    *time.Time `json:"taken_down_at"`
+	TakedownReason *string    `json:"takedown_reason"`
+}
+
+// UrlStats counts the links for the admin dashboard. Expired and taken down
+// links are not counted as live.
+type UrlStats struct {
+	Total     int64 `json:"total"`
+	Live      int64 `json:"live"`
+	Deleted   int64 `json:"deleted"`
+	Expired   int64 `json:"expired"`
+	TakenDown int64 `json:"taken_down"`
+	Clicks    int64 `json:"clicks"`
+}
+
+const adminUrlColumns = `id, id_user, url_original, url_shortened, slug, clicks, created_at, deleted_at, expires_at, taken_down_at, takedown_reason`
+
+// ListUrls returns a page of the links of every user matching filter,
+// newest first, with the number of links matching.
+func (r *UrlShorteningRepository) ListUrls(ctx context.Context, filter UrlFilter, limit int, offset int) ([]AdminUrlItem, int64, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	now := time.Now()
+	pattern := sqldb.Contains(filter.Search)
+
+	where := `(LOWER(url_original) LIKE ? ESCAPE '\' OR LOWER(slug) LIKE ? ESCAPE '\')`
+	args := []any{pattern, pattern}
+
+	if filter.IdUser != "" {
+		where += ` AND id_user = ?`
+		args = append(args, filter.IdUser)
+	}
+
+	switch filter.Status {
+	case StatusLive:
+		where += ` AND deleted_at IS NULL AND taken_down_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`
+		args = append(args, now)
+	case StatusDeleted:
+		where += ` AND deleted_at IS NOT NULL`
+	case StatusExpired:
+		where += ` AND deleted_at IS NULL AND taken_down_at IS NULL AND expires_at <= ?`
+		args = append(args, now)
+	case StatusTakenDown:
+		where += ` AND deleted_at IS NULL AND taken_down_at IS NOT NULL`
+	}
+
+	var total int64
+	if err := db.Raw(`SELECT COUNT(*) FROM url_shortening WHERE `+where, args...).Row().Scan(&total); err != nil {
+		return []AdminUrlItem{}, 0, err
+	}
+
+	query := `SELECT ` + adminUrlColumns + ` FROM url_shortening WHERE ` + where + ` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`
+	rows, err := db.Raw(query, append(args, limit, offset)...).Rows()
+	if err != nil {
+		return []AdminUrlItem{}, 0, err
+	}
+	defer rows.Close()
+
+	urls := []AdminUrlItem{}
+	for rows.Next() {
+		var url AdminUrlItem
+		var deletedAt, expiresAt, takenDownAt sql.NullTime
+		var takedownReason sql.NullString
+
+		err := rows.Scan(&url.ID, &url.IdUser, &url.UrlOriginal, &url.UrlShortened, &url.Slug, &url.Clicks, &url.CreatedAt, &deletedAt, &expiresAt, &takenDownAt, &takedownReason)
+		if err != nil {
+			return []AdminUrlItem{}, 0, err
+		}
+
+		if deletedAt.Valid {
+			url.DeletedAt = &deletedAt.Time
+		}
+		if expiresAt.Valid {
+			url.ExpiresAt = &expiresAt.Time
+		}
+		if takenDownAt.Valid {
+			url.TakenDownAt = &takenDownAt.Time
+		}
+		if takedownReason.Valid {
+			url.TakedownReason = &takedownReason.String
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls, total, rows.Err()
+}
+
+// moderateUrl runs change on the live link id for an admin, in a transaction,
+// and returns the link. Deleted links cannot be moderated. The row is locked
+// so an owner's edit cannot slip in between the read and the change.
+func (r *UrlShorteningRepository) moderateUrl(ctx context.Context, id string, change func(tx *gorm.DB, url UrlOriginal) error) (UrlOriginal, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var url UrlOriginal
+	var idUser string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := `SELECT id, id_user, url_original, url_shortened, slug FROM url_shortening WHERE id = ? AND deleted_at IS NULL`
+		rows, err := tx.Raw(query+sqldb.ForUpdate(tx), id).Rows()
+		if err != nil {
+			return err
+		}
+
+		found := rows.Next()
+		if found {
+			err = rows.Scan(&url.ID, &idUser, &url.UrlOriginal, &url.UrlShortened, &url.Slug)
+		}
+		rows.Close()
+		if err != nil {
+			return err
+		} else if !found {
+			return projectError.Errorf(projectError.ENOTFOUND, "url not found")
+		}
+
+		return change(tx, url)
+	})
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+
+	r.db.Written(userKey(idUser), url.Slug)
+
+	return url, nil
+}
+
+// ExpireUrl makes the link id stop redirecting from at.
+func (r *UrlShorteningRepository) ExpireUrl(ctx context.Context, id string, at time.Time, actor Actor) (UrlOriginal, error) {
+	return r.moderateUrl(ctx, id, func(tx *gorm.DB, url UrlOriginal) error {
+		var previous sql.NullTime
+		if err := tx.Raw(`SELECT expires_at FROM url_shortening WHERE id = ?`, id).Row().Scan(&previous); err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`UPDATE url_shortening SET expires_at = ?, updated_at = ? WHERE id = ?`, at, time.Now(), id).Error; err != nil {
+			return err
+		}
+
+		expiresAt := at.UTC().Format(time.RFC3339)
+		var oldValue *string
+		if previous.Valid {
+			formatted := previous.Time.UTC().Format(time.RFC3339)
+			oldValue = &formatted
+		}
+		return insertHistory(tx, id, HistoryExpire, oldValue, &expiresAt, actor)
+	})
+}
+
+// TakeDownUrl stops the link id from redirecting, showing reason to its
+// visitors instead. Taking down a link again replaces the reason.
+func (r *UrlShorteningRepository) TakeDownUrl(ctx context.Context, id string, reason string, actor Actor) (UrlOriginal, error) {
+	return r.moderateUrl(ctx, id, func(tx *gorm.DB, url UrlOriginal) error {
+		now := time.Now()
+		query := `UPDATE url_shortening SET taken_down_at = COALESCE(taken_down_at, ?), takedown_reason = ?, updated_at = ? WHERE id = ?`
+		if err := tx.Exec(query, now, reason, now, id).Error; err != nil {
+			return err
+		}
+
+		return insertHistory(tx, id, HistoryTakedown, nil, &reason, actor)
+	})
+}
+
+// ReinstateUrl lifts the takedown and expiry of the link id, which
+// redirects again.
+func (r *UrlShorteningRepository) ReinstateUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error) {
+	return r.moderateUrl(ctx, id, func(tx *gorm.DB, url UrlOriginal) error {
+		query := `UPDATE url_shortening SET taken_down_at = NULL, takedown_reason = NULL, expires_at = NULL, updated_at = ? WHERE id = ?`
+		if err := tx.Exec(query, time.Now(), id).Error; err != nil {
+			return err
+		}
+
+		return insertHistory(tx, id, HistoryReinstate, nil, nil, actor)
+	})
+}
+
+func (r *UrlShorteningRepository) GetUrlStats(ctx context.Context) (UrlStats, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	now := time.Now()
+
+	var stats UrlStats
+	query := `SELECT COUNT(*),
+		COALESCE(SUM(CASE WHEN deleted_at IS NULL AND taken_down_at IS NULL AND (expires_at IS NULL OR expires_at > ?) THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN deleted_at IS NOT NULL THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN deleted_at IS NULL AND taken_down_at IS NULL AND expires_at <= ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN deleted_at IS NULL AND taken_down_at IS NOT NULL THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(clicks), 0)
+		FROM url_shortening`
+	err := db.Raw(query, now, now).Row().Scan(&stats.Total, &stats.Live, &stats.Deleted, &stats.Expired, &stats.TakenDown, &stats.Clicks)
+	if err != nil {
+		return UrlStats{}, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,67 @@
+package urlShortening_repo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"url_shortening/pkg/urlPkg"
+
+	"gorm.io/gorm"
+)
+
+// CanonicalizeUrls returns the migration step that sets url_canonical and its
+// hash from url_original with the rules RegisterUrl is given links with. URLs
+// that no longer parse keep their canonical form. The step fails, listing
+// them, when a user has two live links to the same canonical URL: one of each
+// must be deleted before the unique index can be built.
+func CanonicalizeUrls(stripTracking bool) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		var urls []struct {
+			ID           string
+			IdUser       string
+			UrlOriginal  string
+			UrlCanonical string
+			DeletedAt    *time.Time
+		}
+		query := `SELECT id, id_user, url_original, url_canonical, deleted_at FROM url_shortening ORDER BY id`
+		if err := tx.Raw(query).Scan(&urls).Error; err != nil {
+			return err
+		}
+
+		live := map[string]string{}
+		duplicates := []string{}
+		canonicals := make([]string, len(urls))
+		for i, url := range urls {
+			canonical, err := urlPkg.Canonicalize(url.UrlOriginal, stripTracking)
+			if err != nil {
+				canonical = url.UrlCanonical
+			}
+			canonicals[i] = canonical
+
+			if url.DeletedAt == nil {
+				key := url.IdUser + " " + urlPkg.Hash(canonical)
+				if other, ok := live[key]; ok {
+					duplicates = append(duplicates, other+" and "+url.ID)
+				}
+				live[key] = url.ID
+			}
+		}
+
+		if len(duplicates) > 0 {
+			return fmt.Errorf("links of the same user point to the same canonical url, delete one of each and migrate again: %s", strings.Join(duplicates, ", "))
+		}
+
+		for i, url := range urls {
+			if canonicals[i] == url.UrlCanonical {
+				continue
+			}
+
+			query := `UPDATE url_shortening SET url_canonical = ?, url_canonical_hash = ? WHERE id = ?`
+			if err := tx.Exec(query, canonicals[i], urlPkg.Hash(canonicals[i]), url.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
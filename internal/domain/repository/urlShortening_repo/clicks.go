@@ -0,0 +1,86 @@
+package urlShortening_repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// clickFlushRetention is how long applied batch ids are kept. A batch is only
+// retried while it is still in Redis, which is minutes, not days.
+const clickFlushRetention = 24 * time.Hour
+
+// AddClicks adds a batch of clicks, keyed by day and slug, to the per-link
+// totals and daily counts. A batch id that was already applied is ignored, so
+// retrying a batch never counts it twice. It is a bulk write, so only ctx
+// bounds it, not the per-query timeout.
+func (r *UrlShorteningRepository) AddClicks(ctx context.Context, batch string, clicks map[string]map[string]int64) error {
+	db := r.db.Db.WithContext(ctx)
+
+	now := time.Now()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`INSERT INTO url_click_flushes (id, created_at) VALUES (?,?) ON CONFLICT DO NOTHING`, batch, now)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return nil
+		}
+
+		totals := map[string]int64{}
+		for day, counts := range clicks {
+			for slug, count := range counts {
+				query := `INSERT INTO url_clicks_daily (id_url, day, clicks) SELECT id, ?, ? FROM url_shortening WHERE slug = ?
+					ON CONFLICT (id_url, day) DO UPDATE SET clicks = url_clicks_daily.clicks + EXCLUDED.clicks`
+				if err := tx.Exec(query, day, count, slug).Error; err != nil {
+					return err
+				}
+				totals[slug] += count
+			}
+		}
+
+		for slug, count := range totals {
+			if err := tx.Exec(`UPDATE url_shortening SET clicks = clicks + ? WHERE slug = ?`, count, slug).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec(`DELETE FROM url_click_flushes WHERE created_at < ?`, now.Add(-clickFlushRetention)).Error
+	})
+}
+
+type UrlDailyClicks struct {
+	Day    string `json:"day"`
+	Clicks int64  `json:"clicks"`
+}
+
+// GetUrlClicks returns the flushed daily click counts of a link of idUser,
+// oldest first. Days past the retention of the owner's plan are gone.
+func (r *UrlShorteningRepository) GetUrlClicks(ctx context.Context, id string, idUser string) ([]UrlDailyClicks, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	if _, err := r.getOwnedUrl(db, id, idUser); err != nil {
+		return []UrlDailyClicks{}, err
+	}
+
+	rows, err := db.Raw(`SELECT day, clicks FROM url_clicks_daily WHERE id_url = ? ORDER BY day`, id).Rows()
+	if err != nil {
+		return []UrlDailyClicks{}, err
+	}
+	defer rows.Close()
+
+	clicks := []UrlDailyClicks{}
+	for rows.Next() {
+		var day time.Time
+		var item UrlDailyClicks
+		if err := rows.Scan(&day, &item.Clicks); err != nil {
+			return []UrlDailyClicks{}, err
+		}
+		item.Day = day.Format(time.DateOnly)
+		clicks = append(clicks, item)
+	}
+
+	return clicks, nil
+}
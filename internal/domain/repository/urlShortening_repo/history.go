@@ -0,0 +1,108 @@
+package urlShortening_repo
+
+import (
+	"context"
+	"time"
+	"url_shortening/pkg/projectError"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	HistoryCreate   = "create"
+	HistoryUpdate   = "update"
+	HistoryRevert   = "revert"
+	HistoryDelete   = "delete"
+	HistoryRestore  = "restore"
+	HistoryTransfer = "transfer"
+	// Moderation by admins.
+	HistoryExpire    = "expire"
+	HistoryTakedown  = "takedown"
+	HistoryReinstate = "reinstate"
+)
+
+// Actor identifies who is changing a link, for the history table.
+type Actor struct {
+	IdUser   string
+	ClientIP string
+}
+
+type UrlHistoryItem struct {
+	ID        string    `json:"id"`
+	IdUrl     string    `json:"id_url"`
+	IdUser    string    `json:"id_user"`
+	Action    string    `json:"action"`
+	OldValue  *string   `json:"old_value"`
+	NewValue  *string   `json:"new_value"`
+	ClientIP  string    `json:"client_ip"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// insertHistory appends an entry to url_shortening_history. It must run in the
+// same transaction as the change it describes.
+func insertHistory(tx *gorm.DB, idUrl string, action string, oldValue *string, newValue *string, actor Actor) error {
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO url_shortening_history (id, id_url, id_user, action, old_value, new_value, client_ip) VALUES (?,?,?,?,?,?,?)`
+	return tx.Exec(query, uniqueID, idUrl, actor.IdUser, action, oldValue, newValue, actor.ClientIP).Error
+}
+
+func (r *UrlShorteningRepository) GetUrlHistory(ctx context.Context, id string, idUser string) ([]UrlHistoryItem, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	if _, err := r.getOwnedUrl(db, id, idUser); err != nil {
+		return []UrlHistoryItem{}, err
+	}
+
+	query := `SELECT id, id_url, id_user, action, old_value, new_value, client_ip, created_at FROM url_shortening_history WHERE id_url = ? ORDER BY created_at DESC, id DESC`
+	rows, err := db.Raw(query, id).Rows()
+	if err != nil {
+		return []UrlHistoryItem{}, err
+	}
+	defer rows.Close()
+
+	history := []UrlHistoryItem{}
+	for rows.Next() {
+		var item UrlHistoryItem
+		err = rows.Scan(&item.ID, &item.IdUrl, &item.IdUser, &item.Action, &item.OldValue, &item.NewValue, &item.ClientIP, &item.CreatedAt)
+		if err != nil {
+			return []UrlHistoryItem{}, err
+		}
+		history = append(history, item)
+	}
+
+	return history, nil
+}
+
+func (r *UrlShorteningRepository) GetUrlHistoryEntry(ctx context.Context, id string, idHistory string, idUser string) (UrlHistoryItem, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	if _, err := r.getOwnedUrl(db, id, idUser); err != nil {
+		return UrlHistoryItem{}, err
+	}
+
+	query := `SELECT id, id_url, id_user, action, old_value, new_value, client_ip, created_at FROM url_shortening_history WHERE id = ? AND id_url = ?`
+	rows, err := db.Raw(query, idHistory, id).Rows()
+	if err != nil {
+		return UrlHistoryItem{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return UrlHistoryItem{}, projectError.Errorf(projectError.ENOTFOUND, "history entry not found")
+	}
+
+	var item UrlHistoryItem
+	err = rows.Scan(&item.ID, &item.IdUrl, &item.IdUser, &item.Action, &item.OldValue, &item.NewValue, &item.ClientIP, &item.CreatedAt)
+	if err != nil {
+		return UrlHistoryItem{}, err
+	}
+
+	return item, nil
+}
@@ -0,0 +1,184 @@
+package urlShortening_repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"url_shortening/infra/db/sqldb"
+	"url_shortening/pkg/projectError"
+	"url_shortening/pkg/urlPkg"
+
+	"gorm.io/gorm"
+)
+
+type ownedUrl struct {
+	Url              UrlOriginal
+	UrlCanonicalHash string
+	DeletedAt        sql.NullTime
+}
+
+const ownedUrlQuery = `SELECT id, url_original, url_shortened, slug, url_canonical_hash, deleted_at FROM url_shortening WHERE id = ? AND id_user = ?`
+
+func (r *UrlShorteningRepository) getOwnedUrl(db *gorm.DB, id string, idUser string) (ownedUrl, error) {
+	return scanOwnedUrl(db.Raw(ownedUrlQuery, id, idUser))
+}
+
+// lockOwnedUrl is getOwnedUrl for a transaction that changes the link. The
+// row stays locked until the transaction ends, so concurrent changes run one
+// after the other and each records the previous one as its old value.
+func (r *UrlShorteningRepository) lockOwnedUrl(tx *gorm.DB, id string, idUser string) (ownedUrl, error) {
+	return scanOwnedUrl(tx.Raw(ownedUrlQuery+sqldb.ForUpdate(tx), id, idUser))
+}
+
+func scanOwnedUrl(query *gorm.DB) (ownedUrl, error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return ownedUrl{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return ownedUrl{}, projectError.Errorf(projectError.ENOTFOUND, "url not found")
+	}
+
+	var url ownedUrl
+	err = rows.Scan(&url.Url.ID, &url.Url.UrlOriginal, &url.Url.UrlShortened, &url.Url.Slug, &url.UrlCanonicalHash, &url.DeletedAt)
+	if err != nil {
+		return ownedUrl{}, err
+	}
+
+	return url, nil
+}
+
+// hasLiveDuplicate reports whether idUser already has another live link with
+// the same canonical URL hash.
+func hasLiveDuplicate(db *gorm.DB, id string, idUser string, urlCanonicalHash string) (bool, error) {
+	var count int64
+	query := `SELECT COUNT(*) FROM url_shortening WHERE id_user = ? AND url_canonical_hash = ? AND id <> ? AND deleted_at IS NULL`
+	if err := db.Raw(query, idUser, urlCanonicalHash, id).Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// UpdateUrl changes the destination of a live link. action is recorded in the
+// history and is either HistoryUpdate or HistoryRevert.
+func (r *UrlShorteningRepository) UpdateUrl(ctx context.Context, id string, url string, urlCanonical string, action string, actor Actor) (UrlOriginal, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var updated UrlOriginal
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		current, err := r.lockOwnedUrl(tx, id, actor.IdUser)
+		if err != nil {
+			return err
+		}
+
+		if current.DeletedAt.Valid {
+			return projectError.Errorf(projectError.ENOTFOUND, "url not found")
+		}
+
+		updated = current.Url
+		if current.Url.UrlOriginal == url {
+			return nil
+		}
+
+		urlCanonicalHash := urlPkg.Hash(urlCanonical)
+		duplicate, err := hasLiveDuplicate(tx, id, actor.IdUser, urlCanonicalHash)
+		if err != nil {
+			return err
+		} else if duplicate {
+			return projectError.Errorf(projectError.ECONFLICT, "url already shortened")
+		}
+
+		query := `UPDATE url_shortening SET url_original = ?, url_canonical = ?, url_canonical_hash = ?, updated_at = ? WHERE id = ?`
+		if err := tx.Exec(query, url, urlCanonical, urlCanonicalHash, time.Now(), id).Error; err != nil {
+			return err
+		}
+
+		updated.UrlOriginal = url
+		return insertHistory(tx, id, action, &current.Url.UrlOriginal, &url, actor)
+	})
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+
+	r.db.Written(userKey(actor.IdUser), updated.Slug)
+
+	return updated, nil
+}
+
+func (r *UrlShorteningRepository) DeleteUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var deleted UrlOriginal
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		current, err := r.lockOwnedUrl(tx, id, actor.IdUser)
+		if err != nil {
+			return err
+		}
+
+		if current.DeletedAt.Valid {
+			return projectError.Errorf(projectError.ENOTFOUND, "url not found")
+		}
+
+		now := time.Now()
+		query := `UPDATE url_shortening SET deleted_at = ?, updated_at = ? WHERE id = ?`
+		if err := tx.Exec(query, now, now, id).Error; err != nil {
+			return err
+		}
+
+		deleted = current.Url
+		return insertHistory(tx, id, HistoryDelete, &current.Url.UrlOriginal, nil, actor)
+	})
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+
+	r.db.Written(userKey(actor.IdUser), deleted.Slug)
+
+	return deleted, nil
+}
+
+func (r *UrlShorteningRepository) RestoreUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var restored UrlOriginal
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		current, err := r.lockOwnedUrl(tx, id, actor.IdUser)
+		if err != nil {
+			return err
+		}
+
+		if !current.DeletedAt.Valid {
+			return projectError.Errorf(projectError.ECONFLICT, "url is not deleted")
+		}
+
+		duplicate, err := hasLiveDuplicate(tx, id, actor.IdUser, current.UrlCanonicalHash)
+		if err != nil {
+			return err
+		} else if duplicate {
+			return projectError.Errorf(projectError.ECONFLICT, "url already shortened")
+		}
+
+		query := `UPDATE url_shortening SET deleted_at = NULL, updated_at = ? WHERE id = ?`
+		if err := tx.Exec(query, time.Now(), id).Error; err != nil {
+			return err
+		}
+
+		restored = current.Url
+		return insertHistory(tx, id, HistoryRestore, nil, &current.Url.UrlOriginal, actor)
+	})
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+
+	r.db.Written(userKey(actor.IdUser), restored.Slug)
+
+	return restored, nil
+}
@@ -0,0 +1,774 @@
+package urlShortening_repo
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/pkg/projectError"
+	"url_shortening/pkg/urlPkg"
+
+	"github.com/google/uuid"
+)
+
+// MemoryRepository keeps links in process memory with the same behaviour as
+// the SQL repository. Nothing survives a restart and nothing is shared between
+// instances, so it is meant for development and tests.
+type MemoryRepository struct {
+	mu        sync.RWMutex
+	config    *environment.Config
+	urls      map[string]*memoryUrl
+	slugs     map[string]string
+	history   map[string][]UrlHistoryItem
+	transfers map[string]*UrlTransfer
+	flushes   map[string]time.Time
+}
+
+type memoryUrl struct {
+	Url              UrlOriginal
+	IdUser           string
+	UrlCanonicalHash string
+	CreatedAt        time.Time
+	DeletedAt        time.Time
+	Clicks           int64
+	DailyClicks      map[string]int64
+}
+
+func (u *memoryUrl) deleted() bool {
+	return !u.DeletedAt.IsZero()
+}
+
+func NewMemoryRepository(config *environment.Config) *MemoryRepository {
+	return &MemoryRepository{
+		config:    config,
+		urls:      map[string]*memoryUrl{},
+		slugs:     map[string]string{},
+		history:   map[string][]UrlHistoryItem{},
+		transfers: map[string]*UrlTransfer{},
+		flushes:   map[string]time.Time{},
+	}
+}
+
+func (r *MemoryRepository) RegisterUrl(ctx context.Context, url *string, urlCanonical string, actor Actor) (UrlOriginal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	urlCanonicalHash := urlPkg.Hash(urlCanonical)
+	if existing := r.liveDuplicate("", actor.IdUser, urlCanonicalHash); existing != nil {
+		return UrlOriginal{
+			ID:           existing.Url.ID,
+			UrlOriginal:  existing.Url.UrlOriginal,
+			UrlShortened: existing.Url.UrlShortened,
+			Slug:         existing.Url.Slug,
+		}, nil
+	}
+
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+
+	slug := uniqueID.String()[len(uniqueID.String())-8:]
+	if _, ok := r.slugs[slug]; ok {
+		return UrlOriginal{}, projectError.Errorf(projectError.ECONFLICT, "slug %s already exists", slug)
+	}
+
+	created := &memoryUrl{
+		Url: UrlOriginal{
+			ID:           uniqueID.String(),
+			UrlOriginal:  *url,
+			UrlShortened: r.config.URL_SHORTENED_PREFIX + "/" + slug,
+			Slug:         slug,
+		},
+		IdUser:           actor.IdUser,
+		UrlCanonicalHash: urlCanonicalHash,
+		CreatedAt:        time.Now(),
+		DailyClicks:      map[string]int64{},
+	}
+
+	r.urls[created.Url.ID] = created
+	r.slugs[slug] = created.Url.ID
+	r.appendHistory(created.Url.ID, HistoryCreate, nil, url, actor)
+
+	return created.Url, nil
+}
+
+func (r *MemoryRepository) GetUrl(ctx context.Context, urlShortened string) (UrlOriginal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	url, ok := r.urls[r.slugs[urlShortened]]
+	if !ok || url.deleted() {
+		return UrlOriginal{}, projectError.Errorf(projectError.ENOTFOUND, "URL not found")
+	}
+
+	return UrlOriginal{
+		UrlOriginal:    url.Url.UrlOriginal,
+		UrlShortened:   url.Url.UrlShortened,
+		Slug:           url.Url.Slug,
+		ExpiresAt:      url.Url.ExpiresAt,
+		TakenDownAt:    url.Url.TakenDownAt,
+		TakedownReason: url.Url.TakedownReason,
+	}, nil
+}
+
+func (r *MemoryRepository) GetUserUrls(ctx context.Context, idUser string, deleted bool) ([]UrlListItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var owned []*memoryUrl
+	for _, url := range r.urls {
+		if url.IdUser == idUser && url.deleted() == deleted {
+			owned = append(owned, url)
+		}
+	}
+
+	sort.Slice(owned, func(i, j int) bool {
+		if deleted {
+			return owned[i].DeletedAt.After(owned[j].DeletedAt)
+		}
+		return owned[i].CreatedAt.After(owned[j].CreatedAt)
+	})
+
+	urls := []UrlListItem{}
+	for _, url := range owned {
+		urls = append(urls, UrlListItem{
+			ID:           url.Url.ID,
+			UrlOriginal:  url.Url.UrlOriginal,
+			UrlShortened: url.Url.UrlShortened,
+			Slug:         url.Url.Slug,
+			CreatedAt:    url.CreatedAt.Format(time.RFC3339Nano),
+			Clicks:       url.Clicks,
+		})
+	}
+
+	return urls, nil
+}
+
+// ForEachSlug ignores since: the memory backend serves a single instance,
+// whose slug filter misses no change.
+func (r *MemoryRepository) ForEachSlug(ctx context.Context, since time.Time, fn func(slug string)) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, url := range r.urls {
+		if !url.deleted() {
+			fn(url.Url.Slug)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateUrl(ctx context.Context, id string, url string, urlCanonical string, action string, actor Actor) (UrlOriginal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, err := r.getOwnedUrl(id, actor.IdUser)
+	if err != nil {
+		return UrlOriginal{}, err
+	} else if current.deleted() {
+		return UrlOriginal{}, projectError.Errorf(projectError.ENOTFOUND, "url not found")
+	}
+
+	if current.Url.UrlOriginal == url {
+		return current.Url, nil
+	}
+
+	urlCanonicalHash := urlPkg.Hash(urlCanonical)
+	if r.liveDuplicate(id, actor.IdUser, urlCanonicalHash) != nil {
+		return UrlOriginal{}, projectError.Errorf(projectError.ECONFLICT, "url already shortened")
+	}
+
+	previous := current.Url.UrlOriginal
+	current.Url.UrlOriginal = url
+	current.UrlCanonicalHash = urlCanonicalHash
+	r.appendHistory(id, action, &previous, &url, actor)
+
+	return current.Url, nil
+}
+
+func (r *MemoryRepository) DeleteUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, err := r.getOwnedUrl(id, actor.IdUser)
+	if err != nil {
+		return UrlOriginal{}, err
+	} else if current.deleted() {
+		return UrlOriginal{}, projectError.Errorf(projectError.ENOTFOUND, "url not found")
+	}
+
+	current.DeletedAt = time.Now()
+	r.appendHistory(id, HistoryDelete, &current.Url.UrlOriginal, nil, actor)
+
+	return current.Url, nil
+}
+
+func (r *MemoryRepository) RestoreUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, err := r.getOwnedUrl(id, actor.IdUser)
+	if err != nil {
+		return UrlOriginal{}, err
+	} else if !current.deleted() {
+		return UrlOriginal{}, projectError.Errorf(projectError.ECONFLICT, "url is not deleted")
+	}
+
+	if r.liveDuplicate(id, actor.IdUser, current.UrlCanonicalHash) != nil {
+		return UrlOriginal{}, projectError.Errorf(projectError.ECONFLICT, "url already shortened")
+	}
+
+	current.DeletedAt = time.Time{}
+	r.appendHistory(id, HistoryRestore, nil, &current.Url.UrlOriginal, actor)
+
+	return current.Url, nil
+}
+
+func (r *MemoryRepository) GetUrlHistory(ctx context.Context, id string, idUser string) ([]UrlHistoryItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := r.getOwnedUrl(id, idUser); err != nil {
+		return []UrlHistoryItem{}, err
+	}
+
+	history := slices.Clone(r.history[id])
+	slices.Reverse(history)
+	if history == nil {
+		history = []UrlHistoryItem{}
+	}
+
+	return history, nil
+}
+
+func (r *MemoryRepository) GetUrlHistoryEntry(ctx context.Context, id string, idHistory string, idUser string) (UrlHistoryItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := r.getOwnedUrl(id, idUser); err != nil {
+		return UrlHistoryItem{}, err
+	}
+
+	for _, item := range r.history[id] {
+		if item.ID == idHistory {
+			return item, nil
+		}
+	}
+
+	return UrlHistoryItem{}, projectError.Errorf(projectError.ENOTFOUND, "history entry not found")
+}
+
+func (r *MemoryRepository) CreateTransfer(ctx context.Context, ids []string, idUserTo string, actor Actor) (UrlTransfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if idUserTo == actor.IdUser {
+		return UrlTransfer{}, projectError.Errorf(projectError.EINVALID, "cannot transfer urls to yourself")
+	}
+
+	for _, id := range ids {
+		url, err := r.getOwnedUrl(id, actor.IdUser)
+		if err != nil {
+			return UrlTransfer{}, err
+		} else if url.deleted() {
+			return UrlTransfer{}, projectError.Errorf(projectError.ENOTFOUND, "url not found")
+		}
+	}
+
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	urlIDs := slices.Clone(ids)
+	slices.Sort(urlIDs)
+
+	transfer := UrlTransfer{
+		ID:         uniqueID.String(),
+		IdUserFrom: actor.IdUser,
+		IdUserTo:   idUserTo,
+		Status:     TransferPending,
+		UrlIDs:     slices.Compact(urlIDs),
+		CreatedAt:  time.Now(),
+	}
+	r.transfers[transfer.ID] = &transfer
+
+	created := transfer
+	created.UrlIDs = ids
+	return created, nil
+}
+
+func (r *MemoryRepository) CreateDeletionTransfer(ctx context.Context, idUserTo string, actor Actor) (UrlTransfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if idUserTo == actor.IdUser {
+		return UrlTransfer{}, projectError.Errorf(projectError.EINVALID, "cannot transfer urls to yourself")
+	}
+
+	for _, transfer := range r.transfers {
+		if transfer.IdUserFrom == actor.IdUser && transfer.Status == TransferPending && transfer.DeleteSender {
+			return UrlTransfer{}, projectError.Errorf(projectError.ECONFLICT, "account deletion is already pending")
+		}
+	}
+
+	urlIDs := []string{}
+	for id, url := range r.urls {
+		if url.IdUser == actor.IdUser && !url.deleted() {
+			urlIDs = append(urlIDs, id)
+		}
+	}
+	if len(urlIDs) == 0 {
+		return UrlTransfer{}, projectError.Errorf(projectError.EINVALID, "no urls to transfer")
+	}
+	slices.Sort(urlIDs)
+
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	transfer := UrlTransfer{
+		ID:           uniqueID.String(),
+		IdUserFrom:   actor.IdUser,
+		IdUserTo:     idUserTo,
+		Status:       TransferPending,
+		DeleteSender: true,
+		UrlIDs:       urlIDs,
+		CreatedAt:    time.Now(),
+	}
+	r.transfers[transfer.ID] = &transfer
+
+	return copyTransfer(&transfer), nil
+}
+
+func (r *MemoryRepository) GetUserTransfers(ctx context.Context, idUser string) ([]UrlTransfer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transfers := []UrlTransfer{}
+	for _, transfer := range r.transfers {
+		if (transfer.IdUserFrom == idUser || transfer.IdUserTo == idUser) && transfer.Status == TransferPending {
+			transfers = append(transfers, copyTransfer(transfer))
+		}
+	}
+
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].CreatedAt.After(transfers[j].CreatedAt)
+	})
+
+	return transfers, nil
+}
+
+func (r *MemoryRepository) GetExpiredDeletionTransfers(ctx context.Context, before time.Time) ([]UrlTransfer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transfers := []UrlTransfer{}
+	for _, transfer := range r.transfers {
+		if transfer.Status == TransferPending && transfer.DeleteSender && transfer.CreatedAt.Before(before) {
+			transfers = append(transfers, copyTransfer(transfer))
+		}
+	}
+
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].CreatedAt.Before(transfers[j].CreatedAt)
+	})
+
+	return transfers, nil
+}
+
+func (r *MemoryRepository) AcceptTransfer(ctx context.Context, id string, actor Actor) (UrlTransfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	transfer, ok := r.transfers[id]
+	if !ok || transfer.IdUserTo != actor.IdUser {
+		return UrlTransfer{}, projectError.Errorf(projectError.ENOTFOUND, "transfer not found")
+	} else if transfer.Status != TransferPending {
+		return UrlTransfer{}, projectError.Errorf(projectError.ECONFLICT, "transfer is %s", transfer.Status)
+	}
+
+	// Check every link before moving any, as the SQL transaction would.
+	for _, idUrl := range transfer.UrlIDs {
+		url, err := r.getOwnedUrl(idUrl, transfer.IdUserFrom)
+		if projectError.ErrorCode(err) == projectError.ENOTFOUND || (err == nil && url.deleted()) {
+			return UrlTransfer{}, projectError.Errorf(projectError.ECONFLICT, "url %s is no longer available for transfer", idUrl)
+		}
+
+		if r.liveDuplicate(idUrl, transfer.IdUserTo, url.UrlCanonicalHash) != nil {
+			return UrlTransfer{}, projectError.Errorf(projectError.ECONFLICT, "you already have a short url for %s", url.Url.UrlOriginal)
+		}
+	}
+
+	for _, idUrl := range transfer.UrlIDs {
+		r.urls[idUrl].IdUser = transfer.IdUserTo
+		r.appendHistory(idUrl, HistoryTransfer, &transfer.IdUserFrom, &transfer.IdUserTo, actor)
+	}
+
+	transfer.Status = TransferAccepted
+	return copyTransfer(transfer), nil
+}
+
+func (r *MemoryRepository) CloseTransfer(ctx context.Context, id string, status string, actor Actor) (UrlTransfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	transfer, ok := r.transfers[id]
+	if !ok ||
+		(status == TransferDeclined && transfer.IdUserTo != actor.IdUser) ||
+		(status == TransferCancelled && transfer.IdUserFrom != actor.IdUser) {
+		return UrlTransfer{}, projectError.Errorf(projectError.ENOTFOUND, "transfer not found")
+	} else if transfer.Status != TransferPending {
+		return UrlTransfer{}, projectError.Errorf(projectError.ECONFLICT, "transfer is %s", transfer.Status)
+	}
+
+	transfer.Status = status
+	return copyTransfer(transfer), nil
+}
+
+func (r *MemoryRepository) ExpireTransfer(ctx context.Context, id string) (UrlTransfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	transfer, ok := r.transfers[id]
+	if !ok {
+		return UrlTransfer{}, projectError.Errorf(projectError.ENOTFOUND, "transfer not found")
+	} else if transfer.Status != TransferPending {
+		return UrlTransfer{}, projectError.Errorf(projectError.ECONFLICT, "transfer is %s", transfer.Status)
+	}
+
+	transfer.Status = TransferExpired
+	return copyTransfer(transfer), nil
+}
+
+func (r *MemoryRepository) PurgeUserUrls(ctx context.Context, idUser string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, transfer := range r.transfers {
+		if transfer.IdUserFrom == idUser || transfer.IdUserTo == idUser {
+			delete(r.transfers, id)
+		}
+	}
+
+	slugs := []string{}
+	for id, url := range r.urls {
+		if url.IdUser != idUser {
+			continue
+		}
+
+		slugs = append(slugs, url.Url.Slug)
+		delete(r.urls, id)
+		delete(r.slugs, url.Url.Slug)
+		delete(r.history, id)
+
+		for _, transfer := range r.transfers {
+			transfer.UrlIDs = slices.DeleteFunc(transfer.UrlIDs, func(idUrl string) bool {
+				return idUrl == id
+			})
+		}
+	}
+
+	for _, history := range r.history {
+		for i := range history {
+			item := &history[i]
+			if item.IdUser == idUser {
+				item.IdUser = DeletedUser
+				item.ClientIP = ""
+			}
+			if item.Action == HistoryTransfer {
+				for _, value := range []*string{item.OldValue, item.NewValue} {
+					if value != nil && *value == idUser {
+						*value = DeletedUser
+					}
+				}
+			}
+		}
+	}
+
+	return slugs, nil
+}
+
+func (r *MemoryRepository) AddClicks(ctx context.Context, batch string, clicks map[string]map[string]int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.flushes[batch]; ok {
+		return nil
+	}
+
+	now := time.Now()
+	r.flushes[batch] = now
+	for id, flushed := range r.flushes {
+		if flushed.Before(now.Add(-clickFlushRetention)) {
+			delete(r.flushes, id)
+		}
+	}
+
+	for day, counts := range clicks {
+		for slug, count := range counts {
+			if url, ok := r.urls[r.slugs[slug]]; ok {
+				url.DailyClicks[day] += count
+				url.Clicks += count
+			}
+		}
+	}
+
+	return nil
+}
+
+// MaintainClicks expires daily click counts past CLICKS_RETENTION_MONTHS.
+// Plans live in the user repository, so every link gets that retention here.
+func (r *MemoryRepository) MaintainClicks(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff, ok := clickCutoff(time.Now(), r.config.CLICKS.RetentionMonths)
+	if !ok {
+		return nil
+	}
+
+	for _, url := range r.urls {
+		for day := range url.DailyClicks {
+			if day < cutoff.Format(time.DateOnly) {
+				delete(url.DailyClicks, day)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) GetUrlClicks(ctx context.Context, id string, idUser string) ([]UrlDailyClicks, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	url, err := r.getOwnedUrl(id, idUser)
+	if err != nil {
+		return []UrlDailyClicks{}, err
+	}
+
+	clicks := []UrlDailyClicks{}
+	for day, count := range url.DailyClicks {
+		clicks = append(clicks, UrlDailyClicks{Day: day, Clicks: count})
+	}
+
+	slices.SortFunc(clicks, func(a, b UrlDailyClicks) int {
+		return strings.Compare(a.Day, b.Day)
+	})
+
+	return clicks, nil
+}
+
+func (r *MemoryRepository) getOwnedUrl(id string, idUser string) (*memoryUrl, error) {
+	url, ok := r.urls[id]
+	if !ok || url.IdUser != idUser {
+		return nil, projectError.Errorf(projectError.ENOTFOUND, "url not found")
+	}
+	return url, nil
+}
+
+// liveDuplicate returns the live link of idUser, other than id, with the same
+// canonical URL hash, or nil.
+func (r *MemoryRepository) liveDuplicate(id string, idUser string, urlCanonicalHash string) *memoryUrl {
+	for _, url := range r.urls {
+		if url.Url.ID != id && url.IdUser == idUser && url.UrlCanonicalHash == urlCanonicalHash && !url.deleted() {
+			return url
+		}
+	}
+	return nil
+}
+
+// appendHistory keeps copies of the values it is given: idUrl often comes
+// from a route parameter, whose memory Fiber reuses for the next request.
+func (r *MemoryRepository) appendHistory(idUrl string, action string, oldValue *string, newValue *string, actor Actor) {
+	r.history[idUrl] = append(r.history[idUrl], UrlHistoryItem{
+		ID:        uuid.Must(uuid.NewV7()).String(),
+		IdUrl:     strings.Clone(idUrl),
+		IdUser:    actor.IdUser,
+		Action:    action,
+		OldValue:  copyString(oldValue),
+		NewValue:  copyString(newValue),
+		ClientIP:  actor.ClientIP,
+		CreatedAt: time.Now(),
+	})
+}
+
+func copyString(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+func copyTransfer(transfer *UrlTransfer) UrlTransfer {
+	copied := *transfer
+	copied.UrlIDs = slices.Clone(transfer.UrlIDs)
+	return copied
+}
+
+// status returns the status of the link at now, as filtered by UrlFilter.
+func (u *memoryUrl) status(now time.Time) string {
+	switch {
+	case u.deleted():
+		return StatusDeleted
+	case u.Url.TakenDownAt != nil:
+		return StatusTakenDown
+	case u.Url.ExpiresAt != nil && !u.Url.ExpiresAt.After(now):
+		return StatusExpired
+	}
+	return StatusLive
+}
+
+func (r *MemoryRepository) ListUrls(ctx context.Context, filter UrlFilter, limit int, offset int) ([]AdminUrlItem, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	search := strings.ToLower(filter.Search)
+
+	var matching []*memoryUrl
+	for _, url := range r.urls {
+		if !strings.Contains(strings.ToLower(url.Url.UrlOriginal), search) && !strings.Contains(strings.ToLower(url.Url.Slug), search) {
+			continue
+		}
+		if filter.IdUser != "" && url.IdUser != filter.IdUser {
+			continue
+		}
+		if filter.Status != "" && url.status(now) != filter.Status {
+			continue
+		}
+		matching = append(matching, url)
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].CreatedAt.After(matching[j].CreatedAt)
+	})
+
+	start := min(offset, len(matching))
+	end := min(start+limit, len(matching))
+
+	urls := []AdminUrlItem{}
+	for _, url := range matching[start:end] {
+		item := AdminUrlItem{
+			ID:           url.Url.ID,
+			IdUser:       url.IdUser,
+			UrlOriginal:  url.Url.UrlOriginal,
+			UrlShortened: url.Url.UrlShortened,
+			Slug:         url.Url.Slug,
+			Clicks:       url.Clicks,
+			CreatedAt:    url.CreatedAt,
+			ExpiresAt:    url.Url.ExpiresAt,
+			TakenDownAt:  url.Url.TakenDownAt,
+		}
+		if url.deleted() {
+			item.DeletedAt = &url.DeletedAt
+		}
+		if url.Url.TakenDownAt != nil {
+			item.TakedownReason = copyString(&url.Url.TakedownReason)
+		}
+		urls = append(urls, item)
+	}
+
+	return urls, int64(len(matching)), nil
+}
+
+// moderateUrl returns the live link id, which must be locked.
+func (r *MemoryRepository) moderateUrl(id string) (*memoryUrl, error) {
+	url, ok := r.urls[id]
+	if !ok || url.deleted() {
+		return nil, projectError.Errorf(projectError.ENOTFOUND, "url not found")
+	}
+	return url, nil
+}
+
+func (r *MemoryRepository) ExpireUrl(ctx context.Context, id string, at time.Time, actor Actor) (UrlOriginal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, err := r.moderateUrl(id)
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+
+	var oldValue *string
+	if url.Url.ExpiresAt != nil {
+		formatted := url.Url.ExpiresAt.UTC().Format(time.RFC3339)
+		oldValue = &formatted
+	}
+
+	url.Url.ExpiresAt = &at
+	expiresAt := at.UTC().Format(time.RFC3339)
+	r.appendHistory(id, HistoryExpire, oldValue, &expiresAt, actor)
+
+	return url.Url, nil
+}
+
+func (r *MemoryRepository) TakeDownUrl(ctx context.Context, id string, reason string, actor Actor) (UrlOriginal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, err := r.moderateUrl(id)
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+
+	if url.Url.TakenDownAt == nil {
+		now := time.Now()
+		url.Url.TakenDownAt = &now
+	}
+	url.Url.TakedownReason = reason
+	r.appendHistory(id, HistoryTakedown, nil, &reason, actor)
+
+	return url.Url, nil
+}
+
+func (r *MemoryRepository) ReinstateUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, err := r.moderateUrl(id)
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+
+	url.Url.TakenDownAt = nil
+	url.Url.TakedownReason = ""
+	url.Url.ExpiresAt = nil
+	r.appendHistory(id, HistoryReinstate, nil, nil, actor)
+
+	return url.Url, nil
+}
+
+func (r *MemoryRepository) GetUrlStats(ctx context.Context) (UrlStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+
+	var stats UrlStats
+	for _, url := range r.urls {
+		stats.Total++
+		stats.Clicks += url.Clicks
+
+		switch url.status(now) {
+		case StatusLive:
+			stats.Live++
+		case StatusDeleted:
+			stats.Deleted++
+		case StatusExpired:
+			stats.Expired++
+		case StatusTakenDown:
+			stats.TakenDown++
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,56 @@
+package urlShortening_repo
+
+import (
+	"context"
+	"time"
+)
+
+// Repository stores links with their history, transfers and click counts.
+// UrlShorteningRepository implements it on a SQL database (Postgres or
+// SQLite) and MemoryRepository in process memory.
+type Repository interface {
+	RegisterUrl(ctx context.Context, url *string, urlCanonical string, actor Actor) (UrlOriginal, error)
+	GetUrl(ctx context.Context, urlShortened string) (UrlOriginal, error)
+	GetUserUrls(ctx context.Context, idUser string, deleted bool) ([]UrlListItem, error)
+	// ForEachSlug calls fn with the slugs of the live urls created, changed or
+	// restored since, or of every live url when since is zero. It may call fn
+	// with more slugs than that, never fewer.
+	ForEachSlug(ctx context.Context, since time.Time, fn func(slug string)) error
+
+	UpdateUrl(ctx context.Context, id string, url string, urlCanonical string, action string, actor Actor) (UrlOriginal, error)
+	DeleteUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error)
+	RestoreUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error)
+
+	GetUrlHistory(ctx context.Context, id string, idUser string) ([]UrlHistoryItem, error)
+	GetUrlHistoryEntry(ctx context.Context, id string, idHistory string, idUser string) (UrlHistoryItem, error)
+
+	CreateTransfer(ctx context.Context, ids []string, idUserTo string, actor Actor) (UrlTransfer, error)
+	// CreateDeletionTransfer returns an ECONFLICT error when actor already has
+	// a deletion transfer pending and an EINVALID error when actor has no
+	// live link.
+	CreateDeletionTransfer(ctx context.Context, idUserTo string, actor Actor) (UrlTransfer, error)
+	GetUserTransfers(ctx context.Context, idUser string) ([]UrlTransfer, error)
+	GetExpiredDeletionTransfers(ctx context.Context, before time.Time) ([]UrlTransfer, error)
+	AcceptTransfer(ctx context.Context, id string, actor Actor) (UrlTransfer, error)
+	CloseTransfer(ctx context.Context, id string, status string, actor Actor) (UrlTransfer, error)
+	ExpireTransfer(ctx context.Context, id string) (UrlTransfer, error)
+
+	PurgeUserUrls(ctx context.Context, idUser string) ([]string, error)
+
+	ListUrls(ctx context.Context, filter UrlFilter, limit int, offset int) ([]AdminUrlItem, int64, error)
+	// ExpireUrl, TakeDownUrl and ReinstateUrl return an ENOTFOUND error when
+	// the link does not exist or is deleted.
+	ExpireUrl(ctx context.Context, id string, at time.Time, actor Actor) (UrlOriginal, error)
+	TakeDownUrl(ctx context.Context, id string, reason string, actor Actor) (UrlOriginal, error)
+	ReinstateUrl(ctx context.Context, id string, actor Actor) (UrlOriginal, error)
+	GetUrlStats(ctx context.Context) (UrlStats, error)
+
+	AddClicks(ctx context.Context, batch string, clicks map[string]map[string]int64) error
+	GetUrlClicks(ctx context.Context, id string, idUser string) ([]UrlDailyClicks, error)
+	MaintainClicks(ctx context.Context) error
+}
+
+var (
+	_ Repository = (*UrlShorteningRepository)(nil)
+	_ Repository = (*MemoryRepository)(nil)
+)
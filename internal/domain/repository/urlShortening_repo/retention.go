@@ -0,0 +1,217 @@
+package urlShortening_repo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// clickPartitionPrefix names the monthly partitions of url_clicks_daily on
+// Postgres, followed by the month as YYYYMM.
+const clickPartitionPrefix = "url_clicks_daily_"
+
+const clickPartitionLayout = "200601"
+
+// clickDefaultPartition holds the clicks of months that have no partition.
+const clickDefaultPartition = "url_clicks_daily_default"
+
+// clickMaintenanceLockKey is the Postgres advisory lock held while partitions
+// are created and dropped, so instances running the job together do not race.
+const clickMaintenanceLockKey int64 = 0x75726c5f636c6b
+
+// clickCutoff returns the first day kept when months of click counts are
+// retained: the current month and the months before it. Zero keeps them all.
+func clickCutoff(now time.Time, months int) (time.Time, bool) {
+	if months <= 0 {
+		return time.Time{}, false
+	}
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month()-time.Month(months), 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// MaintainClicks creates the click partitions of the coming months and
+// expires the daily click counts older than the retention of the plan of each
+// link's owner. On Postgres, months past every retention are dropped, or
+// archived, as whole partitions. Like AddClicks it is a bulk operation, so
+// only ctx bounds it.
+func (r *UrlShorteningRepository) MaintainClicks(ctx context.Context) error {
+	db := r.db.Db.WithContext(ctx)
+
+	now := time.Now()
+
+	if db.Dialector.Name() == "postgres" {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`SELECT pg_advisory_xact_lock(?)`, clickMaintenanceLockKey).Error; err != nil {
+				return err
+			}
+			return r.maintainClickPartitions(tx, now)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.expireClicks(db, now)
+}
+
+func (r *UrlShorteningRepository) maintainClickPartitions(tx *gorm.DB, now time.Time) error {
+	var names []string
+	query := `SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = 'url_clicks_daily'::regclass`
+	if err := tx.Raw(query).Scan(&names).Error; err != nil {
+		return err
+	}
+
+	partitions := map[string]time.Time{}
+	hasDefault := false
+	for _, name := range names {
+		if name == clickDefaultPartition {
+			hasDefault = true
+			continue
+		}
+
+		month, err := time.Parse(clickPartitionLayout, strings.TrimPrefix(name, clickPartitionPrefix))
+		if err == nil && name == clickPartitionPrefix+month.Format(clickPartitionLayout) {
+			partitions[name] = month
+		}
+	}
+
+	current := time.Date(now.UTC().Year(), now.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i <= r.config.CLICKS.PartitionsAhead; i++ {
+		from := current.AddDate(0, i, 0)
+		name := clickPartitionPrefix + from.Format(clickPartitionLayout)
+		if _, ok := partitions[name]; ok {
+			continue
+		}
+
+		if err := createClickPartition(tx, name, from, hasDefault); err != nil {
+			return err
+		}
+	}
+
+	cutoff, ok := clickCutoff(now, r.keptClickMonths())
+	if !ok {
+		return nil
+	}
+
+	for name, month := range partitions {
+		if !month.Before(cutoff) {
+			continue
+		}
+
+		if r.config.CLICKS.RetentionArchive {
+			if err := tx.Exec(fmt.Sprintf(`ALTER TABLE url_clicks_daily DETACH PARTITION %s`, name)).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s SET SCHEMA click_archive`, name)).Error; err != nil {
+				return err
+			}
+			log.Printf("click partition %s archived to click_archive.%s", name, name)
+		} else {
+			if err := tx.Exec(fmt.Sprintf(`DROP TABLE %s`, name)).Error; err != nil {
+				return err
+			}
+			log.Printf("click partition %s dropped", name)
+		}
+	}
+
+	return nil
+}
+
+// createClickPartition creates the partition of the month starting at from.
+// Clicks of that month already in the default partition, flushed while the
+// job was not running, would make creating it fail, so they are moved into
+// the new table before it is attached.
+func createClickPartition(tx *gorm.DB, name string, from time.Time, hasDefault bool) error {
+	to := from.AddDate(0, 1, 0)
+
+	var stray int64
+	if hasDefault {
+		query := `SELECT COUNT(*) FROM ` + clickDefaultPartition + ` WHERE day >= ? AND day < ?`
+		if err := tx.Raw(query, from.Format(time.DateOnly), to.Format(time.DateOnly)).Row().Scan(&stray); err != nil {
+			return err
+		}
+	}
+
+	// DDL takes no bind parameters; every value here is generated by the caller.
+	bounds := fmt.Sprintf(`FOR VALUES FROM ('%s') TO ('%s')`, from.Format(time.DateOnly), to.Format(time.DateOnly))
+
+	if stray == 0 {
+		return tx.Exec(fmt.Sprintf(`CREATE TABLE %s PARTITION OF url_clicks_daily %s`, name, bounds)).Error
+	}
+
+	if err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s (LIKE url_clicks_daily INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`, name)).Error; err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (id_url, day, clicks) SELECT id_url, day, clicks FROM %s WHERE day >= ? AND day < ?`, name, clickDefaultPartition)
+	if err := tx.Exec(query, from.Format(time.DateOnly), to.Format(time.DateOnly)).Error; err != nil {
+		return err
+	}
+
+	query = `DELETE FROM ` + clickDefaultPartition + ` WHERE day >= ? AND day < ?`
+	if err := tx.Exec(query, from.Format(time.DateOnly), to.Format(time.DateOnly)).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Exec(fmt.Sprintf(`ALTER TABLE url_clicks_daily ATTACH PARTITION %s %s`, name, bounds)).Error; err != nil {
+		return err
+	}
+
+	log.Printf("click partition %s created late: moved %d rows from %s, check that click maintenance runs", name, stray, clickDefaultPartition)
+
+	return nil
+}
+
+// keptClickMonths is the longest retention of any plan, past which whole
+// partitions can go. Zero when some plan keeps its clicks forever.
+func (r *UrlShorteningRepository) keptClickMonths() int {
+	months := r.config.CLICKS.RetentionMonths
+	if months <= 0 {
+		return 0
+	}
+
+	for _, planMonths := range r.config.CLICKS.RetentionPlans {
+		if planMonths <= 0 {
+			return 0
+		}
+		months = max(months, planMonths)
+	}
+
+	return months
+}
+
+// expireClicks deletes the daily counts past the retention of the owner's
+// plan. Plans not in CLICKS_RETENTION_PLANS get CLICKS_RETENTION_MONTHS.
+func (r *UrlShorteningRepository) expireClicks(db *gorm.DB, now time.Time) error {
+	plans := make([]string, 0, len(r.config.CLICKS.RetentionPlans))
+
+	for plan, months := range r.config.CLICKS.RetentionPlans {
+		plans = append(plans, plan)
+
+		if cutoff, ok := clickCutoff(now, months); ok {
+			query := `DELETE FROM url_clicks_daily WHERE day < ? AND id_url IN
+				(SELECT u.id FROM url_shortening u JOIN users p ON p.id = u.id_user WHERE p.plan = ?)`
+			if err := db.Exec(query, cutoff.Format(time.DateOnly), plan).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	cutoff, ok := clickCutoff(now, r.config.CLICKS.RetentionMonths)
+	if !ok {
+		return nil
+	}
+
+	if len(plans) == 0 {
+		return db.Exec(`DELETE FROM url_clicks_daily WHERE day < ?`, cutoff.Format(time.DateOnly)).Error
+	}
+
+	query := `DELETE FROM url_clicks_daily WHERE day < ? AND id_url IN
+		(SELECT u.id FROM url_shortening u JOIN users p ON p.id = u.id_user WHERE p.plan NOT IN ?)`
+	return db.Exec(query, cutoff.Format(time.DateOnly), plans).Error
+}
@@ -0,0 +1,350 @@
+package urlShortening_repo
+
+import (
+	"context"
+	"time"
+	"url_shortening/pkg/projectError"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+	TransferExpired   = "expired"
+)
+
+type UrlTransfer struct {
+	ID         string `json:"id"`
+	IdUserFrom string `json:"id_user_from"`
+	IdUserTo   string `json:"id_user_to"`
+	Status     string `json:"status"`
+	// DeleteSender is set on the transfer made to delete the account of its
+	// sender, which is deleted once the transfer is accepted, declined or
+	// expired.
+	DeleteSender bool      `json:"delete_sender"`
+	UrlIDs       []string  `json:"url_ids"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CreateTransfer offers the given links of actor to idUserTo. Ownership only
+// changes once the recipient accepts.
+func (r *UrlShorteningRepository) CreateTransfer(ctx context.Context, ids []string, idUserTo string, actor Actor) (UrlTransfer, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	if idUserTo == actor.IdUser {
+		return UrlTransfer{}, projectError.Errorf(projectError.EINVALID, "cannot transfer urls to yourself")
+	}
+
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	transfer := UrlTransfer{
+		ID:         uniqueID.String(),
+		IdUserFrom: actor.IdUser,
+		IdUserTo:   idUserTo,
+		Status:     TransferPending,
+		UrlIDs:     ids,
+		CreatedAt:  time.Now(),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return r.insertTransfer(tx, transfer)
+	})
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	return transfer, nil
+}
+
+// CreateDeletionTransfer offers every live link of actor to idUserTo, as the
+// account of actor is being deleted. An actor has one such transfer pending
+// at most, and none without live links.
+func (r *UrlShorteningRepository) CreateDeletionTransfer(ctx context.Context, idUserTo string, actor Actor) (UrlTransfer, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	if idUserTo == actor.IdUser {
+		return UrlTransfer{}, projectError.Errorf(projectError.EINVALID, "cannot transfer urls to yourself")
+	}
+
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	transfer := UrlTransfer{
+		ID:           uniqueID.String(),
+		IdUserFrom:   actor.IdUser,
+		IdUserTo:     idUserTo,
+		Status:       TransferPending,
+		DeleteSender: true,
+		CreatedAt:    time.Now(),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var pending int64
+		query := `SELECT COUNT(*) FROM url_transfers WHERE id_user_from = ? AND status = ? AND delete_sender`
+		if err := tx.Raw(query, actor.IdUser, TransferPending).Scan(&pending).Error; err != nil {
+			return err
+		} else if pending > 0 {
+			return projectError.Errorf(projectError.ECONFLICT, "account deletion is already pending")
+		}
+
+		query = `SELECT id FROM url_shortening WHERE id_user = ? AND deleted_at IS NULL ORDER BY id`
+		if err := tx.Raw(query, actor.IdUser).Scan(&transfer.UrlIDs).Error; err != nil {
+			return err
+		} else if len(transfer.UrlIDs) == 0 {
+			return projectError.Errorf(projectError.EINVALID, "no urls to transfer")
+		}
+
+		return r.insertTransfer(tx, transfer)
+	})
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	return transfer, nil
+}
+
+// insertTransfer stores transfer with its links, which must be live links of
+// its sender.
+func (r *UrlShorteningRepository) insertTransfer(tx *gorm.DB, transfer UrlTransfer) error {
+	query := `INSERT INTO url_transfers (id, id_user_from, id_user_to, status, delete_sender, created_at, updated_at) VALUES (?,?,?,?,?,?,?)`
+	if err := tx.Exec(query, transfer.ID, transfer.IdUserFrom, transfer.IdUserTo, transfer.Status, transfer.DeleteSender, transfer.CreatedAt, transfer.CreatedAt).Error; err != nil {
+		return err
+	}
+
+	for _, id := range transfer.UrlIDs {
+		url, err := r.getOwnedUrl(tx, id, transfer.IdUserFrom)
+		if err != nil {
+			return err
+		} else if url.DeletedAt.Valid {
+			return projectError.Errorf(projectError.ENOTFOUND, "url not found")
+		}
+
+		query := `INSERT INTO url_transfer_items (id_transfer, id_url) VALUES (?,?) ON CONFLICT DO NOTHING`
+		if err := tx.Exec(query, transfer.ID, id).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *UrlShorteningRepository) getTransfer(db *gorm.DB, id string) (UrlTransfer, error) {
+
+	query := `SELECT id, id_user_from, id_user_to, status, delete_sender, created_at FROM url_transfers WHERE id = ?`
+	rows, err := db.Raw(query, id).Rows()
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return UrlTransfer{}, projectError.Errorf(projectError.ENOTFOUND, "transfer not found")
+	}
+
+	var transfer UrlTransfer
+	if err := rows.Scan(&transfer.ID, &transfer.IdUserFrom, &transfer.IdUserTo, &transfer.Status, &transfer.DeleteSender, &transfer.CreatedAt); err != nil {
+		return UrlTransfer{}, err
+	}
+
+	transfer.UrlIDs, err = getTransferUrlIDs(db, transfer.ID)
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	return transfer, nil
+}
+
+// setTransferStatus ends the pending transfer id with status. The status read
+// earlier is not locked, so the update only applies if the transfer is still
+// pending: of a concurrent accept and cancel, exactly one succeeds.
+func setTransferStatus(tx *gorm.DB, id string, status string) error {
+	query := `UPDATE url_transfers SET status = ?, updated_at = ? WHERE id = ? AND status = ?`
+	result := tx.Exec(query, status, time.Now(), id, TransferPending)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ECONFLICT, "transfer is no longer pending")
+	}
+	return nil
+}
+
+func getTransferUrlIDs(db *gorm.DB, idTransfer string) ([]string, error) {
+	ids := []string{}
+	if err := db.Raw(`SELECT id_url FROM url_transfer_items WHERE id_transfer = ? ORDER BY id_url`, idTransfer).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetUserTransfers returns the pending transfers sent or received by idUser.
+func (r *UrlShorteningRepository) GetUserTransfers(ctx context.Context, idUser string) ([]UrlTransfer, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `SELECT id, id_user_from, id_user_to, status, delete_sender, created_at FROM url_transfers WHERE (id_user_from = ? OR id_user_to = ?) AND status = ? ORDER BY created_at DESC`
+	return getTransfers(db, query, idUser, idUser, TransferPending)
+}
+
+// GetExpiredDeletionTransfers returns the deletion transfers still pending
+// that were created before.
+func (r *UrlShorteningRepository) GetExpiredDeletionTransfers(ctx context.Context, before time.Time) ([]UrlTransfer, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `SELECT id, id_user_from, id_user_to, status, delete_sender, created_at FROM url_transfers WHERE status = ? AND created_at < ? AND delete_sender ORDER BY created_at`
+	return getTransfers(db, query, TransferPending, before)
+}
+
+func getTransfers(db *gorm.DB, query string, args ...any) ([]UrlTransfer, error) {
+	rows, err := db.Raw(query, args...).Rows()
+	if err != nil {
+		return []UrlTransfer{}, err
+	}
+	defer rows.Close()
+
+	transfers := []UrlTransfer{}
+	for rows.Next() {
+		var transfer UrlTransfer
+		if err := rows.Scan(&transfer.ID, &transfer.IdUserFrom, &transfer.IdUserTo, &transfer.Status, &transfer.DeleteSender, &transfer.CreatedAt); err != nil {
+			return []UrlTransfer{}, err
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	for i := range transfers {
+		transfers[i].UrlIDs, err = getTransferUrlIDs(db, transfers[i].ID)
+		if err != nil {
+			return []UrlTransfer{}, err
+		}
+	}
+
+	return transfers, nil
+}
+
+// AcceptTransfer moves every link of a pending transfer to the recipient. The
+// link ids, slugs and history stay the same; only id_user changes.
+func (r *UrlShorteningRepository) AcceptTransfer(ctx context.Context, id string, actor Actor) (UrlTransfer, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var transfer UrlTransfer
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		transfer, err = r.getTransfer(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if transfer.IdUserTo != actor.IdUser {
+			return projectError.Errorf(projectError.ENOTFOUND, "transfer not found")
+		} else if transfer.Status != TransferPending {
+			return projectError.Errorf(projectError.ECONFLICT, "transfer is %s", transfer.Status)
+		}
+
+		for _, idUrl := range transfer.UrlIDs {
+			url, err := r.lockOwnedUrl(tx, idUrl, transfer.IdUserFrom)
+			if projectError.ErrorCode(err) == projectError.ENOTFOUND || (err == nil && url.DeletedAt.Valid) {
+				return projectError.Errorf(projectError.ECONFLICT, "url %s is no longer available for transfer", idUrl)
+			} else if err != nil {
+				return err
+			}
+
+			duplicate, err := hasLiveDuplicate(tx, idUrl, transfer.IdUserTo, url.UrlCanonicalHash)
+			if err != nil {
+				return err
+			} else if duplicate {
+				return projectError.Errorf(projectError.ECONFLICT, "you already have a short url for %s", url.Url.UrlOriginal)
+			}
+
+			query := `UPDATE url_shortening SET id_user = ?, updated_at = ? WHERE id = ?`
+			if err := tx.Exec(query, transfer.IdUserTo, time.Now(), idUrl).Error; err != nil {
+				return err
+			}
+
+			if err := insertHistory(tx, idUrl, HistoryTransfer, &transfer.IdUserFrom, &transfer.IdUserTo, actor); err != nil {
+				return err
+			}
+		}
+
+		transfer.Status = TransferAccepted
+		return setTransferStatus(tx, id, transfer.Status)
+	})
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	r.db.Written(userKey(transfer.IdUserFrom), userKey(transfer.IdUserTo))
+
+	return transfer, nil
+}
+
+// CloseTransfer ends a pending transfer without moving any link: the recipient
+// may decline it and the sender may cancel it.
+func (r *UrlShorteningRepository) CloseTransfer(ctx context.Context, id string, status string, actor Actor) (UrlTransfer, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var transfer UrlTransfer
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		transfer, err = r.getTransfer(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if (status == TransferDeclined && transfer.IdUserTo != actor.IdUser) ||
+			(status == TransferCancelled && transfer.IdUserFrom != actor.IdUser) {
+			return projectError.Errorf(projectError.ENOTFOUND, "transfer not found")
+		} else if transfer.Status != TransferPending {
+			return projectError.Errorf(projectError.ECONFLICT, "transfer is %s", transfer.Status)
+		}
+
+		transfer.Status = status
+		return setTransferStatus(tx, id, transfer.Status)
+	})
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	return transfer, nil
+}
+
+// ExpireTransfer ends the pending transfer id as expired, without moving any
+// link.
+func (r *UrlShorteningRepository) ExpireTransfer(ctx context.Context, id string) (UrlTransfer, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var transfer UrlTransfer
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		transfer, err = r.getTransfer(tx, id)
+		if err != nil {
+			return err
+		} else if transfer.Status != TransferPending {
+			return projectError.Errorf(projectError.ECONFLICT, "transfer is %s", transfer.Status)
+		}
+
+		transfer.Status = TransferExpired
+		return setTransferStatus(tx, id, transfer.Status)
+	})
+	if err != nil {
+		return UrlTransfer{}, err
+	}
+
+	return transfer, nil
+}
@@ -1,16 +1,42 @@
 package urlShortening_repo
 
 import (
+	"context"
+	"database/sql"
+	"time"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
+	"url_shortening/infra/db/sqldb"
+	"url_shortening/pkg/projectError"
+	"url_shortening/pkg/urlPkg"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type UrlOriginal struct {
+	ID           string `gorm:"column:id"`
 	UrlOriginal  string `gorm:"column:url_original"`
 	UrlShortened string `gorm:"column:url_shortened"`
 	Slug         string `gorm:"column:slug"`
+	// ExpiresAt and TakenDownAt are only read by GetUrl.
+	ExpiresAt      *time.Time `gorm:"column:expires_at"`
+	TakenDownAt    *time.Time `gorm:"column:taken_down_at"`
+	TakedownReason string     `gorm:"column:takedown_reason"`
+}
+
+// Gone returns why the link no longer redirects at now, if it was taken
+// down or has expired.
+func (u UrlOriginal) Gone(now time.Time) (string, bool) {
+	if u.TakenDownAt != nil {
+		if u.TakedownReason == "" {
+			return "This link was taken down", true
+		}
+		return "This link was taken down: " + u.TakedownReason, true
+	}
+	if u.ExpiresAt != nil && !u.ExpiresAt.After(now) {
+		return "This link has expired", true
+	}
+	return "", false
 }
 
 type UrlListItem struct {
@@ -19,63 +45,117 @@ type UrlListItem struct {
 	UrlShortened string `gorm:"column:url_shortened"`
 	Slug         string `gorm:"column:slug"`
 	CreatedAt    string `gorm:"column:created_at"`
+	Clicks       int64  `gorm:"column:clicks"`
 }
 
 type UrlShorteningRepository struct {
-	db     *postgres.Postgres
+	db     *sqldb.Database
 	config *environment.Config
 }
 
-func NewUrlShorteningRepository(db *postgres.Postgres, config *environment.Config) *UrlShorteningRepository {
+// userKey is the key under which changes to the links of idUser are recorded
+// with Written, next to the slugs of the changed links.
+func userKey(idUser string) string {
+	return "user:" + idUser
+}
+
+func NewUrlShorteningRepository(db *sqldb.Database, config *environment.Config) *UrlShorteningRepository {
 	return &UrlShorteningRepository{db: db, config: config}
 }
 
-func (r *UrlShorteningRepository) RegisterUrl(url *string, idUser string) (UrlOriginal, error) {
+func (r *UrlShorteningRepository) RegisterUrl(ctx context.Context, url *string, urlCanonical string, actor Actor) (UrlOriginal, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
 
 	uniqueID, err := uuid.NewV7()
 	if err != nil {
 		return UrlOriginal{}, err
 	}
 
-	urlShortened := r.config.URL_SHORTENED_PREFIX + "/" + uniqueID.String()[len(uniqueID.String())-8:]
+	slug := uniqueID.String()[len(uniqueID.String())-8:]
+	urlShortened := r.config.URL_SHORTENED_PREFIX + "/" + slug
 
-	query := `SELECT url_original, url_shortened, slug FROM url_shortening WHERE id_user = $1 AND url_original = $2`
-	response, err := r.db.Db.Raw(query, idUser, *url).Rows()
-	if err != nil {
-		return UrlOriginal{}, err
-	}
-	defer response.Close()
-
-	var urlOriginal UrlOriginal
+	var existing UrlOriginal
 
-	if response.Next() {
-		err = response.Scan(&urlOriginal.UrlOriginal, &urlOriginal.UrlShortened, &urlOriginal.Slug)
-		if err != nil {
-			return UrlOriginal{}, err
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// The insert does nothing when the user already has a live link to
+		// the same URL, even one inserted concurrently: the unique index is
+		// what detects duplicates, so two requests cannot both pass a check.
+		// updated_at is set here, like on every other write, so ForEachSlug
+		// compares it against the clock of the application, not the database.
+		query := `INSERT INTO url_shortening (id,id_user,url_original,url_canonical,url_canonical_hash,url_shortened, slug, updated_at) VALUES (?,?,?,?,?,?,?,?)
+			ON CONFLICT (id_user, url_canonical_hash) WHERE deleted_at IS NULL DO NOTHING`
+		result := tx.Exec(query, uniqueID, actor.IdUser, *url, urlCanonical, urlPkg.Hash(urlCanonical), urlShortened, slug, time.Now())
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			var err error
+			existing, err = getLiveDuplicate(tx, actor.IdUser, urlPkg.Hash(urlCanonical))
+			return err
 		}
 
-		return urlOriginal, nil
-	}
-
-	query = `INSERT INTO url_shortening (id,id_user,url_original,url_shortened, slug) VALUES ($1,$2,$3,$4,$5)`
-	response, err = r.db.Db.Raw(query, uniqueID, idUser, url, urlShortened, uniqueID.String()[len(uniqueID.String())-8:]).Rows()
+		return insertHistory(tx, uniqueID.String(), HistoryCreate, nil, url, actor)
+	})
 	if err != nil {
 		return UrlOriginal{}, err
+	} else if existing.ID != "" {
+		return existing, nil
 	}
 
-	defer response.Close()
+	r.db.Written(userKey(actor.IdUser))
 
 	return UrlOriginal{
+		ID:           uniqueID.String(),
 		UrlOriginal:  *url,
 		UrlShortened: urlShortened,
-		Slug:         uniqueID.String()[len(uniqueID.String())-8:],
+		Slug:         slug,
 	}, nil
 }
 
-func (r *UrlShorteningRepository) GetUrl(urlShortened string) (UrlOriginal, error) {
+// getLiveDuplicate returns the live link of idUser whose canonical URL has
+// the hash urlCanonicalHash.
+func getLiveDuplicate(db *gorm.DB, idUser string, urlCanonicalHash string) (UrlOriginal, error) {
+	query := `SELECT id, url_original, url_shortened, slug FROM url_shortening WHERE id_user = ? AND url_canonical_hash = ? AND deleted_at IS NULL`
+	rows, err := db.Raw(query, idUser, urlCanonicalHash).Rows()
+	if err != nil {
+		return UrlOriginal{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return UrlOriginal{}, projectError.Errorf(projectError.ENOTFOUND, "URL not found")
+	}
+
+	var url UrlOriginal
+	if err := rows.Scan(&url.ID, &url.UrlOriginal, &url.UrlShortened, &url.Slug); err != nil {
+		return UrlOriginal{}, err
+	}
+
+	return url, nil
+}
+
+// GetUrl reads from a replica when there is one. A slug missing there may be
+// a link created moments ago, so it is looked up again on the primary.
+func (r *UrlShorteningRepository) GetUrl(ctx context.Context, urlShortened string) (UrlOriginal, error) {
+	var urlOriginal UrlOriginal
 
-	query := `SELECT url_original, url_shortened, slug FROM url_shortening WHERE slug = $1 LIMIT 1`
-	response, err := r.db.Db.Raw(query, urlShortened).Rows()
+	err := r.db.Read(ctx, urlShortened, func(db *gorm.DB) (bool, error) {
+		var err error
+		urlOriginal, err = getUrl(db, urlShortened)
+		return urlOriginal.UrlOriginal == "", err
+	})
+	if err != nil {
+		return UrlOriginal{}, err
+	} else if urlOriginal.UrlOriginal == "" {
+		return UrlOriginal{}, projectError.Errorf(projectError.ENOTFOUND, "URL not found")
+	}
+
+	return urlOriginal, nil
+}
+
+func getUrl(db *gorm.DB, urlShortened string) (UrlOriginal, error) {
+	query := `SELECT url_original, url_shortened, slug, expires_at, taken_down_at, takedown_reason FROM url_shortening WHERE slug = ? AND deleted_at IS NULL LIMIT 1`
+	response, err := db.Raw(query, urlShortened).Rows()
 	if err != nil {
 		return UrlOriginal{}, err
 	}
@@ -83,10 +163,20 @@ func (r *UrlShorteningRepository) GetUrl(urlShortened string) (UrlOriginal, erro
 	var urlOriginal UrlOriginal
 
 	for response.Next() {
-		err = response.Scan(&urlOriginal.UrlOriginal, &urlOriginal.UrlShortened, &urlOriginal.Slug)
+		var expiresAt, takenDownAt sql.NullTime
+		var takedownReason sql.NullString
+		err = response.Scan(&urlOriginal.UrlOriginal, &urlOriginal.UrlShortened, &urlOriginal.Slug, &expiresAt, &takenDownAt, &takedownReason)
 		if err != nil {
 			return UrlOriginal{}, err
 		}
+
+		if expiresAt.Valid {
+			urlOriginal.ExpiresAt = &expiresAt.Time
+		}
+		if takenDownAt.Valid {
+			urlOriginal.TakenDownAt = &takenDownAt.Time
+		}
+		urlOriginal.TakedownReason = takedownReason.String
 	}
 
 	defer response.Close()
@@ -94,10 +184,29 @@ func (r *UrlShorteningRepository) GetUrl(urlShortened string) (UrlOriginal, erro
 	return urlOriginal, nil
 }
 
-func (r *UrlShorteningRepository) GetUserUrls(idUser string) ([]UrlListItem, error) {
-	query := `SELECT id, url_original, url_shortened, slug, created_at FROM url_shortening WHERE id_user = $1 ORDER BY created_at DESC`
+// GetUserUrls reads from a replica unless idUser changed a link recently.
+func (r *UrlShorteningRepository) GetUserUrls(ctx context.Context, idUser string, deleted bool) ([]UrlListItem, error) {
+	var urls []UrlListItem
+
+	err := r.db.Read(ctx, userKey(idUser), func(db *gorm.DB) (bool, error) {
+		var err error
+		urls, err = getUserUrls(db, idUser, deleted)
+		return false, err
+	})
+	if err != nil {
+		return []UrlListItem{}, err
+	}
+
+	return urls, nil
+}
+
+func getUserUrls(db *gorm.DB, idUser string, deleted bool) ([]UrlListItem, error) {
+	query := `SELECT id, url_original, url_shortened, slug, created_at, clicks FROM url_shortening WHERE id_user = ? AND deleted_at IS NULL ORDER BY created_at DESC`
+	if deleted {
+		query = `SELECT id, url_original, url_shortened, slug, created_at, clicks FROM url_shortening WHERE id_user = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	}
 
-	rows, err := r.db.Db.Raw(query, idUser).Rows()
+	rows, err := db.Raw(query, idUser).Rows()
 	if err != nil {
 		return []UrlListItem{}, err
 	}
@@ -106,7 +215,7 @@ func (r *UrlShorteningRepository) GetUserUrls(idUser string) ([]UrlListItem, err
 	var urls []UrlListItem
 	for rows.Next() {
 		var url UrlListItem
-		err = rows.Scan(&url.ID, &url.UrlOriginal, &url.UrlShortened, &url.Slug, &url.CreatedAt)
+		err = rows.Scan(&url.ID, &url.UrlOriginal, &url.UrlShortened, &url.Slug, &url.CreatedAt, &url.Clicks)
 		if err != nil {
 			return []UrlListItem{}, err
 		}
@@ -120,3 +229,31 @@ func (r *UrlShorteningRepository) GetUserUrls(idUser string) ([]UrlListItem, err
 
 	return urls, nil
 }
+
+// ForEachSlug calls fn with the slug of every live url, or only of those
+// whose updated_at is since or later. It is a bulk read, so only ctx bounds
+// it, not the per-query timeout.
+func (r *UrlShorteningRepository) ForEachSlug(ctx context.Context, since time.Time, fn func(slug string)) error {
+	db := r.db.Db.WithContext(ctx)
+
+	query := db.Raw(`SELECT slug FROM url_shortening WHERE deleted_at IS NULL`)
+	if !since.IsZero() {
+		query = db.Raw(`SELECT slug FROM url_shortening WHERE deleted_at IS NULL AND updated_at >= ?`, since)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return err
+		}
+		fn(slug)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,98 @@
+package user_repo
+
+import (
+	"context"
+	"time"
+	"url_shortening/infra/db/sqldb"
+	"url_shortening/pkg/projectError"
+)
+
+// UserStats counts the accounts for the admin dashboard.
+type UserStats struct {
+	Total      int64 `json:"total"`
+	Admins     int64 `json:"admins"`
+	Disabled   int64 `json:"disabled"`
+	Unverified int64 `json:"unverified"`
+}
+
+// ListUsers returns a page of the users whose name or email contains search,
+// newest first, with the number of users matching.
+func (r *UserRepository) ListUsers(ctx context.Context, search string, limit int, offset int) ([]User, int64, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	where := `LOWER(name) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\'`
+	pattern := sqldb.Contains(search)
+
+	var total int64
+	if err := db.Raw(`SELECT COUNT(*) FROM users WHERE `+where, pattern, pattern).Row().Scan(&total); err != nil {
+		return []User{}, 0, err
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + where + ` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`
+	rows, err := db.Raw(query, pattern, pattern, limit, offset).Rows()
+	if err != nil {
+		return []User{}, 0, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return []User{}, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// SetRole gives idUser role.
+func (r *UserRepository) SetRole(ctx context.Context, idUser string, role string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	result := db.Exec(`UPDATE users SET role = ?, updated_at = ? WHERE id = ?`, role, time.Now(), idUser)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	return nil
+}
+
+// SetDisabled disables idUser from disabledAt, or enables them again when it
+// is nil.
+func (r *UserRepository) SetDisabled(ctx context.Context, idUser string, disabledAt *time.Time) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	result := db.Exec(`UPDATE users SET disabled_at = ?, updated_at = ? WHERE id = ?`, disabledAt, time.Now(), idUser)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	return nil
+}
+
+func (r *UserRepository) GetUserStats(ctx context.Context) (UserStats, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var stats UserStats
+	query := `SELECT COUNT(*),
+		COALESCE(SUM(CASE WHEN role = ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN disabled_at IS NOT NULL THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN email_verified_at IS NULL THEN 1 ELSE 0 END), 0)
+		FROM users`
+	err := db.Raw(query, RoleAdmin).Row().Scan(&stats.Total, &stats.Admins, &stats.Disabled, &stats.Unverified)
+	if err != nil {
+		return UserStats{}, err
+	}
+
+	return stats, nil
+}
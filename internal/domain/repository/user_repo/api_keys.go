@@ -0,0 +1,154 @@
+package user_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"url_shortening/pkg/projectError"
+
+	"github.com/google/uuid"
+)
+
+// Scopes an API key can be granted. Login sessions have all of them.
+const (
+	ScopeLinksRead  = "links:read"
+	ScopeLinksWrite = "links:write"
+	ScopeStatsRead  = "stats:read"
+)
+
+// apiKeyTouchInterval limits how often last_used_at is written for a key in
+// steady use.
+const apiKeyTouchInterval = time.Minute
+
+// ApiKey is a key for programmatic access to the API on behalf of a user.
+// The key itself is only known when it is created; the repository keeps its
+// hash.
+type ApiKey struct {
+	ID         string     `json:"id"`
+	IdUser     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Expired reports whether the key can no longer be used at now.
+func (k ApiKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+const apiKeyColumns = `id, id_user, name, prefix, scopes, expires_at, last_used_at, created_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanApiKey(row scanner) (ApiKey, error) {
+	var key ApiKey
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.IdUser, &key.Name, &key.Prefix, &scopes, &expiresAt, &lastUsedAt, &key.CreatedAt)
+	if err != nil {
+		return ApiKey{}, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return key, nil
+}
+
+func (r *UserRepository) CreateApiKey(ctx context.Context, key *ApiKey, hash string) (ApiKey, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return ApiKey{}, err
+	}
+
+	created := *key
+	created.ID = uniqueID.String()
+	created.CreatedAt = time.Now()
+
+	query := `INSERT INTO api_keys (id, id_user, name, prefix, key_hash, scopes, expires_at, created_at) VALUES (?,?,?,?,?,?,?,?)`
+	err = db.Exec(query, created.ID, created.IdUser, created.Name, created.Prefix, hash, strings.Join(created.Scopes, " "), created.ExpiresAt, created.CreatedAt).Error
+	if err != nil {
+		return ApiKey{}, err
+	}
+
+	return created, nil
+}
+
+func (r *UserRepository) GetUserApiKeys(ctx context.Context, idUser string) ([]ApiKey, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	rows, err := db.Raw(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id_user = ? ORDER BY created_at DESC`, idUser).Rows()
+	if err != nil {
+		return []ApiKey{}, err
+	}
+	defer rows.Close()
+
+	keys := []ApiKey{}
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return []ApiKey{}, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// GetApiKeyByHash returns an ENOTFOUND error when no key has that hash.
+// Keys of disabled users are not found.
+func (r *UserRepository) GetApiKeyByHash(ctx context.Context, hash string) (ApiKey, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = ? AND id_user NOT IN (SELECT id FROM users WHERE disabled_at IS NOT NULL)`
+	key, err := scanApiKey(db.Raw(query, hash).Row())
+	if errors.Is(err, sql.ErrNoRows) {
+		return ApiKey{}, projectError.Errorf(projectError.ENOTFOUND, "api key not found")
+	} else if err != nil {
+		return ApiKey{}, err
+	}
+
+	return key, nil
+}
+
+func (r *UserRepository) DeleteApiKey(ctx context.Context, id string, idUser string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	result := db.Exec(`DELETE FROM api_keys WHERE id = ? AND id_user = ?`, id, idUser)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ENOTFOUND, "api key not found")
+	}
+
+	return nil
+}
+
+// TouchApiKey records that key id was used at now. Writes closer than
+// apiKeyTouchInterval to the previous one are skipped.
+func (r *UserRepository) TouchApiKey(ctx context.Context, id string, now time.Time) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`
+	return db.Exec(query, now, id, now.Add(-apiKeyTouchInterval)).Error
+}
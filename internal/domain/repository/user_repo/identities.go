@@ -0,0 +1,43 @@
+package user_repo
+
+import (
+	"context"
+	"time"
+	"url_shortening/pkg/projectError"
+)
+
+// UserIdentity links an account of an external sign-in provider to a user.
+type UserIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	IdUser    string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetUserByIdentity returns an ENOTFOUND error when no user is linked to the
+// provider account.
+func (r *UserRepository) GetUserByIdentity(ctx context.Context, provider string, subject string) (User, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = (SELECT id_user FROM user_identities WHERE provider = ? AND subject = ?)`
+	return scanUser(db.Raw(query, provider, subject).Row())
+}
+
+// LinkIdentity returns an ECONFLICT error when the provider account is
+// already linked.
+func (r *UserRepository) LinkIdentity(ctx context.Context, identity *UserIdentity) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `INSERT INTO user_identities (provider, subject, id_user, email, created_at) VALUES (?,?,?,?,?) ON CONFLICT DO NOTHING`
+	result := db.Exec(query, identity.Provider, identity.Subject, identity.IdUser, identity.Email, time.Now())
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ECONFLICT, "identity already linked")
+	}
+
+	return nil
+}
@@ -0,0 +1,540 @@
+package user_repo
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"url_shortening/pkg/projectError"
+
+	"github.com/google/uuid"
+)
+
+// MemoryRepository keeps users in process memory. Nothing survives a restart,
+// so it is meant for development and tests.
+type MemoryRepository struct {
+	mu         sync.RWMutex
+	users      map[string]User
+	apiKeys    map[string]memoryApiKey
+	identities map[string]UserIdentity
+	tokens     map[string]UserToken
+	totp       map[string]UserTOTP
+	// recoveryCodes maps user ids to code hashes, true once used.
+	recoveryCodes map[string]map[string]bool
+}
+
+type memoryApiKey struct {
+	ApiKey
+	Hash string
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{users: map[string]User{}, apiKeys: map[string]memoryApiKey{}, identities: map[string]UserIdentity{}, tokens: map[string]UserToken{}, totp: map[string]UserTOTP{}, recoveryCodes: map[string]map[string]bool{}}
+}
+
+func (r *MemoryRepository) RegisterUser(ctx context.Context, user *User) (string, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, ok := r.users[user.Email]; ok {
+		return "", "", projectError.Errorf(projectError.ECONFLICT, "user already exists")
+	}
+
+	now := time.Now()
+	r.users[user.Email] = User{
+		ID:        uniqueID.String(),
+		Name:      user.Name,
+		Email:     user.Email,
+		Password:  user.Password,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Role:      RoleUser,
+	}
+
+	return uniqueID.String(), user.Email, nil
+}
+
+func (r *MemoryRepository) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return User{}, projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	return user, nil
+}
+
+func (r *MemoryRepository) GetUserByID(ctx context.Context, id string) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.getUserByID(id)
+}
+
+func (r *MemoryRepository) getUserByID(id string) (User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+
+	return User{}, projectError.Errorf(projectError.ENOTFOUND, "user not found")
+}
+
+func (r *MemoryRepository) MarkEmailVerified(ctx context.Context, idUser string, email string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok || user.ID != idUser {
+		return projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	user.UpdatedAt = now
+	r.users[email] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdatePassword(ctx context.Context, idUser string, password string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.getUserByID(idUser)
+	if err != nil {
+		return err
+	}
+
+	user.Password = password
+	user.UpdatedAt = time.Now()
+	r.users[user.Email] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateName(ctx context.Context, idUser string, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.getUserByID(idUser)
+	if err != nil {
+		return err
+	}
+
+	user.Name = name
+	user.UpdatedAt = time.Now()
+	r.users[user.Email] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) ChangeEmail(ctx context.Context, idUser string, email string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.getUserByID(idUser)
+	if err != nil {
+		return err
+	}
+
+	if existing, ok := r.users[email]; ok && existing.ID != idUser {
+		return projectError.Errorf(projectError.ECONFLICT, "user already exists")
+	}
+
+	delete(r.users, user.Email)
+	user.Email = email
+	user.EmailVerifiedAt = &now
+	user.UpdatedAt = now
+	r.users[email] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteUser(ctx context.Context, idUser string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.getUserByID(idUser)
+	if err != nil {
+		return err
+	}
+
+	delete(r.users, user.Email)
+	delete(r.totp, idUser)
+	delete(r.recoveryCodes, idUser)
+
+	for hash, token := range r.tokens {
+		if token.IdUser == idUser {
+			delete(r.tokens, hash)
+		}
+	}
+	for key, identity := range r.identities {
+		if identity.IdUser == idUser {
+			delete(r.identities, key)
+		}
+	}
+	for id, key := range r.apiKeys {
+		if key.IdUser == idUser {
+			delete(r.apiKeys, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) CreateUserToken(ctx context.Context, token *UserToken, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for tokenHash, saved := range r.tokens {
+		if saved.ExpiresAt.Before(now) {
+			delete(r.tokens, tokenHash)
+		}
+	}
+
+	created := *token
+	created.CreatedAt = now
+	r.tokens[hash] = created
+
+	return nil
+}
+
+func (r *MemoryRepository) ConsumeUserToken(ctx context.Context, hash string, purpose string, now time.Time) (UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[hash]
+	if !ok || token.Purpose != purpose {
+		return UserToken{}, projectError.Errorf(projectError.ENOTFOUND, "token not found")
+	}
+
+	delete(r.tokens, hash)
+	if !now.Before(token.ExpiresAt) {
+		return UserToken{}, projectError.Errorf(projectError.ENOTFOUND, "token not found")
+	}
+
+	return token, nil
+}
+
+func (r *MemoryRepository) DeleteUserTokens(ctx context.Context, idUser string, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, token := range r.tokens {
+		if token.IdUser == idUser && token.Purpose == purpose {
+			delete(r.tokens, hash)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) GetTOTP(ctx context.Context, idUser string) (UserTOTP, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	totp, ok := r.totp[idUser]
+	if !ok {
+		return UserTOTP{}, projectError.Errorf(projectError.ENOTFOUND, "totp not found")
+	}
+
+	return totp, nil
+}
+
+func (r *MemoryRepository) SaveTOTP(ctx context.Context, idUser string, secret string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.totp[idUser].Enabled() {
+		return projectError.Errorf(projectError.ECONFLICT, "two-factor authentication already enabled")
+	}
+
+	r.totp[idUser] = UserTOTP{IdUser: idUser, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (r *MemoryRepository) ConfirmTOTP(ctx context.Context, idUser string, step int64, now time.Time, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totp, ok := r.totp[idUser]
+	if !ok || totp.Enabled() || totp.LastStep >= step {
+		return projectError.Errorf(projectError.ECONFLICT, "no pending two-factor enrollment")
+	}
+
+	totp.ConfirmedAt = &now
+	totp.LastStep = step
+	r.totp[idUser] = totp
+	r.replaceRecoveryCodes(idUser, codeHashes)
+
+	return nil
+}
+
+func (r *MemoryRepository) UseTOTPStep(ctx context.Context, idUser string, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totp, ok := r.totp[idUser]
+	if !ok || !totp.Enabled() || totp.LastStep >= step {
+		return projectError.Errorf(projectError.ECONFLICT, "code already used")
+	}
+
+	totp.LastStep = step
+	r.totp[idUser] = totp
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteTOTP(ctx context.Context, idUser string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.totp[idUser]; !ok {
+		return projectError.Errorf(projectError.ENOTFOUND, "totp not found")
+	}
+
+	delete(r.totp, idUser)
+	delete(r.recoveryCodes, idUser)
+
+	return nil
+}
+
+func (r *MemoryRepository) ReplaceRecoveryCodes(ctx context.Context, idUser string, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.replaceRecoveryCodes(idUser, codeHashes)
+	return nil
+}
+
+func (r *MemoryRepository) replaceRecoveryCodes(idUser string, codeHashes []string) {
+	codes := map[string]bool{}
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	r.recoveryCodes[idUser] = codes
+}
+
+func (r *MemoryRepository) ConsumeRecoveryCode(ctx context.Context, idUser string, hash string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used, ok := r.recoveryCodes[idUser][hash]
+	if !ok || used {
+		return projectError.Errorf(projectError.ENOTFOUND, "recovery code not found")
+	}
+
+	r.recoveryCodes[idUser][hash] = true
+	return nil
+}
+
+func (r *MemoryRepository) CountRecoveryCodes(ctx context.Context, idUser string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, used := range r.recoveryCodes[idUser] {
+		if !used {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *MemoryRepository) GetUserByIdentity(ctx context.Context, provider string, subject string) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	identity, ok := r.identities[provider+"\x00"+subject]
+	if !ok {
+		return User{}, projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	return r.getUserByID(identity.IdUser)
+}
+
+func (r *MemoryRepository) LinkIdentity(ctx context.Context, identity *UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identity.Provider + "\x00" + identity.Subject
+	if _, ok := r.identities[key]; ok {
+		return projectError.Errorf(projectError.ECONFLICT, "identity already linked")
+	}
+
+	linked := *identity
+	linked.CreatedAt = time.Now()
+	r.identities[key] = linked
+
+	return nil
+}
+
+func (r *MemoryRepository) CreateApiKey(ctx context.Context, key *ApiKey, hash string) (ApiKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	uniqueID, err := uuid.NewV7()
+	if err != nil {
+		return ApiKey{}, err
+	}
+
+	created := *key
+	created.ID = uniqueID.String()
+	created.CreatedAt = time.Now()
+	r.apiKeys[created.ID] = memoryApiKey{ApiKey: created, Hash: hash}
+
+	return created, nil
+}
+
+func (r *MemoryRepository) GetUserApiKeys(ctx context.Context, idUser string) ([]ApiKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []ApiKey{}
+	for _, key := range r.apiKeys {
+		if key.IdUser == idUser {
+			keys = append(keys, key.ApiKey)
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b ApiKey) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (r *MemoryRepository) GetApiKeyByHash(ctx context.Context, hash string) (ApiKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.apiKeys {
+		if key.Hash == hash {
+			if user, err := r.getUserByID(key.IdUser); err == nil && user.Disabled() {
+				break
+			}
+			return key.ApiKey, nil
+		}
+	}
+
+	return ApiKey{}, projectError.Errorf(projectError.ENOTFOUND, "api key not found")
+}
+
+func (r *MemoryRepository) DeleteApiKey(ctx context.Context, id string, idUser string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok || key.IdUser != idUser {
+		return projectError.Errorf(projectError.ENOTFOUND, "api key not found")
+	}
+
+	delete(r.apiKeys, id)
+	return nil
+}
+
+func (r *MemoryRepository) TouchApiKey(ctx context.Context, id string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.apiKeys[id]; ok {
+		key.LastUsedAt = &now
+		r.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListUsers(ctx context.Context, search string, limit int, offset int) ([]User, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	search = strings.ToLower(search)
+
+	matching := []User{}
+	for _, user := range r.users {
+		if strings.Contains(strings.ToLower(user.Name), search) || strings.Contains(strings.ToLower(user.Email), search) {
+			matching = append(matching, user)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		if matching[i].CreatedAt.Equal(matching[j].CreatedAt) {
+			return matching[i].ID > matching[j].ID
+		}
+		return matching[i].CreatedAt.After(matching[j].CreatedAt)
+	})
+
+	total := int64(len(matching))
+	start := min(offset, len(matching))
+	end := min(start+limit, len(matching))
+
+	return matching[start:end], total, nil
+}
+
+func (r *MemoryRepository) SetRole(ctx context.Context, idUser string, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.getUserByID(idUser)
+	if err != nil {
+		return err
+	}
+
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	r.users[user.Email] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) SetDisabled(ctx context.Context, idUser string, disabledAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.getUserByID(idUser)
+	if err != nil {
+		return err
+	}
+
+	user.DisabledAt = disabledAt
+	user.UpdatedAt = time.Now()
+	r.users[user.Email] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) GetUserStats(ctx context.Context) (UserStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var stats UserStats
+	for _, user := range r.users {
+		stats.Total++
+		if user.Admin() {
+			stats.Admins++
+		}
+		if user.Disabled() {
+			stats.Disabled++
+		}
+		if user.EmailVerifiedAt == nil {
+			stats.Unverified++
+		}
+	}
+
+	return stats, nil
+}
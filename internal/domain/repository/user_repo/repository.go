@@ -0,0 +1,78 @@
+package user_repo
+
+import (
+	"context"
+	"time"
+)
+
+// Repository stores user accounts. UserRepository implements it on a SQL
+// database (Postgres or SQLite) and MemoryRepository in process memory.
+type Repository interface {
+	RegisterUser(ctx context.Context, user *User) (string, string, error)
+	// GetUserByEmail returns an ENOTFOUND error when no user has that email.
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	// GetUserByID returns an ENOTFOUND error when no user has that id.
+	GetUserByID(ctx context.Context, id string) (User, error)
+	// MarkEmailVerified returns an ENOTFOUND error when email is no longer
+	// the user's email.
+	MarkEmailVerified(ctx context.Context, idUser string, email string, now time.Time) error
+	UpdatePassword(ctx context.Context, idUser string, password string) error
+	UpdateName(ctx context.Context, idUser string, name string) error
+	// ChangeEmail returns an ECONFLICT error when another user has email.
+	ChangeEmail(ctx context.Context, idUser string, email string, now time.Time) error
+	// DeleteUser returns an ENOTFOUND error when no user has that id.
+	DeleteUser(ctx context.Context, idUser string) error
+
+	CreateUserToken(ctx context.Context, token *UserToken, hash string) error
+	// ConsumeUserToken returns an ENOTFOUND error when the token is unknown,
+	// already used or expired.
+	ConsumeUserToken(ctx context.Context, hash string, purpose string, now time.Time) (UserToken, error)
+	DeleteUserTokens(ctx context.Context, idUser string, purpose string) error
+
+	// GetTOTP returns an ENOTFOUND error when the user has no authenticator
+	// app, confirmed or not.
+	GetTOTP(ctx context.Context, idUser string) (UserTOTP, error)
+	// SaveTOTP returns an ECONFLICT error when the user already has a
+	// confirmed app.
+	SaveTOTP(ctx context.Context, idUser string, secret string) error
+	// ConfirmTOTP returns an ECONFLICT error when no enrollment is pending or
+	// step was already used.
+	ConfirmTOTP(ctx context.Context, idUser string, step int64, now time.Time, codeHashes []string) error
+	// UseTOTPStep returns an ECONFLICT error when step or a later one was
+	// already used.
+	UseTOTPStep(ctx context.Context, idUser string, step int64) error
+	// DeleteTOTP returns an ENOTFOUND error when the user has no app.
+	DeleteTOTP(ctx context.Context, idUser string) error
+	ReplaceRecoveryCodes(ctx context.Context, idUser string, codeHashes []string) error
+	// ConsumeRecoveryCode returns an ENOTFOUND error when the code is unknown
+	// or already used.
+	ConsumeRecoveryCode(ctx context.Context, idUser string, hash string, now time.Time) error
+	CountRecoveryCodes(ctx context.Context, idUser string) (int, error)
+
+	// GetUserByIdentity returns an ENOTFOUND error when no user is linked to
+	// the provider account.
+	GetUserByIdentity(ctx context.Context, provider string, subject string) (User, error)
+	// LinkIdentity returns an ECONFLICT error when the provider account is
+	// already linked.
+	LinkIdentity(ctx context.Context, identity *UserIdentity) error
+
+	CreateApiKey(ctx context.Context, key *ApiKey, hash string) (ApiKey, error)
+	GetUserApiKeys(ctx context.Context, idUser string) ([]ApiKey, error)
+	// GetApiKeyByHash returns an ENOTFOUND error when no key has that hash
+	// or its user is disabled.
+	GetApiKeyByHash(ctx context.Context, hash string) (ApiKey, error)
+	DeleteApiKey(ctx context.Context, id string, idUser string) error
+	TouchApiKey(ctx context.Context, id string, now time.Time) error
+
+	ListUsers(ctx context.Context, search string, limit int, offset int) ([]User, int64, error)
+	// SetRole returns an ENOTFOUND error when no user has that id.
+	SetRole(ctx context.Context, idUser string, role string) error
+	// SetDisabled returns an ENOTFOUND error when no user has that id.
+	SetDisabled(ctx context.Context, idUser string, disabledAt *time.Time) error
+	GetUserStats(ctx context.Context) (UserStats, error)
+}
+
+var (
+	_ Repository = (*UserRepository)(nil)
+	_ Repository = (*MemoryRepository)(nil)
+)
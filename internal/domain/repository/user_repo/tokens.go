@@ -0,0 +1,71 @@
+package user_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"url_shortening/pkg/projectError"
+)
+
+// Purposes of user tokens.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+	// TokenChangeEmail tokens are sent to the new address a user asked for;
+	// their email is that address.
+	TokenChangeEmail = "change_email"
+)
+
+// UserToken is a single-use token sent to a user by email. The token itself
+// is only known when it is created; the repository keeps its hash.
+type UserToken struct {
+	IdUser    string
+	Purpose   string
+	Email     string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// CreateUserToken stores a token and deletes the expired tokens of every
+// user, which were never used.
+func (r *UserRepository) CreateUserToken(ctx context.Context, token *UserToken, hash string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	now := time.Now()
+	if err := db.Exec(`DELETE FROM user_tokens WHERE expires_at < ?`, now).Error; err != nil {
+		return err
+	}
+
+	query := `INSERT INTO user_tokens (token_hash, id_user, purpose, email, expires_at, created_at) VALUES (?,?,?,?,?,?)`
+	return db.Exec(query, hash, token.IdUser, token.Purpose, token.Email, token.ExpiresAt, now).Error
+}
+
+// ConsumeUserToken deletes the token with hash and returns it. It returns an
+// ENOTFOUND error if the token does not exist, is for another purpose, was
+// already used or expired.
+func (r *UserRepository) ConsumeUserToken(ctx context.Context, hash string, purpose string, now time.Time) (UserToken, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	token := UserToken{Purpose: purpose}
+	query := `DELETE FROM user_tokens WHERE token_hash = ? AND purpose = ? RETURNING id_user, email, expires_at, created_at`
+	err := db.Raw(query, hash, purpose).Row().Scan(&token.IdUser, &token.Email, &token.ExpiresAt, &token.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !now.Before(token.ExpiresAt)) {
+		return UserToken{}, projectError.Errorf(projectError.ENOTFOUND, "token not found")
+	} else if err != nil {
+		return UserToken{}, err
+	}
+
+	return token, nil
+}
+
+// DeleteUserTokens deletes the tokens of idUser for purpose, so that only a
+// token sent afterwards works.
+func (r *UserRepository) DeleteUserTokens(ctx context.Context, idUser string, purpose string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	return db.Exec(`DELETE FROM user_tokens WHERE id_user = ? AND purpose = ?`, idUser, purpose).Error
+}
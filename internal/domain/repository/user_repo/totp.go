@@ -0,0 +1,181 @@
+package user_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"url_shortening/pkg/projectError"
+
+	"gorm.io/gorm"
+)
+
+// UserTOTP is the authenticator app of a user. It only protects sign-ins
+// once ConfirmedAt is set.
+type UserTOTP struct {
+	IdUser      string
+	Secret      string
+	ConfirmedAt *time.Time
+	// LastStep is the time step of the last accepted code.
+	LastStep  int64
+	CreatedAt time.Time
+}
+
+// Enabled reports whether sign-ins require a code.
+func (t UserTOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+// GetTOTP returns an ENOTFOUND error when idUser has no authenticator app,
+// confirmed or not.
+func (r *UserRepository) GetTOTP(ctx context.Context, idUser string) (UserTOTP, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	totp := UserTOTP{IdUser: idUser}
+	var confirmedAt sql.NullTime
+
+	query := `SELECT secret, confirmed_at, last_step, created_at FROM user_totp WHERE id_user = ?`
+	err := db.Raw(query, idUser).Row().Scan(&totp.Secret, &confirmedAt, &totp.LastStep, &totp.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserTOTP{}, projectError.Errorf(projectError.ENOTFOUND, "totp not found")
+	} else if err != nil {
+		return UserTOTP{}, err
+	}
+
+	if confirmedAt.Valid {
+		totp.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return totp, nil
+}
+
+// SaveTOTP starts an enrollment with secret, replacing a pending one. It
+// returns an ECONFLICT error if idUser already has a confirmed app.
+func (r *UserRepository) SaveTOTP(ctx context.Context, idUser string, secret string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `INSERT INTO user_totp (id_user, secret, last_step, created_at) VALUES (?,?,0,?)
+		ON CONFLICT (id_user) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = excluded.created_at
+		WHERE user_totp.confirmed_at IS NULL`
+	result := db.Exec(query, idUser, secret, time.Now())
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ECONFLICT, "two-factor authentication already enabled")
+	}
+
+	return nil
+}
+
+// ConfirmTOTP enables the pending app of idUser, accepting the code of step,
+// and replaces the recovery codes with codeHashes. It returns an ECONFLICT
+// error if there is no pending app or step was already used.
+func (r *UserRepository) ConfirmTOTP(ctx context.Context, idUser string, step int64, now time.Time, codeHashes []string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		query := `UPDATE user_totp SET confirmed_at = ?, last_step = ? WHERE id_user = ? AND confirmed_at IS NULL AND last_step < ?`
+		result := tx.Exec(query, now, step, idUser, step)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return projectError.Errorf(projectError.ECONFLICT, "no pending two-factor enrollment")
+		}
+
+		return replaceRecoveryCodes(tx, idUser, codeHashes)
+	})
+}
+
+// UseTOTPStep records that the code of step was accepted for idUser. It
+// returns an ECONFLICT error if that step or a later one was already used,
+// so a code cannot be replayed.
+func (r *UserRepository) UseTOTPStep(ctx context.Context, idUser string, step int64) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `UPDATE user_totp SET last_step = ? WHERE id_user = ? AND confirmed_at IS NOT NULL AND last_step < ?`
+	result := db.Exec(query, step, idUser, step)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ECONFLICT, "code already used")
+	}
+
+	return nil
+}
+
+// DeleteTOTP removes the app and recovery codes of idUser. It returns an
+// ENOTFOUND error if idUser has no app.
+func (r *UserRepository) DeleteTOTP(ctx context.Context, idUser string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM user_recovery_codes WHERE id_user = ?`, idUser).Error; err != nil {
+			return err
+		}
+
+		result := tx.Exec(`DELETE FROM user_totp WHERE id_user = ?`, idUser)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return projectError.Errorf(projectError.ENOTFOUND, "totp not found")
+		}
+
+		return nil
+	})
+}
+
+// ReplaceRecoveryCodes makes codeHashes the only recovery codes of idUser.
+func (r *UserRepository) ReplaceRecoveryCodes(ctx context.Context, idUser string, codeHashes []string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, idUser, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, idUser string, codeHashes []string) error {
+	if err := tx.Exec(`DELETE FROM user_recovery_codes WHERE id_user = ?`, idUser).Error; err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		if err := tx.Exec(`INSERT INTO user_recovery_codes (id_user, code_hash) VALUES (?,?)`, idUser, hash).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConsumeRecoveryCode marks a recovery code of idUser as used. It returns an
+// ENOTFOUND error if the code is unknown or already used.
+func (r *UserRepository) ConsumeRecoveryCode(ctx context.Context, idUser string, hash string, now time.Time) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `UPDATE user_recovery_codes SET used_at = ? WHERE id_user = ? AND code_hash = ? AND used_at IS NULL`
+	result := db.Exec(query, now, idUser, hash)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ENOTFOUND, "recovery code not found")
+	}
+
+	return nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes idUser has left.
+func (r *UserRepository) CountRecoveryCodes(ctx context.Context, idUser string) (int, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var count int
+	err := db.Raw(`SELECT COUNT(*) FROM user_recovery_codes WHERE id_user = ? AND used_at IS NULL`, idUser).Row().Scan(&count)
+	return count, err
+}
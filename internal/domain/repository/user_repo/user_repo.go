@@ -1,12 +1,22 @@
 package user_repo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"time"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
+	"url_shortening/infra/db/sqldb"
+	"url_shortening/pkg/projectError"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Roles of users. Admins moderate users and links through /admin.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
 )
 
 type User struct {
@@ -16,18 +26,56 @@ type User struct {
 	ID        string    `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// EmailVerifiedAt is nil until the user confirms their email.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Role            string     `json:"role"`
+	// DisabledAt is nil unless an admin disabled the account.
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+func (u User) Admin() bool {
+	return u.Role == RoleAdmin
+}
+
+func (u User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+const userColumns = `id, name, email, password, created_at, updated_at, email_verified_at, role, disabled_at`
+
+func scanUser(row scanner) (User, error) {
+	var user User
+	var emailVerifiedAt, disabledAt sql.NullTime
+
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &emailVerifiedAt, &user.Role, &disabledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	} else if err != nil {
+		return User{}, err
+	}
+
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+
+	return user, nil
 }
 
 type UserRepository struct {
-	db     *postgres.Postgres
+	db     *sqldb.Database
 	config *environment.Config
 }
 
-func NewUserRepository(db *postgres.Postgres, config *environment.Config) *UserRepository {
+func NewUserRepository(db *sqldb.Database, config *environment.Config) *UserRepository {
 	return &UserRepository{db: db, config: config}
 }
 
-func (r *UserRepository) RegisterUser(user *User) (string, string, error) {
+func (r *UserRepository) RegisterUser(ctx context.Context, user *User) (string, string, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
 
 	uniqueID, err := uuid.NewV7()
 	if err != nil {
@@ -35,33 +83,130 @@ func (r *UserRepository) RegisterUser(user *User) (string, string, error) {
 	}
 
 	var count int
-	err = r.db.Db.Raw(`SELECT COUNT(*) FROM users WHERE email = ?`, user.Email).Row().Scan(&count)
+	err = db.Raw(`SELECT COUNT(*) FROM users WHERE email = ?`, user.Email).Row().Scan(&count)
 	if err != nil {
 		return "", "", err
 	}
 
 	if count > 0 {
-		return "", "", errors.New("user already exists")
+		return "", "", projectError.Errorf(projectError.ECONFLICT, "user already exists")
 	}
 
-	query := `INSERT INTO users (id, name, email, password) VALUES ($1, $2, $3, $4)`
-	response, err := r.db.Db.Raw(query, uniqueID, user.Name, user.Email, user.Password).Rows()
-	if err != nil {
+	query := `INSERT INTO users (id, name, email, password) VALUES (?, ?, ?, ?)`
+	// Exec, not Raw: SQLite only runs a statement once its rows are read.
+	if err := db.Exec(query, uniqueID, user.Name, user.Email, user.Password).Error; err != nil {
 		return "", "", err
 	}
 
-	defer response.Close()
-
 	return uniqueID.String(), user.Email, nil
 }
 
-func (r *UserRepository) GetUserByEmail(email string) (User, error) {
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
 
-	var user User
-	err := r.db.Db.Raw(`SELECT * FROM users WHERE email = $1`, email).Row().Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	return scanUser(db.Raw(`SELECT `+userColumns+` FROM users WHERE email = ?`, email).Row())
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (User, error) {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	return scanUser(db.Raw(`SELECT `+userColumns+` FROM users WHERE id = ?`, id).Row())
+}
+
+// MarkEmailVerified records that idUser confirmed email. It returns an
+// ENOTFOUND error if that is no longer the user's email.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, idUser string, email string, now time.Time) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?), updated_at = ? WHERE id = ? AND email = ?`
+	result := db.Exec(query, now, now, idUser, email)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	return nil
+}
+
+// UpdatePassword replaces the password hash of idUser.
+func (r *UserRepository) UpdatePassword(ctx context.Context, idUser string, password string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	result := db.Exec(`UPDATE users SET password = ?, updated_at = ? WHERE id = ?`, password, time.Now(), idUser)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	return nil
+}
+
+// UpdateName replaces the display name of idUser.
+func (r *UserRepository) UpdateName(ctx context.Context, idUser string, name string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	result := db.Exec(`UPDATE users SET name = ?, updated_at = ? WHERE id = ?`, name, time.Now(), idUser)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	return nil
+}
+
+// ChangeEmail replaces the email of idUser with one they confirmed. It
+// returns an ECONFLICT error if another user has taken it in the meantime.
+func (r *UserRepository) ChangeEmail(ctx context.Context, idUser string, email string, now time.Time) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	var count int
+	err := db.Raw(`SELECT COUNT(*) FROM users WHERE email = ? AND id <> ?`, email, idUser).Row().Scan(&count)
 	if err != nil {
-		return User{}, err
+		return err
+	} else if count > 0 {
+		return projectError.Errorf(projectError.ECONFLICT, "user already exists")
 	}
 
-	return user, nil
+	query := `UPDATE users SET email = ?, email_verified_at = ?, updated_at = ? WHERE id = ?`
+	result := db.Exec(query, email, now, now, idUser)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return projectError.Errorf(projectError.ENOTFOUND, "user not found")
+	}
+
+	return nil
+}
+
+// DeleteUser deletes idUser with their tokens, keys, linked provider
+// accounts and second factors. Their links must be gone already.
+func (r *UserRepository) DeleteUser(ctx context.Context, idUser string) error {
+	db, cancel := r.db.WithContext(ctx)
+	defer cancel()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"user_recovery_codes", "user_totp", "user_tokens", "user_identities", "api_keys"} {
+			if err := tx.Exec(`DELETE FROM `+table+` WHERE id_user = ?`, idUser).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Exec(`DELETE FROM users WHERE id = ?`, idUser)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return projectError.Errorf(projectError.ENOTFOUND, "user not found")
+		}
+
+		return nil
+	})
 }
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"encoding/json"
+	"url_shortening/infra/config/environment"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/pkg/projectError"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// Stats counts users and links. Clicks still waiting in Redis are not
+// included.
+func Stats(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	users, err := store.Users.GetUserStats(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	links, err := store.Urls.GetUrlStats(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"users": users,
+		"links": links,
+	})
+}
+
+// page reads the limit and offset query parameters of a list.
+func page(c *fiber.Ctx) (int, int, error) {
+	limit := c.QueryInt("limit", defaultPageSize)
+	offset := c.QueryInt("offset", 0)
+
+	if limit < 1 || limit > maxPageSize {
+		return 0, 0, projectError.Errorf(projectError.EINVALID, "limit must be between 1 and %d", maxPageSize)
+	} else if offset < 0 {
+		return 0, 0, projectError.Errorf(projectError.EINVALID, "offset must not be negative")
+	}
+
+	return limit, offset, nil
+}
+
+// parseRequest decodes and validates the JSON body into request. An empty
+// body leaves the defaults of request.
+func parseRequest(c *fiber.Ctx, request any) error {
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), request); err != nil {
+			return projectError.Errorf(projectError.EINVALID, "Invalid JSON")
+		}
+	}
+
+	validate := validator.New()
+
+	err := validate.Struct(request)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		return projectError.Errorf(projectError.EINVALID, "Validation error: %s", errors)
+	}
+
+	return nil
+}
+
+func actorFromCtx(c *fiber.Ctx) urlShortening_repo.Actor {
+	return urlShortening_repo.Actor{
+		IdUser:   c.Locals("id").(string),
+		ClientIP: c.IP(),
+	}
+}
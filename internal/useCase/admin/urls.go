@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"log"
+	"time"
+	"url_shortening/infra/cache"
+	"url_shortening/infra/config/environment"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ExpireUrlRequest struct {
+	// ExpiresAt defaults to now, which stops the link at once.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type TakeDownUrlRequest struct {
+	// Reason is shown to visitors of the link.
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// urlItem is a link as listed to admins, with the email of its owner.
+type urlItem struct {
+	urlShortening_repo.AdminUrlItem
+	OwnerEmail string `json:"owner_email"`
+}
+
+// ListUrls returns a page of the links of every user, newest first. The q
+// query parameter searches destinations and slugs, user keeps the links of
+// one user and status keeps live, deleted, expired or taken_down links.
+func ListUrls(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	limit, offset, err := page(c)
+	if err != nil {
+		return err
+	}
+
+	filter := urlShortening_repo.UrlFilter{
+		Search: c.Query("q"),
+		IdUser: c.Query("user"),
+		Status: c.Query("status"),
+	}
+
+	switch filter.Status {
+	case "", urlShortening_repo.StatusLive, urlShortening_repo.StatusDeleted, urlShortening_repo.StatusExpired, urlShortening_repo.StatusTakenDown:
+	default:
+		return projectError.Errorf(projectError.EINVALID, "status must be live, deleted, expired or taken_down")
+	}
+
+	urls, total, err := store.Urls.ListUrls(c.UserContext(), filter, limit, offset)
+	if err != nil {
+		return err
+	}
+
+	// A page has few distinct owners; each is looked up once.
+	emails := map[string]string{}
+	items := make([]urlItem, len(urls))
+	for i, url := range urls {
+		email, ok := emails[url.IdUser]
+		if !ok {
+			user, err := store.Users.GetUserByID(c.UserContext(), url.IdUser)
+			if err != nil && projectError.ErrorCode(err) != projectError.ENOTFOUND {
+				return err
+			}
+			email = user.Email
+			emails[url.IdUser] = email
+		}
+
+		items[i] = urlItem{AdminUrlItem: url, OwnerEmail: email}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"urls":  items,
+		"total": total,
+	})
+}
+
+// ExpireUrl makes a link stop redirecting at a given time, by default now.
+// Visitors get 410 Gone afterwards.
+func ExpireUrl(c *fiber.Ctx, store *store.Store, cache cache.Cache, config *environment.Config) error {
+	var request ExpireUrlRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now()
+	if request.ExpiresAt != nil {
+		expiresAt = *request.ExpiresAt
+	}
+
+	url, err := store.Urls.ExpireUrl(c.UserContext(), c.Params("id"), expiresAt, actorFromCtx(c))
+	if err != nil {
+		return err
+	}
+
+	invalidate(c, cache, url.Slug)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Url expiry set",
+		"expires_at": expiresAt,
+	})
+}
+
+// TakeDownUrl stops a link at once. Visitors get 410 Gone with the reason.
+func TakeDownUrl(c *fiber.Ctx, store *store.Store, cache cache.Cache, config *environment.Config) error {
+	var request TakeDownUrlRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	url, err := store.Urls.TakeDownUrl(c.UserContext(), c.Params("id"), request.Reason, actorFromCtx(c))
+	if err != nil {
+		return err
+	}
+
+	invalidate(c, cache, url.Slug)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Url taken down",
+	})
+}
+
+// ReinstateUrl lifts the takedown and expiry of a link, which redirects
+// again.
+func ReinstateUrl(c *fiber.Ctx, store *store.Store, cache cache.Cache, config *environment.Config) error {
+	url, err := store.Urls.ReinstateUrl(c.UserContext(), c.Params("id"), actorFromCtx(c))
+	if err != nil {
+		return err
+	}
+
+	invalidate(c, cache, url.Slug)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Url reinstated",
+	})
+}
+
+// invalidate drops the cached destination of slug on every instance, so a
+// moderation applies to the next redirect.
+func invalidate(c *fiber.Ctx, cache cache.Cache, slug string) {
+	if err := cache.Del(c.UserContext(), slug); err != nil {
+		log.Printf("failed to invalidate url %q in cache: %v", slug, err)
+	}
+}
@@ -0,0 +1,154 @@
+package admin
+
+import (
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user admin"`
+}
+
+// userItem is a user as shown to admins, without their password hash.
+type userItem struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	EmailVerified bool       `json:"email_verified"`
+	DisabledAt    *time.Time `json:"disabled_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func newUserItem(user user_repo.User) userItem {
+	return userItem{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		DisabledAt:    user.DisabledAt,
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+// ListUsers returns a page of the users whose name or email contains the q
+// query parameter, newest first.
+func ListUsers(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	limit, offset, err := page(c)
+	if err != nil {
+		return err
+	}
+
+	users, total, err := store.Users.ListUsers(c.UserContext(), c.Query("q"), limit, offset)
+	if err != nil {
+		return err
+	}
+
+	items := make([]userItem, len(users))
+	for i, user := range users {
+		items[i] = newUserItem(user)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"users": items,
+		"total": total,
+	})
+}
+
+// SetRole makes a user an admin or a regular user. Their sessions are
+// signed out, so their next access tokens carry the new role.
+func SetRole(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, config *environment.Config) error {
+	var request SetRoleRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	user, err := otherUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	if user.Role != request.Role {
+		if err := store.Users.SetRole(c.UserContext(), user.ID, request.Role); err != nil {
+			return err
+		}
+
+		if err := sessionManager.RevokeAll(c.UserContext(), user.ID, ""); err != nil {
+			return err
+		}
+		user.Role = request.Role
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"user": newUserItem(user),
+	})
+}
+
+// DisableUser stops a user from signing in and signs out their sessions.
+// Their API keys stop working too. Their links keep redirecting; abusive
+// ones are taken down with TakeDownUrl.
+func DisableUser(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, config *environment.Config) error {
+	user, err := otherUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	if !user.Disabled() {
+		now := time.Now()
+		if err := store.Users.SetDisabled(c.UserContext(), user.ID, &now); err != nil {
+			return err
+		}
+		user.DisabledAt = &now
+	}
+
+	// Revoked even if already disabled, in case an earlier attempt failed
+	// halfway.
+	if err := sessionManager.RevokeAll(c.UserContext(), user.ID, ""); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"user": newUserItem(user),
+	})
+}
+
+// EnableUser lets a disabled user sign in again.
+func EnableUser(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	user, err := otherUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	if user.Disabled() {
+		if err := store.Users.SetDisabled(c.UserContext(), user.ID, nil); err != nil {
+			return err
+		}
+		user.DisabledAt = nil
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"user": newUserItem(user),
+	})
+}
+
+// otherUser returns the user of the id route parameter. Admins cannot
+// change their own account here, so the last admin cannot lock everyone out.
+func otherUser(c *fiber.Ctx, store *store.Store) (user_repo.User, error) {
+	if c.Params("id") == c.Locals("id") {
+		return user_repo.User{}, projectError.Errorf(projectError.EINVALID, "You cannot moderate your own account")
+	}
+
+	user, err := store.Users.GetUserByID(c.UserContext(), c.Params("id"))
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return user_repo.User{}, projectError.Errorf(projectError.ENOTFOUND, "User not found")
+	}
+
+	return user, err
+}
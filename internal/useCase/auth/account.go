@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"url_shortening/infra/cache"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/mailer"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/cryptPkg"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// What DeleteAccount does with the links of the account.
+const (
+	LinksDelete   = "delete"
+	LinksTransfer = "transfer"
+)
+
+type UpdateProfileRequest struct {
+	Name  string `json:"name" validate:"omitempty,max=255"`
+	Email string `json:"email" validate:"omitempty,email,max=255"`
+	// Password is only needed to change the email.
+	Password string `json:"password"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+	Links    string `json:"links" validate:"required,oneof=delete transfer"`
+	// TransferTo is the email of the user who is offered the links.
+	TransferTo string `json:"transfer_to" validate:"required_if=Links transfer,omitempty,email"`
+}
+
+// UpdateProfile changes the name of the authenticated user at once. A new
+// email only replaces the current one once confirmed through a link sent to
+// it, so the account never points to an address nobody owns.
+func UpdateProfile(c *fiber.Ctx, store *store.Store, mail mailer.Mailer, config *environment.Config) error {
+	var request UpdateProfileRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	if name := strings.TrimSpace(request.Name); name != "" && name != user.Name {
+		if err := repository.UpdateName(c.UserContext(), user.ID, name); err != nil {
+			return err
+		}
+		user.Name = name
+	}
+
+	pendingEmail := ""
+	if request.Email != "" && request.Email != user.Email {
+		// 403 rather than 401: the session is fine, the frontend must not
+		// refresh it and retry.
+		if !cryptPkg.ComparePassword(request.Password, user.Password) {
+			return projectError.Errorf(projectError.EFORBIDDEN, "Password is incorrect")
+		}
+
+		_, err := repository.GetUserByEmail(c.UserContext(), request.Email)
+		if err == nil {
+			return projectError.Errorf(projectError.ECONFLICT, "Email already in use")
+		} else if projectError.ErrorCode(err) != projectError.ENOTFOUND {
+			return err
+		}
+
+		if err := sendEmailChange(c.UserContext(), store, mail, user, request.Email, config); err != nil {
+			return err
+		}
+		pendingEmail = request.Email
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"user": fiber.Map{
+			"id":             user.ID,
+			"name":           user.Name,
+			"email":          user.Email,
+			"email_verified": user.EmailVerifiedAt != nil,
+		},
+		"pending_email": pendingEmail,
+	})
+}
+
+// sendEmailChange emails a link confirming email as the new address of
+// user. Links sent earlier, possibly to another address, stop working.
+func sendEmailChange(ctx context.Context, store *store.Store, mail mailer.Mailer, user user_repo.User, email string, config *environment.Config) error {
+	recipient := user
+	recipient.Email = email
+
+	token, err := newUserToken(ctx, store, recipient, user_repo.TokenChangeEmail, config.AUTH.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := config.FRONTEND_URL + "/verify-email?change=1&token=" + url.QueryEscape(token)
+	return sendMail(ctx, mail, user, mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email",
+		Text: fmt.Sprintf("Hi %s,\n\nConfirm %s as the new email of your account by opening this link:\n\n%s\n\nThe link expires in %s. Until then you keep signing in with %s. If you did not ask for this, ignore this email.\n",
+			user.Name, email, link, expiresIn(config.AUTH.VerificationTTL), user.Email),
+	})
+}
+
+// ConfirmEmailChange replaces the email of a user with the address an
+// email change link was sent to. The token is the proof, so no session is
+// needed. The previous address is told about the change.
+func ConfirmEmailChange(c *fiber.Ctx, store *store.Store, mail mailer.Mailer, config *environment.Config) error {
+	var request ConfirmEmailChangeRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	repository := store.Users
+	token, err := repository.ConsumeUserToken(c.UserContext(), cryptPkg.HashToken(request.Token), user_repo.TokenChangeEmail, now)
+	var user user_repo.User
+	if err == nil {
+		user, err = repository.GetUserByID(c.UserContext(), token.IdUser)
+	}
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return projectError.Errorf(projectError.EINVALID, "Confirmation link is invalid or expired")
+	} else if err != nil {
+		return err
+	}
+
+	err = repository.ChangeEmail(c.UserContext(), user.ID, token.Email, now)
+	if projectError.ErrorCode(err) == projectError.ECONFLICT {
+		return projectError.Errorf(projectError.ECONFLICT, "Email already in use")
+	} else if err != nil {
+		return err
+	}
+
+	// sendMail logs a failure, which must not fail the change already made.
+	_ = sendMail(c.UserContext(), mail, user, mailer.Message{
+		To:      user.Email,
+		Subject: "Your email was changed",
+		Text: fmt.Sprintf("Hi %s,\n\nThe email of your account was changed to %s. If you did not do this, reset your password at %s/forgot-password using the new address, or contact us.\n",
+			user.Name, token.Email, config.FRONTEND_URL),
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Email changed",
+	})
+}
+
+// DeleteAccount deletes the authenticated user for good. Their links are
+// either deleted with them, which frees their slugs, or offered to another
+// user: the account is then deleted once that user accepts or declines the
+// links, or after AUTH_DELETION_TRANSFER_TTL, and kept if the transfer is
+// cancelled. No one is handed links without accepting them. Deleting the
+// links signs out every session first, so a failure never leaves a
+// half-deleted account signed in. Users without a password, who signed up
+// with a provider, set one through ForgotPassword first.
+func DeleteAccount(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, cache cache.Cache, slugs *cache.Slugs, config *environment.Config) error {
+	var request DeleteAccountRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	if !cryptPkg.ComparePassword(request.Password, user.Password) {
+		return projectError.Errorf(projectError.EFORBIDDEN, "Password is incorrect")
+	}
+
+	// The user stays signed in until the transfer ends, to cancel it.
+	if request.Links == LinksTransfer {
+		recipient, err := repository.GetUserByEmail(c.UserContext(), request.TransferTo)
+		if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+			return projectError.Errorf(projectError.ENOTFOUND, "Recipient not found")
+		} else if err != nil {
+			return err
+		}
+
+		actor := urlShortening_repo.Actor{IdUser: user.ID, ClientIP: c.IP()}
+		transfer, err := store.Urls.CreateDeletionTransfer(c.UserContext(), recipient.ID, actor)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":    "Account will be deleted once the transfer ends",
+			"transfer":   transfer,
+			"expires_at": transfer.CreatedAt.Add(config.AUTH.DeletionTransferTTL),
+		})
+	}
+
+	if err := sessionManager.RevokeAll(c.UserContext(), user.ID, ""); err != nil {
+		return err
+	}
+	clearSessionCookies(c)
+
+	purged, err := store.DeleteUser(c.UserContext(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(purged) > 0 {
+		slugs.Deleted(c.UserContext(), purged...)
+
+		if err := cache.Del(c.UserContext(), purged...); err != nil {
+			log.Printf("failed to invalidate urls of deleted user %s in cache: %v", user.ID, err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Account deleted",
+		"links_deleted": len(purged),
+	})
+}
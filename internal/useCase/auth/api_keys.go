@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/json"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/cryptPkg"
+	"url_shortening/pkg/projectError"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ApiKeyPrefix starts every API key, so leaked keys are easy to recognise.
+const ApiKeyPrefix = "usk_"
+
+// apiKeyShownPrefix is how much of a key is stored in clear to tell keys apart.
+const apiKeyShownPrefix = len(ApiKeyPrefix) + 8
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=255"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=links:read links:write stats:read"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateApiKey creates an API key for the user. The key is only returned
+// here; afterwards only its prefix is shown.
+func CreateApiKey(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	var request CreateApiKeyRequest
+
+	err := json.Unmarshal(c.Body(), &request)
+	if err != nil {
+		return projectError.Errorf(projectError.EINVALID, "Invalid JSON")
+	}
+
+	validate := validator.New()
+
+	err = validate.Struct(request)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		return projectError.Errorf(projectError.EINVALID, "Validation error: %s", errors)
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return projectError.Errorf(projectError.EINVALID, "Expiration must be in the future")
+	}
+
+	key := ApiKeyPrefix + cryptPkg.RandomToken(32)
+
+	repository := store.Users
+	created, err := repository.CreateApiKey(c.UserContext(), &user_repo.ApiKey{
+		IdUser:    c.Locals("id").(string),
+		Name:      request.Name,
+		Prefix:    key[:apiKeyShownPrefix],
+		Scopes:    request.Scopes,
+		ExpiresAt: request.ExpiresAt,
+	}, cryptPkg.HashToken(key))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Store this key now, it will not be shown again",
+		"key":     key,
+		"api_key": created,
+	})
+}
+
+func ListApiKeys(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	repository := store.Users
+	keys, err := repository.GetUserApiKeys(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"api_keys": keys,
+	})
+}
+
+// RevokeApiKey deletes an API key; requests made with it fail at once.
+func RevokeApiKey(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	repository := store.Users
+	if err := repository.DeleteApiKey(c.UserContext(), c.Params("id"), c.Locals("id").(string)); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API key revoked",
+	})
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/lockout"
+	"url_shortening/infra/mailer"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// lockoutSendTimeout bounds sending a lockout email, which happens after the
+// response.
+const lockoutSendTimeout = 30 * time.Second
+
+// checkLockout refuses a sign-in to email with 429 while the account or the
+// client IP must wait after failed attempts.
+func checkLockout(c *fiber.Ctx, guard *lockout.Guard, email string) error {
+	wait, err := guard.Check(c.UserContext(), email, c.IP())
+	if err != nil {
+		return err
+	} else if wait <= 0 {
+		return nil
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return projectError.Errorf(projectError.ERATELIMITED, "Too many failed sign-ins, try again in %s", time.Duration(seconds)*time.Second)
+}
+
+// failLogin records a failed sign-in to email. When it locks the account,
+// its owner, if any, is emailed after the response, so the answer takes as
+// long whether or not the account exists.
+func failLogin(c *fiber.Ctx, store *store.Store, guard *lockout.Guard, mail mailer.Mailer, email string, config *environment.Config) error {
+	locked, err := guard.Fail(c.UserContext(), email, c.IP())
+	if err != nil || !locked {
+		return err
+	}
+
+	ip := c.IP()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lockoutSendTimeout)
+		defer cancel()
+
+		if err := notifyLockout(ctx, store, mail, email, ip, config); err != nil {
+			log.Printf("lockout notification for %s: %v", email, err)
+		}
+	}()
+
+	return nil
+}
+
+func notifyLockout(ctx context.Context, store *store.Store, mail mailer.Mailer, email string, ip string, config *environment.Config) error {
+	user, err := store.Users.GetUserByEmail(ctx, email)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return sendMail(ctx, mail, user, mailer.Message{
+		To:      user.Email,
+		Subject: "Sign-in to your account was locked",
+		Text: fmt.Sprintf("Hi %s,\n\nAfter %d failed sign-in attempts, the last one from %s, signing in to your account is locked for %s.\n\nIf this was you, wait and try again. If not, someone may be guessing your password: reset it at %s/forgot-password, which also lifts the lock.\n",
+			user.Name, config.LOCKOUT.AccountThreshold, ip, expiresIn(config.LOCKOUT.Duration), config.FRONTEND_URL),
+	})
+}
@@ -1,19 +1,15 @@
 package auth
 
 import (
-	"encoding/json"
-	"fmt"
-	"time"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
-	"url_shortening/infra/db/redis"
-	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/infra/lockout"
+	"url_shortening/infra/mailer"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
 	"url_shortening/pkg/cryptPkg"
-	"url_shortening/pkg/jwtpkg"
+	"url_shortening/pkg/projectError"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type LoginRequest struct {
@@ -21,65 +17,50 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required,min=8"`
 }
 
-func Login(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *environment.Config) error {
-
-	body := c.Body()
-
-	var user LoginRequest
+// Login checks the password of a user and opens a session. Unknown emails
+// get the same answer, in the same time, as wrong passwords, and repeated
+// failures are slowed down and locked by guard.
+func Login(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, guard *lockout.Guard, mail mailer.Mailer, config *environment.Config) error {
+	var request LoginRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
 
-	err := json.Unmarshal(body, &user)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid JSON",
-		})
+	if err := checkLockout(c, guard, request.Email); err != nil {
+		return err
 	}
 
-	validate := validator.New()
+	repository := store.Users
+	response, err := repository.GetUserByEmail(c.UserContext(), request.Email)
+	found := err == nil
+	if err != nil && projectError.ErrorCode(err) != projectError.ENOTFOUND {
+		return err
+	}
 
-	// Validate the User struct
-	err = validate.Struct(user)
-	if err != nil {
-		// Validation failed, handle the error
-		errors := err.(validator.ValidationErrors)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Validation error: %s", errors),
-		})
+	if !cryptPkg.ComparePasswordOrDummy(request.Password, response.Password, found) {
+		if err := failLogin(c, store, guard, mail, request.Email, config); err != nil {
+			return err
+		}
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "email or password is incorrect")
 	}
 
-	repository := user_repo.NewUserRepository(db, config)
-	response, err := repository.GetUserByEmail(user.Email)
+	twoFactor, err := signIn(c, store, sessionManager, response, config)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
-	if !cryptPkg.ComparePassword(user.Password, response.Password) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "email or password is incorrect",
+	// The session cookie waits for the code, sent to POST /auth/login/2fa.
+	if twoFactor {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":             "Two-factor code required",
+			"two_factor_required": true,
 		})
 	}
 
-	token, err := jwtpkg.GenerateToken(jwt.MapClaims{
-		"id":    response.ID,
-		"email": user.Email,
-	}, config.JWT_SECRET)
-
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if err := guard.Succeed(c.UserContext(), request.Email); err != nil {
+		return err
 	}
 
-	cookie := new(fiber.Cookie)
-	cookie.Name = "token"
-	cookie.Value = token
-	cookie.Expires = time.Now().Add(24 * time.Hour)
-	cookie.HTTPOnly = true
-	cookie.Secure = false // Set to true in production with HTTPS
-	cookie.SameSite = "Lax"
-	c.Cookie(cookie)
-
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Login successful",
 		"user": fiber.Map{
@@ -1,24 +1,32 @@
 package auth
 
 import (
-	"time"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
-	"url_shortening/infra/db/redis"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/pkg/jwtpkg"
+	"url_shortening/pkg/projectError"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func Logout(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *environment.Config) error {
-	// Limpar o cookie do token
-	cookie := new(fiber.Cookie)
-	cookie.Name = "token"
-	cookie.Value = ""
-	cookie.Expires = time.Now().Add(-time.Hour) // Expirar no passado
-	cookie.HTTPOnly = true
-	cookie.Secure = false
-	cookie.SameSite = "Lax"
-	c.Cookie(cookie)
+// Logout ends the current session, so its tokens stop working even if they
+// were copied, and clears the cookies. The refresh token is enough to log out
+// once the access token has expired.
+func Logout(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, config *environment.Config) error {
+	if err := sessionManager.RevokeToken(c.UserContext(), c.Cookies(refreshCookie)); err != nil {
+		return err
+	}
+
+	if claims, err := jwtpkg.ValidateToken(c.Cookies(accessCookie), config.JWT_SECRET); err == nil {
+		idUser, _ := claims["id"].(string)
+		sid, _ := claims["sid"].(string)
+		if err := sessionManager.Revoke(c.UserContext(), idUser, sid); err != nil && projectError.ErrorCode(err) != projectError.ENOTFOUND {
+			return err
+		}
+	}
+
+	clearSessionCookies(c)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Logout successful",
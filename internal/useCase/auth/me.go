@@ -2,53 +2,44 @@ package auth
 
 import (
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
-	"url_shortening/infra/db/redis"
-	"url_shortening/internal/domain/repository/user_repo"
-	"url_shortening/pkg/jwtpkg"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/pkg/projectError"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func Me(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *environment.Config) error {
-	// Obter token do cookie
-	token := c.Cookies("token")
-	if token == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Token not found",
-		})
-	}
-
-	// Verificar e decodificar o token
-	claims, err := jwtpkg.ValidateToken(token, config.JWT_SECRET)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid token",
-		})
-	}
-
-	// Extrair email dos claims
-	emailClaim, ok := claims["email"].(string)
+// Me returns the authenticated user. It runs behind AuthMiddleware, which
+// has already checked the access token and its session. The user is looked
+// up by id: the email in the token is outdated once the user changes it.
+func Me(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, config *environment.Config) error {
+	idUser, ok := c.Locals("id").(string)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid token claims",
-		})
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Invalid token claims")
 	}
 
 	// Buscar usuário no banco
-	repository := user_repo.NewUserRepository(db, config)
-	user, err := repository.GetUserByEmail(emailClaim)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not found",
-		})
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), idUser)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "User not found")
+	} else if err != nil {
+		return err
+	}
+
+	totp, err := repository.GetTOTP(c.UserContext(), user.ID)
+	if err != nil && projectError.ErrorCode(err) != projectError.ENOTFOUND {
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"user": fiber.Map{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
+			"id":                 user.ID,
+			"name":               user.Name,
+			"email":              user.Email,
+			"email_verified":     user.EmailVerifiedAt != nil,
+			"two_factor_enabled": totp.Enabled(),
+			"role":               user.Role,
 		},
 	})
 }
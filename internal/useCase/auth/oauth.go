@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"log"
+	"net/url"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/oauth"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// oauthStateCookie binds a sign-in to the browser that started it, so a
+	// callback url cannot be used to sign someone else in.
+	oauthStateCookie = "oauth_state"
+	oauthPath        = "/auth/oauth"
+)
+
+// OAuthProviders lists the providers users can sign in with.
+func OAuthProviders(c *fiber.Ctx, oauthManager *oauth.Manager, config *environment.Config) error {
+	providers := oauthManager.Providers()
+	if providers == nil {
+		providers = []string{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"providers": providers,
+	})
+}
+
+// OAuthStart sends the browser to the provider's sign-in page.
+func OAuthStart(c *fiber.Ctx, oauthManager *oauth.Manager, config *environment.Config) error {
+	state, redirect, err := oauthManager.Begin(c.UserContext(), c.Params("provider"))
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(sessionCookie(oauthStateCookie, state, oauthPath, time.Now().Add(config.OAUTH.StateTTL)))
+	return c.Redirect(redirect, fiber.StatusFound)
+}
+
+// OAuthCallback finishes a sign-in when the provider redirects back, opens a
+// session and sends the browser to the frontend. Errors are shown on the
+// frontend login page rather than as JSON.
+func OAuthCallback(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, oauthManager *oauth.Manager, config *environment.Config) error {
+	state := c.Cookies(oauthStateCookie)
+	c.Cookie(sessionCookie(oauthStateCookie, "", oauthPath, time.Now().Add(-time.Hour)))
+
+	twoFactor, err := oauthSignIn(c, store, sessionManager, oauthManager, state, config)
+	if err != nil {
+		if projectError.ErrorCode(err) == projectError.EINTERNAL {
+			log.Printf("%s %s: %v", c.Method(), c.Path(), err)
+		}
+		return c.Redirect(config.FRONTEND_URL+"/login?error="+url.QueryEscape(projectError.ErrorMessage(err)), fiber.StatusFound)
+	}
+
+	// A provider sign-in counts as the password: the code is still required.
+	if twoFactor {
+		return c.Redirect(config.FRONTEND_URL+"/login?two_factor=1", fiber.StatusFound)
+	}
+
+	return c.Redirect(config.FRONTEND_URL+"/dashboard", fiber.StatusFound)
+}
+
+func oauthSignIn(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, oauthManager *oauth.Manager, state string, config *environment.Config) (bool, error) {
+	if message := c.Query("error"); message != "" {
+		return false, projectError.Errorf(projectError.EUNAUTHORIZED, "Sign-in cancelled: %s", message)
+	}
+
+	if state == "" || c.Query("state") != state || c.Query("code") == "" {
+		return false, projectError.Errorf(projectError.EUNAUTHORIZED, "Sign-in expired or already used, try again")
+	}
+
+	identity, err := oauthManager.Complete(c.UserContext(), c.Params("provider"), state, c.Query("code"))
+	if err != nil {
+		return false, err
+	}
+
+	user, err := oauthUser(c, store, identity)
+	if err != nil {
+		return false, err
+	}
+
+	return signIn(c, store, sessionManager, user, config)
+}
+
+// oauthUser returns the user linked to identity. An identity seen for the
+// first time is linked to the user with the same email, or to a new user
+// without a password. Either way the provider must have verified the email,
+// otherwise anyone could take over an account by claiming its address. So
+// must we: someone could have registered the address with a password before
+// its owner, and linking would let them sign in to the owner's account.
+func oauthUser(c *fiber.Ctx, store *store.Store, identity oauth.Identity) (user_repo.User, error) {
+	repository := store.Users
+	user, err := repository.GetUserByIdentity(c.UserContext(), identity.Provider, identity.Subject)
+	if projectError.ErrorCode(err) != projectError.ENOTFOUND {
+		return user, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return user_repo.User{}, projectError.Errorf(projectError.EFORBIDDEN, "Your %s account has no verified email", identity.Provider)
+	}
+
+	user, err = repository.GetUserByEmail(c.UserContext(), identity.Email)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		name := identity.Name
+		if name == "" {
+			name = identity.Email
+		}
+
+		// The empty password matches no bcrypt hash, so password login stays
+		// closed until the user sets one.
+		user = user_repo.User{Name: name, Email: identity.Email, Role: user_repo.RoleUser}
+		user.ID, _, err = repository.RegisterUser(c.UserContext(), &user)
+	} else if err == nil && user.EmailVerifiedAt == nil {
+		return user_repo.User{}, projectError.Errorf(projectError.EFORBIDDEN,
+			"An account with this email already exists. Sign in with your password and verify your email, then sign in with %s again", identity.Provider)
+	}
+	if err != nil {
+		return user_repo.User{}, err
+	}
+
+	err = repository.LinkIdentity(c.UserContext(), &user_repo.UserIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		IdUser:   user.ID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return user_repo.User{}, err
+	}
+
+	// The provider has verified the address of the new user, which spares
+	// them our link.
+	if user.EmailVerifiedAt == nil {
+		if err := repository.MarkEmailVerified(c.UserContext(), user.ID, user.Email, time.Now()); err != nil {
+			return user_repo.User{}, err
+		}
+	}
+
+	return user, nil
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/oauth"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// signInWith runs oauthUser for identity in a request, as the callback does.
+func signInWith(t *testing.T, s *store.Store, identity oauth.Identity) (user_repo.User, error) {
+	t.Helper()
+
+	var user user_repo.User
+	var err error
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		user, err = oauthUser(c, s, identity)
+		return nil
+	})
+	if _, testErr := app.Test(httptest.NewRequest("GET", "/", nil)); testErr != nil {
+		t.Fatal(testErr)
+	}
+
+	return user, err
+}
+
+func TestOAuthUser(t *testing.T) {
+	ctx := context.Background()
+	identity := oauth.Identity{Provider: "google", Subject: "subject", Email: "ada@example.com", EmailVerified: true, Name: "Ada"}
+
+	tests := []struct {
+		name string
+		// existing registers the account that has the email already, if any.
+		existing func(t *testing.T, s *store.Store) string
+		identity oauth.Identity
+		code     string
+	}{
+		{
+			name:     "new email",
+			identity: identity,
+		},
+		{
+			name: "account with the email verified",
+			existing: func(t *testing.T, s *store.Store) string {
+				id, _, err := s.Users.RegisterUser(ctx, &user_repo.User{Name: "Ada", Email: identity.Email, Password: "hash"})
+				if err == nil {
+					err = s.Users.MarkEmailVerified(ctx, id, identity.Email, time.Now())
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+			identity: identity,
+		},
+		{
+			name: "account with the email unverified",
+			existing: func(t *testing.T, s *store.Store) string {
+				id, _, err := s.Users.RegisterUser(ctx, &user_repo.User{Name: "Eve", Email: identity.Email, Password: "hash"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+			identity: identity,
+			code:     projectError.EFORBIDDEN,
+		},
+		{
+			name:     "email not verified by the provider",
+			identity: oauth.Identity{Provider: "google", Subject: "subject", Email: "ada@example.com"},
+			code:     projectError.EFORBIDDEN,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &environment.Config{}
+			config.DB.Driver = environment.DBDriverMemory
+			s, err := store.NewStore(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			existing := ""
+			if test.existing != nil {
+				existing = test.existing(t, s)
+			}
+
+			user, err := signInWith(t, s, test.identity)
+			if test.code != "" {
+				if projectError.ErrorCode(err) != test.code {
+					t.Fatalf("oauthUser = %+v, %v; want %s", user, err, test.code)
+				}
+				// Nothing is linked, so the provider cannot sign in later.
+				if _, err := s.Users.GetUserByIdentity(ctx, test.identity.Provider, test.identity.Subject); projectError.ErrorCode(err) != projectError.ENOTFOUND {
+					t.Fatalf("GetUserByIdentity = %v; want not found", err)
+				}
+				return
+			}
+
+			if err != nil || user.Email != identity.Email || (existing != "" && user.ID != existing) {
+				t.Fatalf("oauthUser = %+v, %v; want the account of %s", user, err, identity.Email)
+			}
+			linked, err := s.Users.GetUserByIdentity(ctx, identity.Provider, identity.Subject)
+			if err != nil || linked.ID != user.ID || linked.EmailVerifiedAt == nil {
+				t.Fatalf("GetUserByIdentity = %+v, %v; want %s linked and verified", linked, err, user.ID)
+			}
+		})
+	}
+}
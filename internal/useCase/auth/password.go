@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/lockout"
+	"url_shortening/infra/mailer"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/cryptPkg"
+	"url_shortening/pkg/projectError"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// passwordResetSendTimeout bounds sending a reset email, which happens after
+// the response.
+const passwordResetSendTimeout = 30 * time.Second
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8"`
+}
+
+// ForgotPassword emails a password reset link. The answer is the same
+// whether or not the email has an account, and the email is sent after
+// responding, so neither the body nor the timing reveals it.
+func ForgotPassword(c *fiber.Ctx, store *store.Store, mail mailer.Mailer, config *environment.Config) error {
+	var request ForgotPasswordRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	repository := store.Users
+	user, err := repository.GetUserByEmail(c.UserContext(), request.Email)
+	if err == nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+			defer cancel()
+
+			if err := sendPasswordReset(ctx, store, mail, user, config); err != nil {
+				log.Printf("password reset for user %s: %v", user.ID, err)
+			}
+		}()
+	} else if projectError.ErrorCode(err) != projectError.ENOTFOUND {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "If an account exists for this email, a reset link has been sent",
+	})
+}
+
+func sendPasswordReset(ctx context.Context, store *store.Store, mail mailer.Mailer, user user_repo.User, config *environment.Config) error {
+	token, err := newUserToken(ctx, store, user, user_repo.TokenResetPassword, config.AUTH.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := config.FRONTEND_URL + "/reset-password?token=" + url.QueryEscape(token)
+	return sendMail(ctx, mail, user, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nChoose a new password by opening this link:\n\n%s\n\nThe link expires in %s and works once. If you did not ask for it, ignore this email; your password is unchanged.\n",
+			user.Name, link, expiresIn(config.AUTH.PasswordResetTTL)),
+	})
+}
+
+// ResetPassword sets a new password with a token from a reset email and
+// signs out every session of the user. It also lifts a sign-in lock on the
+// account, as the user proved they own it.
+func ResetPassword(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, guard *lockout.Guard, config *environment.Config) error {
+	var request ResetPasswordRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	repository := store.Users
+	token, err := repository.ConsumeUserToken(c.UserContext(), cryptPkg.HashToken(request.Token), user_repo.TokenResetPassword, now)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return projectError.Errorf(projectError.EINVALID, "Reset link is invalid or expired")
+	} else if err != nil {
+		return err
+	}
+
+	user, err := repository.GetUserByID(c.UserContext(), token.IdUser)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND || (err == nil && user.Email != token.Email) {
+		return projectError.Errorf(projectError.EINVALID, "Reset link is invalid or expired")
+	} else if err != nil {
+		return err
+	}
+
+	if err := setPassword(c.UserContext(), store, sessionManager, user.ID, request.Password, ""); err != nil {
+		return err
+	}
+
+	// Following the link proved the user owns the address.
+	if user.EmailVerifiedAt == nil {
+		if err := repository.MarkEmailVerified(c.UserContext(), user.ID, user.Email, now); err != nil {
+			return err
+		}
+	}
+
+	if err := guard.Unlock(c.UserContext(), lockout.KindAccount, user.Email); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password reset, sign in with your new password",
+	})
+}
+
+// ChangePassword replaces the password of the authenticated user and signs
+// out their other sessions. Users without a password, who signed up with a
+// provider, set one through ForgotPassword.
+func ChangePassword(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, config *environment.Config) error {
+	var request ChangePasswordRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	// 403 rather than 401: the session is fine, the frontend must not
+	// refresh it and retry.
+	if !cryptPkg.ComparePassword(request.CurrentPassword, user.Password) {
+		return projectError.Errorf(projectError.EFORBIDDEN, "Current password is incorrect")
+	}
+
+	sid, _ := c.Locals("sid").(string)
+	if err := setPassword(c.UserContext(), store, sessionManager, user.ID, request.NewPassword, sid); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password changed, other sessions were signed out",
+	})
+}
+
+// setPassword stores a new password for idUser. Sessions other than keep are
+// signed out first, so a failure never leaves them alive with the new
+// password, and pending reset links are invalidated.
+func setPassword(ctx context.Context, store *store.Store, sessionManager *sessions.Manager, idUser string, password string, keep string) error {
+	if err := sessionManager.RevokeAll(ctx, idUser, keep); err != nil {
+		return err
+	}
+
+	hashedPassword, err := cryptPkg.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	repository := store.Users
+	if err := repository.UpdatePassword(ctx, idUser, hashedPassword); err != nil {
+		return err
+	}
+
+	return repository.DeleteUserTokens(ctx, idUser, user_repo.TokenResetPassword)
+}
+
+// parseRequest decodes and validates the JSON body into request.
+func parseRequest(c *fiber.Ctx, request any) error {
+	err := json.Unmarshal(c.Body(), request)
+	if err != nil {
+		return projectError.Errorf(projectError.EINVALID, "Invalid JSON")
+	}
+
+	validate := validator.New()
+
+	err = validate.Struct(request)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		return projectError.Errorf(projectError.EINVALID, "Validation error: %s", errors)
+	}
+
+	return nil
+}
@@ -2,19 +2,18 @@ package auth
 
 import (
 	"encoding/json"
-	"fmt"
-	"time"
+	"log"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
-	"url_shortening/infra/db/redis"
+	"url_shortening/infra/mailer"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
 	"url_shortening/internal/domain/repository/user_repo"
 	"url_shortening/pkg/cryptPkg"
-	"url_shortening/pkg/jwtpkg"
+	"url_shortening/pkg/projectError"
 
 	"github.com/go-playground/validator/v10"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type RegisterRequest struct {
@@ -23,7 +22,7 @@ type RegisterRequest struct {
 	Password string `json:"password" validate:"required,min=8"`
 }
 
-func Register(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *environment.Config) error {
+func Register(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, mail mailer.Mailer, config *environment.Config) error {
 
 	body := c.Body()
 
@@ -31,9 +30,7 @@ func Register(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *e
 
 	err := json.Unmarshal(body, &user)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid JSON",
-		})
+		return projectError.Errorf(projectError.EINVALID, "Invalid JSON")
 	}
 
 	validate := validator.New()
@@ -43,57 +40,42 @@ func Register(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *e
 	if err != nil {
 		// Validation failed, handle the error
 		errors := err.(validator.ValidationErrors)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Validation error: %s", errors),
-		})
+		return projectError.Errorf(projectError.EINVALID, "Validation error: %s", errors)
 	}
 
 	hashedPassword, err := cryptPkg.HashPassword(user.Password)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
-	repository := user_repo.NewUserRepository(db, config)
-	id, email, err := repository.RegisterUser(&user_repo.User{
+	repository := store.Users
+	id, email, err := repository.RegisterUser(c.UserContext(), &user_repo.User{
 		Name:     user.Name,
 		Email:    user.Email,
 		Password: hashedPassword,
 	})
 
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
-	token, err := jwtpkg.GenerateToken(jwt.MapClaims{
-		"id":    id,
-		"email": email,
-	}, config.JWT_SECRET)
+	if err := startSession(c, sessionManager, user_repo.User{ID: id, Email: email, Role: user_repo.RoleUser}, config); err != nil {
+		return err
+	}
 
+	// The account exists either way; the user can ask for another email.
+	err = sendVerification(c.UserContext(), store, mail, user_repo.User{ID: id, Name: user.Name, Email: email}, config)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		log.Printf("verification email not sent on registration: %v", err)
 	}
 
-	cookie := new(fiber.Cookie)
-	cookie.Name = "token"
-	cookie.Value = token
-	cookie.Expires = time.Now().Add(24 * time.Hour)
-	cookie.HTTPOnly = true
-	cookie.Secure = false // Set to true in production with HTTPS
-	cookie.SameSite = "Lax"
-	c.Cookie(cookie)
-
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "User registered successfully",
 		"user": fiber.Map{
-			"id":    id,
-			"name":  user.Name,
-			"email": email,
+			"id":             id,
+			"name":           user.Name,
+			"email":          email,
+			"email_verified": false,
 		},
 	})
 }
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/jwtpkg"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	accessCookie  = "token"
+	refreshCookie = "refresh_token"
+	// refreshPath limits the refresh token cookie to the auth endpoints.
+	refreshPath = "/auth"
+)
+
+// startSession opens a session for user and sets its cookies.
+func startSession(c *fiber.Ctx, sessionManager *sessions.Manager, user user_repo.User, config *environment.Config) error {
+	session, refresh, err := sessionManager.Create(c.UserContext(), user.ID, user.Email, user.Role, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return err
+	}
+
+	return setSessionCookies(c, session, refresh, config)
+}
+
+// setSessionCookies sets a new access token for session and its refresh
+// token.
+func setSessionCookies(c *fiber.Ctx, session sessions.Session, refresh string, config *environment.Config) error {
+	token, err := jwtpkg.GenerateToken(jwt.MapClaims{
+		"id":    session.IdUser,
+		"email": session.Email,
+		"sid":   session.ID,
+		"role":  session.Role,
+	}, config.JWT_SECRET, config.AUTH.AccessTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(sessionCookie(accessCookie, token, "/", time.Now().Add(config.AUTH.AccessTokenTTL)))
+	c.Cookie(sessionCookie(refreshCookie, refresh, refreshPath, time.Now().Add(config.AUTH.RefreshTokenTTL)))
+	return nil
+}
+
+func clearSessionCookies(c *fiber.Ctx) {
+	c.Cookie(sessionCookie(accessCookie, "", "/", time.Now().Add(-time.Hour)))
+	c.Cookie(sessionCookie(refreshCookie, "", refreshPath, time.Now().Add(-time.Hour)))
+}
+
+func sessionCookie(name string, value string, path string, expires time.Time) *fiber.Cookie {
+	cookie := new(fiber.Cookie)
+	cookie.Name = name
+	cookie.Value = value
+	cookie.Path = path
+	cookie.Expires = expires
+	cookie.HTTPOnly = true
+	cookie.Secure = false // Set to true in production with HTTPS
+	cookie.SameSite = "Lax"
+	return cookie
+}
+
+// Refresh exchanges the refresh token cookie for a new access and refresh
+// token. A refresh token can only be used once.
+func Refresh(c *fiber.Ctx, sessionManager *sessions.Manager, config *environment.Config) error {
+	refresh := c.Cookies(refreshCookie)
+	if refresh == "" {
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Refresh token not found")
+	}
+
+	session, refresh, err := sessionManager.Refresh(c.UserContext(), refresh, c.IP())
+	if projectError.ErrorCode(err) == projectError.EUNAUTHORIZED {
+		clearSessionCookies(c)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if err := setSessionCookies(c, session, refresh, config); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Session refreshed",
+	})
+}
+
+type sessionItem struct {
+	sessions.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions returns the active sessions of the user, flagging the one
+// making the request.
+func ListSessions(c *fiber.Ctx, sessionManager *sessions.Manager, config *environment.Config) error {
+	list, err := sessionManager.List(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	items := make([]sessionItem, len(list))
+	for i, session := range list {
+		items[i] = sessionItem{Session: session, Current: session.ID == c.Locals("sid")}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sessions": items,
+	})
+}
+
+// RevokeSession ends one of the user's sessions. Its access tokens stop
+// working at once and its refresh token can no longer be used.
+func RevokeSession(c *fiber.Ctx, sessionManager *sessions.Manager, config *environment.Config) error {
+	if err := sessionManager.Revoke(c.UserContext(), c.Locals("id").(string), c.Params("id")); err != nil {
+		return err
+	}
+
+	if c.Params("id") == c.Locals("sid") {
+		clearSessionCookies(c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Session revoked",
+	})
+}
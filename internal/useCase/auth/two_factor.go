@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/lockout"
+	"url_shortening/infra/mailer"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/cryptPkg"
+	"url_shortening/pkg/projectError"
+	"url_shortening/pkg/totpPkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// challengeCookie holds the login challenge between the password and the
+	// two-factor code. It is only sent to the login endpoints.
+	challengeCookie = "login_challenge"
+	challengePath   = "/auth/login"
+
+	recoveryCodeCount = 10
+)
+
+type TwoFactorRequest struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+type ConfirmTwoFactorRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// signIn opens a session for user after a right password or provider
+// sign-in. When user has two-factor authentication enabled, it starts a
+// login challenge instead and reports that a code is required.
+func signIn(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, user user_repo.User, config *environment.Config) (bool, error) {
+	if err := checkDisabled(user); err != nil {
+		return false, err
+	}
+
+	repository := store.Users
+	totp, err := repository.GetTOTP(c.UserContext(), user.ID)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND || (err == nil && !totp.Enabled()) {
+		return false, startSession(c, sessionManager, user, config)
+	} else if err != nil {
+		return false, err
+	}
+
+	token, err := sessionManager.CreateChallenge(c.UserContext(), user.ID, user.Email)
+	if err != nil {
+		return false, err
+	}
+
+	c.Cookie(sessionCookie(challengeCookie, token, challengePath, time.Now().Add(sessions.ChallengeTTL)))
+	return true, nil
+}
+
+// LoginTwoFactor finishes a login started by Login with a code from the
+// authenticator app or a recovery code, and opens the session. Wrong codes
+// count as failed sign-ins, so restarting the login does not give fresh
+// guesses.
+func LoginTwoFactor(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, guard *lockout.Guard, mail mailer.Mailer, config *environment.Config) error {
+	var request TwoFactorRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	token := c.Cookies(challengeCookie)
+	if token == "" {
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Sign-in expired, enter your password again")
+	}
+
+	challenge, err := sessionManager.Challenge(c.UserContext(), token)
+	if err != nil {
+		return err
+	}
+
+	if err := checkLockout(c, guard, challenge.Email); err != nil {
+		return err
+	}
+
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), challenge.IdUser)
+	if err != nil {
+		return err
+	}
+
+	// The account may have been disabled since the password was checked.
+	if err := checkDisabled(user); err != nil {
+		clearChallengeCookie(c)
+		return err
+	}
+
+	ok, err := checkSecondFactor(c.UserContext(), store, user.ID, request)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		if err := failLogin(c, store, guard, mail, challenge.Email, config); err != nil {
+			return err
+		}
+
+		open, err := sessionManager.FailChallenge(c.UserContext(), token)
+		if err != nil {
+			return err
+		}
+		if !open {
+			clearChallengeCookie(c)
+			return projectError.Errorf(projectError.EUNAUTHORIZED, "Too many invalid codes, enter your password again")
+		}
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "Invalid code")
+	}
+
+	clearChallengeCookie(c)
+	if err := sessionManager.CompleteChallenge(c.UserContext(), token); err != nil {
+		return err
+	}
+
+	if err := startSession(c, sessionManager, user, config); err != nil {
+		return err
+	}
+
+	if err := guard.Succeed(c.UserContext(), challenge.Email); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Login successful",
+		"user": fiber.Map{
+			"id":    user.ID,
+			"name":  user.Name,
+			"email": user.Email,
+		},
+	})
+}
+
+// checkDisabled refuses to sign in a user an admin disabled. It is only
+// called once the password or provider proved who is signing in, so it does
+// not tell strangers which accounts are disabled.
+func checkDisabled(user user_repo.User) error {
+	if user.Disabled() {
+		return projectError.Errorf(projectError.EFORBIDDEN, "This account is disabled")
+	}
+	return nil
+}
+
+func clearChallengeCookie(c *fiber.Ctx) {
+	c.Cookie(sessionCookie(challengeCookie, "", challengePath, time.Now().Add(-time.Hour)))
+}
+
+// checkSecondFactor reports whether request holds a valid code for idUser.
+// Authenticator codes are accepted once, recovery codes are used up.
+func checkSecondFactor(ctx context.Context, store *store.Store, idUser string, request TwoFactorRequest) (bool, error) {
+	repository := store.Users
+	now := time.Now()
+
+	if request.RecoveryCode != "" {
+		err := repository.ConsumeRecoveryCode(ctx, idUser, cryptPkg.HashToken(normalizeRecoveryCode(request.RecoveryCode)), now)
+		if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	totp, err := repository.GetTOTP(ctx, idUser)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND || (err == nil && !totp.Enabled()) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	step, ok := totpPkg.Validate(totp.Secret, request.Code, now)
+	if !ok {
+		return false, nil
+	}
+
+	err = repository.UseTOTPStep(ctx, idUser, step)
+	if projectError.ErrorCode(err) == projectError.ECONFLICT {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// TwoFactorStatus reports whether the authenticated user has two-factor
+// authentication enabled and how many recovery codes they have left.
+func TwoFactorStatus(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	idUser := c.Locals("id").(string)
+
+	repository := store.Users
+	totp, err := repository.GetTOTP(c.UserContext(), idUser)
+	if err != nil && projectError.ErrorCode(err) != projectError.ENOTFOUND {
+		return err
+	}
+
+	left, err := repository.CountRecoveryCodes(c.UserContext(), idUser)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"enabled":             totp.Enabled(),
+		"recovery_codes_left": left,
+	})
+}
+
+// EnrollTwoFactor creates a secret for an authenticator app. It only
+// protects sign-ins once ConfirmTwoFactor receives a first code, so a
+// mistyped secret cannot lock the user out.
+func EnrollTwoFactor(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	secret := totpPkg.GenerateSecret()
+	err = repository.SaveTOTP(c.UserContext(), user.ID, secret)
+	if projectError.ErrorCode(err) == projectError.ECONFLICT {
+		return projectError.Errorf(projectError.ECONFLICT, "Two-factor authentication is already enabled")
+	} else if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": totpPkg.ProvisioningURI(config.AUTH.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTwoFactor enables two-factor authentication with a first code from
+// the app and returns the recovery codes, which are shown only once. Other
+// sessions, opened without a code, are signed out.
+func ConfirmTwoFactor(c *fiber.Ctx, store *store.Store, sessionManager *sessions.Manager, config *environment.Config) error {
+	var request ConfirmTwoFactorRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	idUser := c.Locals("id").(string)
+
+	repository := store.Users
+	totp, err := repository.GetTOTP(c.UserContext(), idUser)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return projectError.Errorf(projectError.EINVALID, "Start the enrollment first")
+	} else if err != nil {
+		return err
+	} else if totp.Enabled() {
+		return projectError.Errorf(projectError.ECONFLICT, "Two-factor authentication is already enabled")
+	}
+
+	step, ok := totpPkg.Validate(totp.Secret, request.Code, time.Now())
+	if !ok {
+		return projectError.Errorf(projectError.EINVALID, "Invalid code")
+	}
+
+	codes, hashes := newRecoveryCodes()
+	err = repository.ConfirmTOTP(c.UserContext(), idUser, step, time.Now(), hashes)
+	if projectError.ErrorCode(err) == projectError.ECONFLICT {
+		return projectError.Errorf(projectError.EINVALID, "Invalid code")
+	} else if err != nil {
+		return err
+	}
+
+	sid, _ := c.Locals("sid").(string)
+	if err := sessionManager.RevokeAll(c.UserContext(), idUser, sid); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the authenticated
+// user, who must prove they still have a second factor.
+func RegenerateRecoveryCodes(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	var request TwoFactorRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	idUser := c.Locals("id").(string)
+	if err := requireSecondFactor(c.UserContext(), store, idUser, request); err != nil {
+		return err
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err := store.Users.ReplaceRecoveryCodes(c.UserContext(), idUser, hashes); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor removes the authenticator app and recovery codes of the
+// authenticated user, who must enter a code first.
+func DisableTwoFactor(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	var request TwoFactorRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	idUser := c.Locals("id").(string)
+	if err := requireSecondFactor(c.UserContext(), store, idUser, request); err != nil {
+		return err
+	}
+
+	if err := store.Users.DeleteTOTP(c.UserContext(), idUser); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// requireSecondFactor fails with 403 unless request holds a valid code. 403
+// rather than 401: the session is fine, the frontend must not refresh it.
+func requireSecondFactor(ctx context.Context, store *store.Store, idUser string, request TwoFactorRequest) error {
+	totp, err := store.Users.GetTOTP(ctx, idUser)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND || (err == nil && !totp.Enabled()) {
+		return projectError.Errorf(projectError.EINVALID, "Two-factor authentication is not enabled")
+	} else if err != nil {
+		return err
+	}
+
+	ok, err := checkSecondFactor(ctx, store, idUser, request)
+	if err != nil {
+		return err
+	} else if !ok {
+		return projectError.Errorf(projectError.EFORBIDDEN, "Invalid code")
+	}
+
+	return nil
+}
+
+// newRecoveryCodes returns recovery codes, formatted as xxxxx-xxxxx, and
+// the hashes stored for them.
+func newRecoveryCodes() ([]string, []string) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, 7)
+		rand.Read(random)
+		code := strings.ToLower(encoding.EncodeToString(random))[:10]
+
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = cryptPkg.HashToken(code)
+	}
+
+	return codes, hashes
+}
+
+// normalizeRecoveryCode accepts codes typed with any case, spaces or dashes.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
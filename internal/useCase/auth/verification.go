@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/mailer"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/user_repo"
+	"url_shortening/pkg/cryptPkg"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// sendVerification emails the user a link to confirm email. Links sent
+// earlier stop working.
+func sendVerification(ctx context.Context, store *store.Store, mail mailer.Mailer, user user_repo.User, config *environment.Config) error {
+	token, err := newUserToken(ctx, store, user, user_repo.TokenVerifyEmail, config.AUTH.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := config.FRONTEND_URL + "/verify-email?token=" + url.QueryEscape(token)
+	return sendMail(ctx, mail, user, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Text: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires in %s. If you did not create an account, ignore this email.\n",
+			user.Name, link, expiresIn(config.AUTH.VerificationTTL)),
+	})
+}
+
+// newUserToken replaces the user's tokens for purpose with a new one valid
+// for ttl, and returns it.
+func newUserToken(ctx context.Context, store *store.Store, user user_repo.User, purpose string, ttl time.Duration) (string, error) {
+	repository := store.Users
+	if err := repository.DeleteUserTokens(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+
+	token := cryptPkg.RandomToken(32)
+	err := repository.CreateUserToken(ctx, &user_repo.UserToken{
+		IdUser:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	}, cryptPkg.HashToken(token))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// sendMail sends message to user. Delivery failures are logged and answered
+// with 503, as the mail server may recover.
+func sendMail(ctx context.Context, mail mailer.Mailer, user user_repo.User, message mailer.Message) error {
+	if err := mail.Send(ctx, message); err != nil {
+		log.Printf("failed to send %q to user %s: %v", message.Subject, user.ID, err)
+		return projectError.Errorf(projectError.EUNAVAILABLE, "Email could not be sent, try again later")
+	}
+
+	return nil
+}
+
+// VerifyEmail confirms the email a verification link was sent to. The token
+// is the proof, so no session is needed.
+func VerifyEmail(c *fiber.Ctx, store *store.Store, config *environment.Config) error {
+	var request VerifyEmailRequest
+	if err := parseRequest(c, &request); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	repository := store.Users
+	token, err := repository.ConsumeUserToken(c.UserContext(), cryptPkg.HashToken(request.Token), user_repo.TokenVerifyEmail, now)
+	if err == nil {
+		err = repository.MarkEmailVerified(c.UserContext(), token.IdUser, token.Email, now)
+	}
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return projectError.Errorf(projectError.EINVALID, "Verification link is invalid or expired")
+	} else if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Email verified",
+	})
+}
+
+// ResendVerification sends the authenticated user a new verification link.
+func ResendVerification(c *fiber.Ctx, store *store.Store, mail mailer.Mailer, config *environment.Config) error {
+	repository := store.Users
+	user, err := repository.GetUserByID(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Email already verified",
+		})
+	}
+
+	if err := sendVerification(c.UserContext(), store, mail, user, config); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
+
+// expiresIn renders a token lifetime for an email, e.g. "24 hours".
+func expiresIn(ttl time.Duration) string {
+	if ttl >= time.Hour {
+		return fmt.Sprintf("%d hours", int(ttl.Hours()))
+	}
+	return fmt.Sprintf("%d minutes", int(ttl.Minutes()))
+}
@@ -0,0 +1,42 @@
+package urlShortening
+
+import (
+	"url_shortening/infra/cache"
+	"url_shortening/infra/config/environment"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/pkg/projectError"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func History(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, config *environment.Config) error {
+
+	repository := store.Urls
+	history, err := repository.GetUrlHistory(c.UserContext(), c.Params("id"), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"history": history,
+	})
+}
+
+// Revert points a link back to the destination recorded in a history entry.
+func Revert(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, config *environment.Config) error {
+
+	repository := store.Urls
+	entry, err := repository.GetUrlHistoryEntry(c.UserContext(), c.Params("id"), c.Params("historyId"), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	switch entry.Action {
+	case urlShortening_repo.HistoryCreate, urlShortening_repo.HistoryUpdate, urlShortening_repo.HistoryRevert:
+	default:
+		return projectError.Errorf(projectError.EINVALID, "History entry does not record a destination")
+	}
+
+	return updateDestination(c, store, urlCache, config, *entry.NewValue, urlShortening_repo.HistoryRevert)
+}
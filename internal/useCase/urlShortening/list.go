@@ -1,32 +1,60 @@
 package urlShortening
 
 import (
+	"log"
+	"url_shortening/infra/cache"
+	"url_shortening/infra/clicks"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
-	"url_shortening/infra/db/redis"
-	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/pkg/projectError"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func ListUserUrls(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *environment.Config) error {
+func ListUserUrls(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, clicks *clicks.Counter, config *environment.Config) error {
 	// Obter ID do usuário do contexto (via middleware de autenticação)
 	userID, ok := c.Locals("id").(string)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not authenticated",
-		})
+		return projectError.Errorf(projectError.EUNAUTHORIZED, "User not authenticated")
 	}
 
-	repository := urlShortening_repo.NewUrlShorteningRepository(db, config)
-	urls, err := repository.GetUserUrls(userID)
+	repository := store.Urls
+	urls, err := repository.GetUserUrls(c.UserContext(), userID, c.QueryBool("deleted"))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve URLs",
-		})
+		return err
+	}
+
+	// Add the clicks still waiting in Redis so counts are live. If Redis is
+	// down the last flushed counts are still shown.
+	slugs := make([]string, len(urls))
+	for i, url := range urls {
+		slugs[i] = url.Slug
+	}
+
+	pending, err := clicks.Pending(c.UserContext(), slugs)
+	if err != nil {
+		log.Printf("failed to read pending clicks: %v", err)
+	}
+	for i := range urls {
+		urls[i].Clicks += pending[urls[i].Slug]
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"urls": urls,
 	})
 }
+
+// Clicks returns the daily click counts of a link. Clicks of the current
+// flush interval are not included yet.
+func Clicks(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, config *environment.Config) error {
+
+	repository := store.Urls
+	daily, err := repository.GetUrlClicks(c.UserContext(), c.Params("id"), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"daily": daily,
+	})
+}
@@ -0,0 +1,114 @@
+package urlShortening
+
+import (
+	"encoding/json"
+	"log"
+	"url_shortening/infra/cache"
+	"url_shortening/infra/config/environment"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/pkg/projectError"
+	"url_shortening/pkg/urlPkg"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type UpdateRequest struct {
+	Url string `json:"url" validate:"required,url"`
+}
+
+func actorFromCtx(c *fiber.Ctx) urlShortening_repo.Actor {
+	return urlShortening_repo.Actor{
+		IdUser:   c.Locals("id").(string),
+		ClientIP: c.IP(),
+	}
+}
+
+func Update(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, config *environment.Config) error {
+
+	var request UpdateRequest
+
+	err := json.Unmarshal(c.Body(), &request)
+	if err != nil {
+		return projectError.Errorf(projectError.EINVALID, "Invalid JSON")
+	}
+
+	validate := validator.New()
+
+	err = validate.Struct(request)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		return projectError.Errorf(projectError.EINVALID, "Validation error: %s", errors)
+	}
+
+	return updateDestination(c, store, urlCache, config, request.Url, urlShortening_repo.HistoryUpdate)
+}
+
+func updateDestination(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, config *environment.Config, url string, action string) error {
+
+	if len(url) > config.MAX_URL_LENGTH {
+		return projectError.Errorf(projectError.ETOOLARGE, "Url must be at most %d characters", config.MAX_URL_LENGTH)
+	}
+
+	urlCanonical, err := urlPkg.Canonicalize(url, config.URL_STRIP_TRACKING_PARAMS)
+	if err != nil {
+		return projectError.Errorf(projectError.EINVALID, "Invalid url")
+	}
+
+	repository := store.Urls
+	updated, err := repository.UpdateUrl(c.UserContext(), c.Params("id"), url, urlCanonical, action, actorFromCtx(c))
+	if err != nil {
+		return err
+	}
+
+	// The cached destination is stale now; the next redirect reloads it.
+	if err := urlCache.Del(c.UserContext(), updated.Slug); err != nil {
+		log.Printf("failed to invalidate url %q in cache: %v", updated.Slug, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"shortUrl":    updated.UrlShortened,
+		"originalUrl": updated.UrlOriginal,
+	})
+}
+
+func Delete(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, config *environment.Config) error {
+
+	repository := store.Urls
+	deleted, err := repository.DeleteUrl(c.UserContext(), c.Params("id"), actorFromCtx(c))
+	if err != nil {
+		return err
+	}
+
+	slugs.Deleted(c.UserContext(), deleted.Slug)
+
+	if err := urlCache.Del(c.UserContext(), deleted.Slug); err != nil {
+		log.Printf("failed to invalidate url %q in cache: %v", deleted.Slug, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Url deleted successfully",
+	})
+}
+
+func Restore(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, config *environment.Config) error {
+
+	repository := store.Urls
+	restored, err := repository.RestoreUrl(c.UserContext(), c.Params("id"), actorFromCtx(c))
+	if err != nil {
+		return err
+	}
+
+	slugs.Created(c.UserContext(), restored.Slug)
+
+	// The slug was cached as not found while the url was deleted.
+	if err := urlCache.Del(c.UserContext(), restored.Slug); err != nil {
+		log.Printf("failed to invalidate url %q in cache: %v", restored.Slug, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"shortUrl":    restored.UrlShortened,
+		"originalUrl": restored.UrlOriginal,
+	})
+}
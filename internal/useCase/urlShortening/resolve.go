@@ -0,0 +1,187 @@
+package urlShortening
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+	"url_shortening/infra/cache"
+	"url_shortening/infra/config/environment"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/pkg/projectError"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// cacheTTLJitter spreads expirations over ±10% of the TTL so links cached
+	// together do not all expire together.
+	cacheTTLJitter = 0.1
+	// earlyRefreshBeta tunes probabilistic early refresh; higher values
+	// refresh earlier.
+	earlyRefreshBeta = 1.0
+	cachedUrlPrefix  = "v1|"
+	// cachedGonePrefix marks slugs of links taken down or expired, followed
+	// by the message shown to visitors.
+	cachedGonePrefix = "gone|"
+)
+
+var (
+	lookups singleflight.Group
+
+	lookupMisses    = new(expvar.Int)
+	lookupCoalesced = new(expvar.Int)
+	lookupDatabase  = new(expvar.Int)
+	lookupEarly     = new(expvar.Int)
+
+	lookupFilterRejections = new(expvar.Int)
+)
+
+func init() {
+	stats := expvar.NewMap("url_lookups")
+	stats.Set("cache_misses", lookupMisses)
+	stats.Set("database", lookupDatabase)
+	stats.Set("coalesced", lookupCoalesced)
+	stats.Set("early_refreshes", lookupEarly)
+	stats.Set("filter_rejections", lookupFilterRejections)
+}
+
+// cachedUrl is the cache entry of a slug. Besides the destination it keeps
+// when the entry expires and how long the database lookup took, which drive
+// the probabilistic early refresh.
+type cachedUrl struct {
+	Url     string
+	Expires time.Time
+	Delta   time.Duration
+}
+
+func (e cachedUrl) encode() string {
+	return cachedUrlPrefix + strconv.FormatInt(e.Expires.UnixMilli(), 10) + "|" + strconv.FormatInt(e.Delta.Milliseconds(), 10) + "|" + e.Url
+}
+
+func decodeCachedUrl(value string) cachedUrl {
+	if rest, ok := strings.CutPrefix(value, cachedUrlPrefix); ok {
+		parts := strings.SplitN(rest, "|", 3)
+		if len(parts) == 3 {
+			expires, errExpires := strconv.ParseInt(parts[0], 10, 64)
+			delta, errDelta := strconv.ParseInt(parts[1], 10, 64)
+			if errExpires == nil && errDelta == nil {
+				return cachedUrl{Url: parts[2], Expires: time.UnixMilli(expires), Delta: time.Duration(delta) * time.Millisecond}
+			}
+		}
+	}
+
+	// Plain values written before entries carried metadata never refresh early.
+	return cachedUrl{Url: value}
+}
+
+// refreshEarly implements XFetch: the closer the entry is to expiring and the
+// slower it was to compute, the more likely a request refreshes it ahead of
+// time, so a hot key is reloaded by one request instead of expiring for all.
+func (e cachedUrl) refreshEarly(now time.Time) bool {
+	if e.Expires.IsZero() {
+		return false
+	}
+
+	gap := time.Duration(float64(e.Delta) * earlyRefreshBeta * -math.Log(rand.Float64()))
+	return !now.Add(gap).Before(e.Expires)
+}
+
+func jitterTTL(ttl time.Duration) time.Duration {
+	spread := float64(ttl) * cacheTTLJitter
+	return ttl + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+// cacheUrl caches url, read from the database, for ttl. Entries are no longer
+// served once ttl has passed, even by a layer that keeps them longer, so a link
+// is never redirected past its expiry.
+func cacheUrl(ctx context.Context, urlCache cache.Cache, slug string, url string, delta time.Duration, ttl time.Duration) {
+	entry := cachedUrl{Url: url, Expires: time.Now().Add(ttl), Delta: delta}
+	fillCache(ctx, urlCache, slug, entry.encode(), ttl)
+}
+
+// fillCache caches value, read from the database, unless the link changed
+// since: its slug then holds a tombstone, and the next lookup reads it again.
+func fillCache(ctx context.Context, urlCache cache.Cache, slug string, value string, ttl time.Duration) {
+	if err := urlCache.Fill(ctx, slug, value, ttl); err != nil && !errors.Is(err, cache.ErrTombstone) {
+		log.Printf("failed to set url %q in cache: %v", slug, err)
+	}
+}
+
+// resolveUrl returns the destination of slug, an ENOTFOUND error if it does
+// not exist, or an EGONE error if it was taken down or has expired.
+// Concurrent misses on the same slug share a single database lookup.
+func resolveUrl(ctx context.Context, urlCache cache.Cache, store *store.Store, config *environment.Config, slug string) (string, error) {
+	value, err := urlCache.Get(ctx, slug)
+	if err == nil && value == cache.NotFound {
+		return "", errUrlNotFound
+	} else if message, gone := strings.CutPrefix(value, cachedGonePrefix); err == nil && gone {
+		return "", projectError.Errorf(projectError.EGONE, "%s", message)
+	} else if err == nil {
+		now := time.Now()
+		entry := decodeCachedUrl(value)
+
+		// An entry past its expiry, kept by a layer with a longer TTL, is a
+		// miss: the link itself may have expired.
+		if entry.Expires.IsZero() || now.Before(entry.Expires) {
+			if entry.refreshEarly(now) {
+				lookupEarly.Add(1)
+				go lookups.Do(slug, func() (any, error) {
+					return loadUrl(context.WithoutCancel(ctx), urlCache, store, config, slug)
+				})
+			}
+			return entry.Url, nil
+		}
+	}
+
+	lookupMisses.Add(1)
+	executed := false
+	// The lookup is shared with other requests, so it must not be cut short
+	// when this one goes away; the repository timeout still bounds it.
+	url, err, _ := lookups.Do(slug, func() (any, error) {
+		executed = true
+		return loadUrl(context.WithoutCancel(ctx), urlCache, store, config, slug)
+	})
+	if !executed {
+		lookupCoalesced.Add(1)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return url.(string), nil
+}
+
+func loadUrl(ctx context.Context, urlCache cache.Cache, store *store.Store, config *environment.Config, slug string) (string, error) {
+	lookupDatabase.Add(1)
+
+	start := time.Now()
+	repository := store.Urls
+	urlOriginal, err := repository.GetUrl(ctx, slug)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		fillCache(ctx, urlCache, slug, cache.NotFound, config.CACHE.NegativeTTL)
+		return "", err
+	} else if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	ttl := jitterTTL(config.CACHE.TTL)
+
+	if message, gone := urlOriginal.Gone(now); gone {
+		fillCache(ctx, urlCache, slug, cachedGonePrefix+message, ttl)
+		return "", projectError.Errorf(projectError.EGONE, "%s", message)
+	}
+
+	if urlOriginal.ExpiresAt != nil {
+		ttl = min(ttl, urlOriginal.ExpiresAt.Sub(now))
+	}
+
+	cacheUrl(ctx, urlCache, slug, urlOriginal.UrlOriginal, now.Sub(start), ttl)
+	return urlOriginal.UrlOriginal, nil
+}
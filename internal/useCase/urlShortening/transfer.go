@@ -0,0 +1,186 @@
+package urlShortening
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+	"url_shortening/infra/cache"
+	"url_shortening/infra/config/environment"
+	"url_shortening/infra/sessions"
+	"url_shortening/internal/domain/repository/store"
+	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/pkg/projectError"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type TransferRequest struct {
+	Email string   `json:"email" validate:"required,email"`
+	Ids   []string `json:"ids" validate:"required,min=1,dive,required"`
+}
+
+func CreateTransfer(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, config *environment.Config) error {
+
+	var request TransferRequest
+
+	err := json.Unmarshal(c.Body(), &request)
+	if err != nil {
+		return projectError.Errorf(projectError.EINVALID, "Invalid JSON")
+	}
+
+	validate := validator.New()
+
+	err = validate.Struct(request)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		return projectError.Errorf(projectError.EINVALID, "Validation error: %s", errors)
+	}
+
+	userRepository := store.Users
+	recipient, err := userRepository.GetUserByEmail(c.UserContext(), request.Email)
+	if projectError.ErrorCode(err) == projectError.ENOTFOUND {
+		return projectError.Errorf(projectError.ENOTFOUND, "Recipient not found")
+	} else if err != nil {
+		return err
+	}
+
+	repository := store.Urls
+	transfer, err := repository.CreateTransfer(c.UserContext(), request.Ids, recipient.ID, actorFromCtx(c))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"transfer": transfer,
+	})
+}
+
+func ListTransfers(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, config *environment.Config) error {
+
+	repository := store.Urls
+	transfers, err := repository.GetUserTransfers(c.UserContext(), c.Locals("id").(string))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"transfers": transfers,
+	})
+}
+
+// AcceptTransfer moves the links of a transfer to the recipient. Accepting a
+// deletion transfer also deletes its sender.
+func AcceptTransfer(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, sessionManager *sessions.Manager, config *environment.Config) error {
+
+	repository := store.Urls
+	transfer, err := endTransfer(c.UserContext(), store, urlCache, slugs, sessionManager, func(ctx context.Context) (urlShortening_repo.UrlTransfer, error) {
+		return repository.AcceptTransfer(ctx, c.Params("id"), actorFromCtx(c))
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"transfer": transfer,
+	})
+}
+
+// DeclineTransfer ends a transfer without moving its links. Declining a
+// deletion transfer deletes its sender with the links.
+func DeclineTransfer(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, sessionManager *sessions.Manager, config *environment.Config) error {
+
+	repository := store.Urls
+	transfer, err := endTransfer(c.UserContext(), store, urlCache, slugs, sessionManager, func(ctx context.Context) (urlShortening_repo.UrlTransfer, error) {
+		return repository.CloseTransfer(ctx, c.Params("id"), urlShortening_repo.TransferDeclined, actorFromCtx(c))
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"transfer": transfer,
+	})
+}
+
+// CancelTransfer ends a transfer without moving its links. Cancelling a
+// deletion transfer keeps the account of the sender.
+func CancelTransfer(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, config *environment.Config) error {
+
+	repository := store.Urls
+	transfer, err := repository.CloseTransfer(c.UserContext(), c.Params("id"), urlShortening_repo.TransferCancelled, actorFromCtx(c))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"transfer": transfer,
+	})
+}
+
+// ExpireDeletionTransfers ends the deletion transfers pending for longer than
+// ttl and deletes their senders with the links that were not taken.
+func ExpireDeletionTransfers(ctx context.Context, store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, sessionManager *sessions.Manager, ttl time.Duration) error {
+
+	repository := store.Urls
+	transfers, err := repository.GetExpiredDeletionTransfers(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		return err
+	}
+
+	for _, transfer := range transfers {
+		_, err := endTransfer(ctx, store, urlCache, slugs, sessionManager, func(ctx context.Context) (urlShortening_repo.UrlTransfer, error) {
+			return repository.ExpireTransfer(ctx, transfer.ID)
+		})
+		// The transfer ended meanwhile, or went with an account deleted since.
+		if code := projectError.ErrorCode(err); code == projectError.ECONFLICT || code == projectError.ENOTFOUND {
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// endTransfer ends a pending transfer with end. The sender of a deletion
+// transfer is deleted in the same transaction, so the account is never left
+// without its transfer ended or the other way round.
+func endTransfer(ctx context.Context, store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, sessionManager *sessions.Manager, end func(ctx context.Context) (urlShortening_repo.UrlTransfer, error)) (urlShortening_repo.UrlTransfer, error) {
+
+	var transfer urlShortening_repo.UrlTransfer
+	var purged []string
+	err := store.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if transfer, err = end(ctx); err != nil || !transfer.DeleteSender {
+			return err
+		}
+
+		purged, err = store.DeleteUser(ctx, transfer.IdUserFrom)
+		return err
+	})
+	if err != nil {
+		return urlShortening_repo.UrlTransfer{}, err
+	}
+
+	if !transfer.DeleteSender {
+		return transfer, nil
+	}
+
+	// The account is gone: failures below only leave sessions of a user who
+	// no longer exists and cache entries that expire.
+	if err := sessionManager.RevokeAll(ctx, transfer.IdUserFrom, ""); err != nil {
+		log.Printf("failed to revoke sessions of deleted user %s: %v", transfer.IdUserFrom, err)
+	}
+
+	if len(purged) > 0 {
+		slugs.Deleted(ctx, purged...)
+
+		if err := urlCache.Del(ctx, purged...); err != nil {
+			log.Printf("failed to invalidate urls of deleted user %s in cache: %v", transfer.IdUserFrom, err)
+		}
+	}
+
+	return transfer, nil
+}
@@ -3,21 +3,28 @@ package urlShortening
 import (
 	"encoding/json"
 	"fmt"
-	"time"
+	"html"
+	"log"
+	"url_shortening/infra/cache"
+	"url_shortening/infra/clicks"
 	"url_shortening/infra/config/environment"
-	"url_shortening/infra/db/postgres"
-	"url_shortening/infra/db/redis"
+	"url_shortening/internal/domain/repository/store"
 	"url_shortening/internal/domain/repository/urlShortening_repo"
+	"url_shortening/pkg/projectError"
+	"url_shortening/pkg/urlPkg"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
+var errUrlNotFound = projectError.Errorf(projectError.ENOTFOUND, "URL not found")
+
 type RegisterRequest struct {
 	Url string `json:"url" validate:"required,url"`
 }
 
-func Register(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *environment.Config) error {
+func Register(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, config *environment.Config) error {
 
 	body := c.Body()
 
@@ -25,9 +32,7 @@ func Register(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *e
 
 	err := json.Unmarshal(body, &request)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid JSON",
-		})
+		return projectError.Errorf(projectError.EINVALID, "Invalid JSON")
 	}
 
 	validate := validator.New()
@@ -37,31 +42,40 @@ func Register(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *e
 	if err != nil {
 		// Validation failed, handle the error
 		errors := err.(validator.ValidationErrors)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Validation error: %s", errors),
-		})
+		return projectError.Errorf(projectError.EINVALID, "Validation error: %s", errors)
 	}
 
 	if err = json.Unmarshal(body, &request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return projectError.Errorf(projectError.EINVALID, "Invalid request body")
 	}
 
-	repository := urlShortening_repo.NewUrlShorteningRepository(db, config)
+	if len(request.Url) > config.MAX_URL_LENGTH {
+		return projectError.Errorf(projectError.ETOOLARGE, "Url must be at most %d characters", config.MAX_URL_LENGTH)
+	}
 
-	urlShortened, err := repository.RegisterUrl(&request.Url, c.Locals("id").(string))
+	urlCanonical, err := urlPkg.Canonicalize(request.Url, config.URL_STRIP_TRACKING_PARAMS)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return projectError.Errorf(projectError.EINVALID, "Invalid url")
 	}
 
-	err = redis.Set(urlShortened.Slug, request.Url, 3*time.Minute)
+	repository := store.Urls
+
+	urlShortened, err := repository.RegisterUrl(c.UserContext(), &request.Url, urlCanonical, urlShortening_repo.Actor{
+		IdUser:   c.Locals("id").(string),
+		ClientIP: c.IP(),
+	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to set url in redis",
-		})
+		return err
+	}
+
+	slugs.Created(c.UserContext(), urlShortened.Slug)
+
+	// Drop any "not found" entry cached while the slug did not exist yet. The
+	// link is not cached here: the tombstone left by the delete keeps a lookup
+	// that started before the insert from caching "not found" again, and would
+	// refuse this entry too.
+	if err := urlCache.Del(c.UserContext(), urlShortened.Slug); err != nil {
+		log.Printf("failed to invalidate url %q in cache: %v", urlShortened.Slug, err)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -70,30 +84,46 @@ func Register(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *e
 	})
 }
 
-func GetUrl(c *fiber.Ctx, db *postgres.Postgres, redis *redis.Redis, config *environment.Config) error {
-	urlShortened := c.Params("urlShortened")
-
-	url, err := redis.Get(urlShortened)
-	if err == nil {
-		c.Redirect(url, 302)
-		return nil
+func GetUrl(c *fiber.Ctx, store *store.Store, urlCache cache.Cache, slugs *cache.Slugs, clicks *clicks.Counter, config *environment.Config) error {
+	// Params point into a buffer fiber reuses for the next request, while the
+	// slug outlives this one as a cache key and in the click goroutine.
+	urlShortened := utils.CopyString(c.Params("urlShortened"))
+
+	// Slugs that were never created are rejected without any lookup. One
+	// created on another instance whose broadcast was lost is too, until the
+	// next slug filter sync.
+	if !slugs.MayExist(urlShortened) {
+		lookupFilterRejections.Add(1)
+		return errUrlNotFound
 	}
 
-	repository := urlShortening_repo.NewUrlShorteningRepository(db, config)
-	urlOriginal, err := repository.GetUrl(urlShortened)
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "URL not found",
-		})
+	url, err := resolveUrl(c.UserContext(), urlCache, store, config, urlShortened)
+	if projectError.ErrorCode(err) == projectError.EGONE && c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML {
+		return sendGonePage(c, projectError.ErrorMessage(err))
+	} else if err != nil {
+		return err
 	}
 
-	err = redis.Set(urlOriginal.Slug, urlOriginal.UrlOriginal, 3*time.Minute)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to set url in redis",
-		})
-	}
+	// Counting must not delay the redirect.
+	clicks.Add(urlShortened)
 
-	c.Redirect(urlOriginal.UrlOriginal, 302)
+	c.Redirect(url, 302)
 	return nil
 }
+
+// gonePage is shown to browsers following a link that was taken down or has
+// expired. API clients get the usual JSON error.
+const gonePage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Link unavailable</title></head>
+<body style="font-family: sans-serif; background: #111827; color: #f3f4f6; text-align: center; padding: 4rem 1rem">
+<h1>410 · Link unavailable</h1>
+<p>%s</p>
+</body>
+</html>
+`
+
+func sendGonePage(c *fiber.Ctx, message string) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(fiber.StatusGone).SendString(fmt.Sprintf(gonePage, html.EscapeString(message)))
+}
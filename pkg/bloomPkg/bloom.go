@@ -0,0 +1,77 @@
+package bloomPkg
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// CountingFilter is a Bloom filter with 8-bit counters instead of bits, so
+// keys can be removed as well as added. A counter that reaches 255 sticks
+// there, which can only cause false positives, never false negatives.
+// CountingFilter is not safe for concurrent use.
+type CountingFilter struct {
+	counters []uint8
+	k        uint64
+}
+
+// NewCounting sizes a filter for n keys at a false positive rate of p.
+func NewCounting(n int, p float64) *CountingFilter {
+	if n < 1 {
+		n = 1
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+
+	return &CountingFilter{counters: make([]uint8, m), k: k}
+}
+
+func (f *CountingFilter) Add(key string) {
+	f.each(key, func(i uint64) {
+		if f.counters[i] < math.MaxUint8 {
+			f.counters[i]++
+		}
+	})
+}
+
+// Remove undoes one Add of key. Keys that were never added are ignored when
+// the filter can tell, but removing a false positive still corrupts it.
+func (f *CountingFilter) Remove(key string) {
+	if !f.Test(key) {
+		return
+	}
+
+	f.each(key, func(i uint64) {
+		if f.counters[i] > 0 && f.counters[i] < math.MaxUint8 {
+			f.counters[i]--
+		}
+	})
+}
+
+// Test reports whether key may have been added. False means it never was.
+func (f *CountingFilter) Test(key string) bool {
+	found := true
+	f.each(key, func(i uint64) {
+		if f.counters[i] == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+// each calls fn with the k counter positions of key, derived from two FNV
+// hashes with double hashing.
+func (f *CountingFilter) each(key string, fn func(i uint64)) {
+	h1 := fnv.New64a()
+	h1.Write([]byte(key))
+	a := h1.Sum64()
+
+	h2 := fnv.New64()
+	h2.Write([]byte(key))
+	b := h2.Sum64() | 1
+
+	m := uint64(len(f.counters))
+	for i := uint64(0); i < f.k; i++ {
+		fn((a + i*b) % m)
+	}
+}
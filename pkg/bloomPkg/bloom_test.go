@@ -0,0 +1,105 @@
+package bloomPkg
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCountingFilterAddRemove(t *testing.T) {
+	f := NewCounting(1000, 0.01)
+
+	if f.Test("slug") {
+		t.Fatal("empty filter has slug")
+	}
+
+	f.Add("slug")
+	f.Add("slug")
+	if !f.Test("slug") {
+		t.Fatal("Test = false after Add")
+	}
+
+	f.Remove("slug")
+	if !f.Test("slug") {
+		t.Fatal("Test = false with one Add left")
+	}
+
+	f.Remove("slug")
+	if f.Test("slug") {
+		t.Fatal("Test = true after every Add was removed")
+	}
+}
+
+func TestCountingFilterRemoveKeepsOtherKeys(t *testing.T) {
+	f := NewCounting(1000, 0.01)
+
+	for i := range 1000 {
+		f.Add(fmt.Sprint("slug-", i))
+	}
+	for i := 0; i < 1000; i += 2 {
+		f.Remove(fmt.Sprint("slug-", i))
+	}
+
+	for i := 1; i < 1000; i += 2 {
+		if !f.Test(fmt.Sprint("slug-", i)) {
+			t.Fatalf("slug-%d lost after removing other keys", i)
+		}
+	}
+
+	removed := 0
+	for i := 0; i < 1000; i += 2 {
+		if !f.Test(fmt.Sprint("slug-", i)) {
+			removed++
+		}
+	}
+	if removed < 450 {
+		t.Fatalf("%d of 500 removed keys are gone; want nearly all", removed)
+	}
+}
+
+func TestCountingFilterFalsePositiveRate(t *testing.T) {
+	f := NewCounting(10000, 0.01)
+	for i := range 10000 {
+		f.Add(fmt.Sprint("slug-", i))
+	}
+
+	positives := 0
+	for i := range 10000 {
+		if f.Test(fmt.Sprint("other-", i)) {
+			positives++
+		}
+	}
+
+	// 1% expected; allow for chance.
+	if positives > 200 {
+		t.Fatalf("%d false positives in 10000; want about 100", positives)
+	}
+}
+
+func TestCountingFilterSaturatedCountersStick(t *testing.T) {
+	f := NewCounting(10, 0.01)
+
+	for range math.MaxUint8 + 10 {
+		f.Add("slug")
+	}
+	for range math.MaxUint8 + 10 {
+		f.Remove("slug")
+	}
+
+	// A saturated counter no longer knows how many adds it holds, so it
+	// must never reach zero: that would be a false negative.
+	if !f.Test("slug") {
+		t.Fatal("Test = false after saturating and removing; want the counters stuck")
+	}
+}
+
+func TestCountingFilterRemoveOfUnknownKey(t *testing.T) {
+	f := NewCounting(1000, 0.01)
+	f.Add("slug")
+
+	f.Remove("never-added")
+
+	if !f.Test("slug") {
+		t.Fatal("removing a key that was never added removed another")
+	}
+}
@@ -1,6 +1,12 @@
 package cryptPkg
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -15,3 +21,37 @@ func HashPassword(password string) (string, error) {
 func ComparePassword(password, hash string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
+
+// dummyHash is a hash no password matches, computed on first use.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword(RandomToken(32))
+	return hash
+})
+
+// ComparePasswordOrDummy is ComparePassword for a hash that may be missing,
+// for an unknown user or one without a password. A missing hash never
+// matches but is checked against a dummy hash, so it takes as long as a
+// wrong password and does not reveal which users exist.
+func ComparePasswordOrDummy(password string, hash string, ok bool) bool {
+	if !ok || hash == "" {
+		ComparePassword(password, dummyHash())
+		return false
+	}
+	return ComparePassword(password, hash)
+}
+
+// RandomToken returns size random bytes, base64url encoded, for secrets such
+// as refresh tokens and API keys.
+func RandomToken(size int) string {
+	token := make([]byte, size)
+	rand.Read(token)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// HashToken returns the SHA-256 of a random token, hex encoded. Unlike
+// passwords, such tokens carry enough entropy that a fast hash is safe, and it
+// lets them be looked up by hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -40,3 +40,12 @@ func GetEnvOrDieAsInt(key string) (int, error) {
 
 	return value, nil
 }
+
+func GetEnvOrDefault(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
@@ -1,6 +1,7 @@
 package projectError
 
 import (
+	"context"
 	"errors"
 	"fmt"
 )
@@ -8,10 +9,15 @@ import (
 const (
 	ECONFLICT       = "conflict"
 	EINTERNAL       = "internal"
+	EFORBIDDEN      = "forbidden"
+	EGONE           = "gone"
 	EINVALID        = "invalid"
 	ENOTFOUND       = "not_found"
 	ENOTIMPLEMENTED = "not_implemented"
+	ERATELIMITED    = "rate_limited"
+	ETOOLARGE       = "too_large"
 	EUNAUTHORIZED   = "unauthorized"
+	EUNAVAILABLE    = "unavailable"
 )
 
 type Error struct {
@@ -33,6 +39,10 @@ func ErrorCode(err error) string {
 		return e.Code
 	}
 
+	if errors.Is(err, context.DeadlineExceeded) {
+		return EUNAVAILABLE
+	}
+
 	return EINTERNAL
 }
 
@@ -42,6 +52,8 @@ func ErrorMessage(err error) string {
 		return ""
 	} else if errors.As(err, &e) {
 		return e.Message
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		return "Service temporarily unavailable, the request timed out."
 	}
 	return "Internal error."
 }
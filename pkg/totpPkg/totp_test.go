@@ -0,0 +1,79 @@
+package totpPkg
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors, base32 encoded.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// TestValidateRFC6238 checks the SHA1 vectors of RFC 6238 appendix B, cut to
+// the last 6 of their 8 digits.
+func TestValidateRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		now := time.Unix(test.unix, 0)
+		step, ok := Validate(rfcSecret, test.code, now)
+		if !ok || step != test.unix/30 {
+			t.Fatalf("Validate(%s, %d) = %d, %v; want step %d", test.code, test.unix, step, ok, test.unix/30)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -1, true},
+		{"next step", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, current+test.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			step, ok := Validate(rfcSecret, code, now)
+			if ok != test.ok || (ok && step != current+test.offset) {
+				t.Fatalf("Validate = %d, %v; want %v at step %d", step, ok, test.ok, current+test.offset)
+			}
+		})
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	for code, ok := range map[string]bool{"287 082": true, "287082 ": true, "28708": false, "2870820": false, "": false} {
+		if _, got := Validate(rfcSecret, code, now); got != ok {
+			t.Fatalf("Validate(%q) = %v; want %v", code, got, ok)
+		}
+	}
+
+	if _, ok := Validate("not base32!", "287082", now); ok {
+		t.Fatal("Validate accepted a code for an invalid secret")
+	}
+}
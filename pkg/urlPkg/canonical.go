@@ -0,0 +1,100 @@
+package urlPkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+	"url_shortening/pkg/projectError"
+
+	"golang.org/x/net/idna"
+)
+
+// trackingParams are query parameters that only carry campaign metadata and
+// never change the resource a URL points to.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+	"yclid":   true,
+	"_ga":     true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalize returns the form of rawUrl used to detect duplicates: scheme and
+// host lowercased, IDN hosts converted to punycode, default ports, fragments
+// and (optionally) tracking parameters removed and query parameters sorted.
+// The result is only meant for comparison; redirects keep the original URL.
+func Canonicalize(rawUrl string, stripTracking bool) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", projectError.Errorf(projectError.EINVALID, "invalid url: %q", rawUrl)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if net.ParseIP(host) == nil {
+		host, err = idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", projectError.Errorf(projectError.EINVALID, "invalid url host: %q", u.Hostname())
+		}
+	}
+
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	query := u.Query()
+	if stripTracking {
+		for key := range query {
+			if isTrackingParam(key) {
+				query.Del(key)
+			}
+		}
+	}
+	// Encode sorts by key and keeps the order of repeated values.
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, "utm_") || trackingParams[key]
+}
+
+// Hash returns the hex encoded SHA-256 of a canonical URL. It is stored next
+// to the URL so uniqueness can be enforced without indexing unbounded text.
+func Hash(urlCanonical string) string {
+	sum := sha256.Sum256([]byte(urlCanonical))
+	return hex.EncodeToString(sum[:])
+}